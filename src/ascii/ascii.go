@@ -8,6 +8,9 @@ import (
 	"strings"
 )
 
+// SplitMessages is a bufio.SplitFunc framing GEMS-ASCII messages by their
+// "|END" trailer. Decoder frames messages by their length field instead,
+// and should be preferred for streams that may be corrupt.
 func SplitMessages(data []byte, atEOF bool) (advance int, token []byte, err error) {
 	delimiter := []byte("|END")
 	if i := bytes.Index(data, delimiter); i >= 0 {
@@ -0,0 +1,240 @@
+package ascii
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// DefaultMaxMessageSize is the largest message a Decoder accepts unless
+// configured otherwise.
+const DefaultMaxMessageSize = 16 * 1024 * 1024
+
+const (
+	// headerLen is the length of the fixed-width header "|GEMS|VV|LLLLLLLLLL|".
+	headerLen = 20
+	// minMessageLen is the length of a message with an empty body.
+	minMessageLen = headerLen + len("END")
+	readSize      = 4096
+)
+
+var (
+	startMarker = []byte("|GEMS")
+	endMarker   = []byte("|END")
+)
+
+// A SyncError reports corrupt data in a GEMS-ASCII stream. After returning
+// a SyncError, a Decoder discards the input up to the next "|GEMS" marker
+// before decoding the next message.
+type SyncError struct {
+	// Offset is the position of the corrupt data in the stream.
+	Offset int64
+	// Data holds the start of the corrupt data.
+	Data []byte
+	Msg  string
+}
+
+func (e *SyncError) Error() string {
+	return fmt.Sprintf("gems-ascii: corrupt stream at offset %d, %s", e.Offset, e.Msg)
+}
+
+// A Decoder reads GEMS-ASCII messages from a stream. Each message is
+// framed by the length field of its header, "|GEMS|14|%010d|", which
+// counts the bytes of the whole message.
+type Decoder struct {
+	r      io.Reader
+	buf    []byte
+	offset int64
+	max    int
+	resync bool
+	err    error
+}
+
+// NewDecoder returns a Decoder reading from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r, max: DefaultMaxMessageSize}
+}
+
+// SetMaxMessageSize sets the largest message the decoder accepts. Longer
+// messages are reported with a SyncError and skipped.
+func (d *Decoder) SetMaxMessageSize(n int) {
+	d.max = max(n, minMessageLen)
+}
+
+// Decode returns the next message in the stream. Whitespace between
+// messages is ignored. At the end of the stream it returns io.EOF, or
+// io.ErrUnexpectedEOF if the stream ends within a message.
+//
+// Corrupt data is reported with a *SyncError, after which Decode can be
+// called again to continue with the next message.
+func (d *Decoder) Decode() ([]byte, error) {
+	if d.resync {
+		if err := d.discard(); err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		if err := d.fill(1); err != nil {
+			return nil, err
+		}
+		i := 0
+		for (i < len(d.buf)) && isSpace(d.buf[i]) {
+			i++
+		}
+		d.consume(i)
+		if len(d.buf) > 0 {
+			break
+		}
+	}
+
+	if err := d.fill(headerLen); err != nil {
+		return nil, d.partial(err)
+	}
+	if !bytes.HasPrefix(d.buf, startMarker) {
+		return nil, d.corrupt(len(startMarker), "invalid start of message")
+	}
+	header := d.buf[:headerLen]
+	if (header[5] != '|') || (header[8] != '|') || (header[19] != '|') || !isDigits(header[6:8]) || !isDigits(header[9:19]) {
+		return nil, d.corrupt(headerLen, "invalid message header")
+	}
+
+	length, _ := strconv.Atoi(string(header[9:19]))
+	if length < minMessageLen {
+		return nil, d.corrupt(headerLen, fmt.Sprintf("invalid message length %d", length))
+	}
+	if length > d.max {
+		return nil, d.corrupt(headerLen, fmt.Sprintf("message length %d exceeds maximum %d", length, d.max))
+	}
+
+	// A message cannot contain the start of another, which would be a sign
+	// of a corrupt length field.
+	for scanned := len(startMarker); ; {
+		end := min(len(d.buf), length)
+		if bytes.Contains(d.buf[scanned:end], startMarker) {
+			return nil, d.corrupt(end, "message interrupted by the start of another")
+		}
+		if end == length {
+			break
+		}
+		scanned = max(scanned, end-len(startMarker)+1)
+		if err := d.fill(len(d.buf) + 1); err != nil {
+			return nil, d.partial(err)
+		}
+	}
+	if !bytes.HasSuffix(d.buf[:length], endMarker) {
+		return nil, d.corrupt(length, "missing message trailer at end of message length")
+	}
+
+	msg := bytes.Clone(d.buf[:length])
+	d.consume(length)
+	return msg, nil
+}
+
+// fill reads from the stream until the buffer holds at least n bytes.
+func (d *Decoder) fill(n int) error {
+	for len(d.buf) < n {
+		if d.err != nil {
+			return d.err
+		}
+
+		if cap(d.buf)-len(d.buf) < readSize {
+			buf := make([]byte, len(d.buf), max(2*cap(d.buf), len(d.buf)+readSize, n))
+			copy(buf, d.buf)
+			d.buf = buf
+		}
+		k, err := d.r.Read(d.buf[len(d.buf):cap(d.buf)])
+		d.buf = d.buf[:len(d.buf)+k]
+		if err != nil {
+			d.err = err
+		}
+	}
+	return nil
+}
+
+func (d *Decoder) consume(n int) {
+	d.buf = d.buf[n:]
+	d.offset += int64(n)
+}
+
+// partial converts the end of the stream within a message into
+// io.ErrUnexpectedEOF.
+func (d *Decoder) partial(err error) error {
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("received partial GEMS-ASCII message: %w", io.ErrUnexpectedEOF)
+	}
+	return err
+}
+
+// corrupt returns a SyncError for the data at the start of the buffer,
+// of which n bytes were examined, and schedules a resynchronization.
+func (d *Decoder) corrupt(n int, msg string) error {
+	err := &SyncError{Offset: d.offset, Data: bytes.Clone(d.buf[:min(n, len(d.buf))]), Msg: msg}
+	d.consume(1)
+	d.resync = true
+	return err
+}
+
+// discard drops the input up to the next "|GEMS" marker.
+func (d *Decoder) discard() error {
+	for {
+		if i := bytes.Index(d.buf, startMarker); i >= 0 {
+			d.consume(i)
+			d.resync = false
+			return nil
+		}
+
+		// Keep a possible start of the marker at the end of the buffer.
+		d.consume(max(0, len(d.buf)-len(startMarker)+1))
+		if err := d.fill(len(d.buf) + 1); err != nil {
+			return err
+		}
+	}
+}
+
+func isSpace(c byte) bool {
+	return (c == ' ') || (c == '\t') || (c == '\r') || (c == '\n')
+}
+
+func isDigits(b []byte) bool {
+	for _, c := range b {
+		if (c < '0') || (c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// An Encoder writes GEMS-ASCII messages to a stream.
+type Encoder struct {
+	w   io.Writer
+	max int
+}
+
+// NewEncoder returns an Encoder writing to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, max: DefaultMaxMessageSize}
+}
+
+// SetMaxMessageSize sets the largest message the encoder writes. Longer
+// messages are not written and Encode returns a *MarshalError, as a
+// Decoder with the same limit would skip them.
+func (e *Encoder) SetMaxMessageSize(n int) {
+	e.max = max(n, minMessageLen)
+}
+
+// Encode writes the GEMS-ASCII encoding of v to the stream in a single
+// write, so that messages written concurrently are not interleaved.
+func (e *Encoder) Encode(v Marshaler) error {
+	data, err := Marshal(v)
+	if err != nil {
+		return err
+	}
+	if len(data) > e.max {
+		return &MarshalError{Msg: fmt.Sprintf("message length %d exceeds maximum %d", len(data), e.max)}
+	}
+	_, err = e.w.Write(data)
+	return err
+}
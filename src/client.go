@@ -1,14 +1,18 @@
 package gems
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net"
 	"net/http"
+	"net/url"
+	"os"
 	"strings"
 	"time"
 
@@ -22,8 +26,18 @@ var (
 // Client is a GEMS client.
 type Client struct {
 	version Version
-	model   platformSpecificModel
+	model   Transport
 	f       MessageFormatter
+	logger  *slog.Logger
+
+	psm        string
+	transcript *TranscriptWriter
+
+	// Transport settings, applied once the options have chosen the
+	// Transport.
+	timeout        time.Duration
+	maxMessageSize int
+	proxy          *url.URL
 
 	// GEMS Connection State
 	token         string
@@ -31,22 +45,100 @@ type Client struct {
 	transactionID int64
 }
 
+// ClientOption configures optional behavior of a GEMS client.
+type ClientOption func(*Client)
+
+// WithClientLogger sets the logger used by the client. By default the
+// client logs to slog.Default().
+func WithClientLogger(l *slog.Logger) ClientOption {
+	return func(c *Client) {
+		if l != nil {
+			c.logger = l
+		}
+	}
+}
+
+// WithClientMaxMessageSize sets the largest message the client accepts,
+// 16 MiB by default.
+func WithClientMaxMessageSize(n int) ClientOption {
+	return func(c *Client) {
+		c.maxMessageSize = n
+	}
+}
+
+// WithClientTimeout sets how long the client waits to connect and for
+// each response, 5 seconds by default.
+func WithClientTimeout(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.timeout = d
+	}
+}
+
+// responseTimeout returns d, or the default client timeout if d is not
+// positive.
+func responseTimeout(d time.Duration) time.Duration {
+	if d <= 0 {
+		return clientTimeout
+	}
+	return d
+}
+
 // NewClient creates a GEMS client of the specified Platform Specific Module (PSM).
-// Valid values for psm are "XML" or "ASCII" (case-insensitive).
-func NewClient(version Version, psm string, f MessageFormatter) (*Client, error) {
-	c := &Client{f: f, transactionID: 0, version: version}
-	switch strings.ToLower(psm) {
-	case "xml":
-		c.model = &xmlClient{}
-	case "ascii":
-		c.model = &asciiClient{}
-	default:
-		return nil, fmt.Errorf("unknown PSM '%s'", psm)
+// Valid values for psm are "XML", "ASCII", "XML-TCP" or "XML-TCP-LENGTH"
+// (case-insensitive). The XML-TCP PSMs carry GEMS-XML directly on a TCP
+// connection, framed by the root element of each message or by a 4 byte
+// big-endian length prefix.
+func NewClient(version Version, psm string, f MessageFormatter, opts ...ClientOption) (*Client, error) {
+	model, err := NewTransport(psm, nil)
+	if err != nil {
+		return nil, err
 	}
 
+	c := &Client{f: f, model: model, transactionID: 0, version: version, logger: slog.Default(), psm: strings.ToLower(psm)}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if err := c.configureTransport(); err != nil {
+		return nil, err
+	}
 	return c, nil
 }
 
+// configureTransport applies the transport settings of the options to the
+// Transport of the client. A Transport other than those of NewTransport
+// cannot honor them.
+func (c *Client) configureTransport() error {
+	if (c.timeout == 0) && (c.maxMessageSize == 0) && (c.proxy == nil) {
+		return nil
+	}
+
+	switch t := c.model.(type) {
+	case *streamClient:
+		if c.timeout != 0 {
+			t.timeout = c.timeout
+		}
+		if c.maxMessageSize != 0 {
+			t.maxMessageSize = c.maxMessageSize
+		}
+		if c.proxy != nil {
+			t.dial = ProxyDial(c.proxy, t.dial)
+		}
+	case *xmlClient:
+		if c.timeout != 0 {
+			t.timeout = c.timeout
+		}
+		if c.maxMessageSize != 0 {
+			t.maxMessageSize = c.maxMessageSize
+		}
+		if c.proxy != nil {
+			t.proxy = c.proxy
+		}
+	default:
+		return fmt.Errorf("transport %T does not support the client timeout, maximum message size or proxy", c.model)
+	}
+	return nil
+}
+
 // Format uses the Client's MessageFormatter to format a GEMS Message.
 func (c *Client) Format(msg Message) string {
 	return c.f.Format(msg)
@@ -87,14 +179,22 @@ func (c *Client) connect(tls bool, addr string, typ ConnectionType, token string
 	}
 
 	var resp Response
+	start := time.Now()
 	if tls {
 		resp, err = c.model.ConnectTLS(addr, req, insecure, c.version)
 	} else {
 		resp, err = c.model.Connect(addr, req, c.version)
 	}
+	latency := time.Since(start)
+	if err == nil {
+		err = checkResponse(resp)
+	}
+	c.log(req, resp, err, latency)
+	c.record(req, resp, start, latency)
 	if err != nil {
 		return err
 	}
+	c.logger.Info("connected", slog.String(LogKeyRemoteAddr, c.model.ServerAddr()))
 
 	c.token = resp.Token()
 	c.transactionID++
@@ -110,7 +210,15 @@ func (c *Client) Disconnect(reason DisconnectReason) error {
 		return err
 	}
 
-	_, err = c.Send(msg)
+	// GEMS does not define a response to a DisconnectMessage, so the
+	// exchange is not logged as a failed request, and a device closing
+	// the connection in reply is the expected outcome.
+	c.transactionID++
+	_, err = c.model.Send(msg, c.version)
+	if errors.Is(err, errConnectionClosed) {
+		err = nil
+	}
+	c.logger.Debug("disconnected", slog.String(LogKeyRemoteAddr, c.model.ServerAddr()))
 	return err
 }
 
@@ -118,9 +226,76 @@ func (c *Client) Disconnect(reason DisconnectReason) error {
 // This is primarily for testing. Use the Client methods for
 // each message type to build a message that uses information
 // from the connection state.
+//
+// If the device answers with a result other than SUCCESS, Send and the
+// methods for each message type return the response along with a
+// *ResponseError.
 func (c *Client) Send(m Message) (Response, error) {
+	return c.exchange(m, func() (Response, error) {
+		return c.model.Send(m, c.version)
+	})
+}
+
+// exchange sends a message with send and logs and records the exchange.
+func (c *Client) exchange(m Message, send func() (Response, error)) (Response, error) {
 	c.transactionID++
-	return c.model.Send(m, c.version)
+
+	start := time.Now()
+	resp, err := send()
+	latency := time.Since(start)
+	if err == nil {
+		err = checkResponse(resp)
+	}
+	c.log(m, resp, err, latency)
+	c.record(m, resp, start, latency)
+	return resp, err
+}
+
+// Forward sends a message received from another GEMS client to the
+// connected device, as a proxy or gateway does. The message is sent with
+// the token and next transaction ID of this client, and the response is
+// returned with the transaction ID and token of m.
+func (c *Client) Forward(m Message) (Response, error) {
+	fwd, err := RewriteHeader(m, c.version, func(h *Header) {
+		h.TransactionID = NewNullInt64(c.transactionID)
+		h.Token = c.token
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.Send(fwd)
+	if resp == nil {
+		return nil, err
+	}
+
+	msg, rerr := RewriteHeader(resp, c.version, func(h *Header) {
+		h.TransactionID = m.TransactionID()
+		h.Token = m.Token()
+	})
+	if rerr != nil {
+		return nil, rerr
+	}
+	back, _ := msg.(Response)
+	return back, err
+}
+
+func (c *Client) record(req Message, resp Response, start time.Time, latency time.Duration) {
+	if c.transcript == nil {
+		return
+	}
+	if err := c.transcript.Record(c.psm, req, resp, start, latency); err != nil {
+		c.logger.Warn("failed to record exchange", slog.Any("error", err))
+	}
+}
+
+func (c *Client) log(req Message, resp Response, err error, latency time.Duration) {
+	attrs := append([]any{slog.String(LogKeyRemoteAddr, c.model.ServerAddr())}, exchangeAttrs(req, resp, latency)...)
+	if err != nil {
+		c.logger.Warn("request failed", append(attrs, slog.Any("error", err))...)
+		return
+	}
+	c.logger.Debug("received response", attrs...)
 }
 
 // GetConfig sends a GetConfigMessage to the connected GEMS
@@ -137,6 +312,45 @@ func (c *Client) GetConfig(names ...string) (Response, error) {
 	return c.Send(msg)
 }
 
+// GetConfigFunc sends a GetConfigMessage like GetConfig and passes each
+// parameter of the response to fn. Over the XML PSM the parameters are
+// decoded one at a time as the response is received and are not kept in
+// the returned response, so that responses with many or large parameters
+// do not need to fit in memory. Over the other PSMs the response is
+// decoded first and also holds the parameters. GetConfigFunc stops at the
+// first error returned by fn and returns it.
+func (c *Client) GetConfigFunc(fn func(Parameter) error, names ...string) (Response, error) {
+	msg, err := c.version.NewMessageBuilder().Type(GetConfigMessageType).TransactionID(c.transactionID).
+		Token(c.token).Target(c.target).DesiredParameters(names...).Build()
+	if err != nil {
+		return nil, err
+	}
+
+	if t, ok := c.model.(parameterStreamer); ok {
+		return c.exchange(msg, func() (Response, error) {
+			return t.SendFunc(msg, c.version, fn)
+		})
+	}
+
+	resp, err := c.Send(msg)
+	if m, ok := resp.(ParameterMessage); ok && (err == nil) {
+		for _, p := range m.ParameterList() {
+			if err := fn(p); err != nil {
+				return resp, err
+			}
+		}
+	}
+	return resp, err
+}
+
+// parameterStreamer is implemented by the transports that can decode the
+// parameters of a response as it is received.
+type parameterStreamer interface {
+	// SendFunc is Send, passing the parameters of the response to fn
+	// instead of keeping them in the response.
+	SendFunc(m Message, v Version, fn func(Parameter) error) (Response, error)
+}
+
 // SetConfig sends a SetConfigMessage to the connected GEMS device.
 func (c *Client) SetConfig(params []string) (Response, error) {
 	mb := c.version.NewMessageBuilder().Type(SetConfigMessageType).TransactionID(c.transactionID).
@@ -215,16 +429,14 @@ func (c *Client) Directive(dir string, params []string) (Response, error) {
 	return c.Send(msg)
 }
 
-type platformSpecificModel interface {
-	Connect(string, Message, Version) (Response, error)
-	ConnectTLS(string, Message, bool, Version) (Response, error)
-	Send(Message, Version) (Response, error)
-	ServerAddr() string
-}
-
 type xmlClient struct {
+	dial       DialFunc
+	proxy      *url.URL
 	serverAddr string
 	c          *http.Client
+
+	maxMessageSize int
+	timeout        time.Duration
 }
 
 func (x xmlClient) ServerAddr() string {
@@ -232,31 +444,38 @@ func (x xmlClient) ServerAddr() string {
 }
 
 func (x *xmlClient) Connect(addr string, req Message, v Version) (Response, error) {
+	return x.connect(addr, req, nil, v)
+}
+
+func (x *xmlClient) ConnectTLS(addr string, req Message, insecure bool, v Version) (Response, error) {
+	if !strings.HasPrefix(addr, "https://") {
+		addr = "https://" + addr
+	}
+	return x.connect(addr, req, &tls.Config{InsecureSkipVerify: insecure}, v)
+}
+
+func (x *xmlClient) connect(addr string, req Message, config *tls.Config, v Version) (Response, error) {
 	if !strings.HasPrefix(addr, "https://") && !strings.HasPrefix(addr, "http://") {
 		addr = "http://" + addr
 	}
 
 	x.serverAddr = addr
-	x.c = &http.Client{Timeout: clientTimeout}
+	x.c = &http.Client{Timeout: responseTimeout(x.timeout)}
+	if (config != nil) || (x.dial != nil) || (x.proxy != nil) {
+		t := &http.Transport{TLSClientConfig: config, DialContext: x.dial}
+		if x.proxy != nil {
+			t.Proxy = http.ProxyURL(x.proxy)
+		}
+		x.c.Transport = t
+	}
 	return x.Send(req, v)
 }
 
-func (x *xmlClient) ConnectTLS(addr string, req Message, insecure bool, v Version) (Response, error) {
-	x.c = &http.Client{
-		Timeout: clientTimeout,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: insecure,
-			},
-		},
-	}
-	if !strings.HasPrefix(addr, "https://") {
-		addr = "https://" + addr
-	}
-	return x.Connect(addr, req, v)
+func (x xmlClient) Send(m Message, v Version) (Response, error) {
+	return x.SendFunc(m, v, nil)
 }
 
-func (x xmlClient) Send(m Message, v Version) (Response, error) {
+func (x xmlClient) SendFunc(m Message, v Version, fn func(Parameter) error) (Response, error) {
 	payload, err := xml.Marshal(m)
 	if err != nil {
 		return nil, err
@@ -276,10 +495,12 @@ func (x xmlClient) Send(m Message, v Version) (Response, error) {
 		return nil, err
 	}
 
-	return x.Receive(resp, v)
+	return x.Receive(resp, v, fn)
 }
 
-func (x xmlClient) Receive(r *http.Response, v Version) (Response, error) {
+// Receive decodes the response in the body of r as it is read, passing
+// its parameters to fn if fn is not nil.
+func (x xmlClient) Receive(r *http.Response, v Version, fn func(Parameter) error) (Response, error) {
 	defer func(r io.ReadCloser) {
 		_, _ = io.Copy(io.Discard, r)
 		_ = r.Close()
@@ -289,12 +510,7 @@ func (x xmlClient) Receive(r *http.Response, v Version) (Response, error) {
 		return nil, fmt.Errorf("send failed: %s", r.Status)
 	}
 
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	msg, err := ReceiveXMLMessage(body, v)
+	msg, err := DecodeXMLMessage(newMessageReader(r.Body, x.maxMessageSize), v, fn)
 	if (err != nil) && (err != io.EOF) {
 		return nil, err
 	}
@@ -307,88 +523,152 @@ func (x xmlClient) Receive(r *http.Response, v Version) (Response, error) {
 	return resp, nil
 }
 
-type asciiClient struct {
+// streamClient carries a PSM directly on a stream connection, such as
+// GEMS-ASCII over TCP.
+type streamClient struct {
+	psm        string
+	framing    framing
+	dial       DialFunc
+	dec        messageDecoder
 	serverAddr string
 	tls        *tls.Config
 	conn       net.Conn
+	serial     bool
 	dataCh     chan []byte
 	errCh      chan error
+
+	maxMessageSize int
+	timeout        time.Duration
 }
 
-func (a asciiClient) ServerAddr() string {
+func (a streamClient) ServerAddr() string {
 	return a.serverAddr
 }
 
-// Listen scans the connection for GEMS ASCII messages.
-func (a asciiClient) Listen() {
+// Listen decodes the messages received on the connection.
+func (a streamClient) Listen() {
 	defer a.Close()
 
-	scanner := bufio.NewScanner(a.conn)
-	scanner.Split(ascii.SplitMessages)
-
-	for scanner.Scan() {
-		a.dataCh <- scanner.Bytes()
+	for {
+		data, err := a.dec.Decode()
+		var syncErr *ascii.SyncError
+		if errors.As(err, &syncErr) {
+			// Fail the pending request, if any, as its response may have
+			// been skipped.
+			select {
+			case a.errCh <- err:
+			default:
+			}
+			continue
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, os.ErrClosed) {
+				a.errCh <- err
+			}
+			return
+		}
+		a.dataCh <- data
 	}
+}
 
-	if err := scanner.Err(); err != nil {
-		a.errCh <- err
-	}
+func (a *streamClient) Connect(addr string, req Message, v Version) (Response, error) {
+	return a.connect(addr, req, nil, v)
+}
+
+func (a *streamClient) ConnectTLS(addr string, req Message, insecure bool, v Version) (Response, error) {
+	return a.connect(addr, req, &tls.Config{InsecureSkipVerify: insecure}, v)
 }
 
-func (a *asciiClient) Connect(addr string, req Message, v Version) (Response, error) {
+func (a *streamClient) connect(addr string, req Message, config *tls.Config, v Version) (Response, error) {
 	a.serverAddr = addr
 	a.dataCh = make(chan []byte)
 	a.errCh = make(chan error)
+	a.tls = config
+
+	ctx, cancel := context.WithTimeout(context.Background(), responseTimeout(a.timeout))
+	defer cancel()
 
-	d := net.Dialer{Timeout: clientTimeout}
-	conn, err := d.Dial("tcp", a.serverAddr)
+	var conn net.Conn
+	var err error
+	if path, baud, ok := serialAddr(addr); ok && (a.dial == nil) {
+		conn, err = OpenSerial(path, baud)
+		a.serial = true
+	} else {
+		dial := a.dial
+		if dial == nil {
+			d := net.Dialer{}
+			dial = d.DialContext
+		}
+		conn, err = dial(ctx, "tcp", addr)
+	}
 	if err != nil {
 		return nil, err
 	}
-	a.conn = conn
-
-	go a.Listen()
-	return a.Send(req, v)
-}
 
-func (a *asciiClient) ConnectTLS(addr string, req Message, insecure bool, v Version) (Response, error) {
-	a.serverAddr = addr
-	a.dataCh = make(chan []byte)
-	a.errCh = make(chan error)
-	a.tls = &tls.Config{InsecureSkipVerify: insecure}
+	if config != nil {
+		if host, _, err := net.SplitHostPort(addr); (err == nil) && (config.ServerName == "") {
+			config.ServerName = host
+		}
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
 
-	d := tls.Dialer{NetDialer: &net.Dialer{Timeout: clientTimeout}, Config: a.tls}
-	conn, err := d.Dial("tcp", addr)
-	if err != nil {
+	maxSize := a.maxMessageSize
+	if maxSize <= 0 {
+		maxSize = ascii.DefaultMaxMessageSize
+	}
+	if a.conn, a.dec, err = a.framing(conn, maxSize); err != nil {
+		conn.Close()
 		return nil, err
 	}
-	a.conn = conn
 
 	go a.Listen()
 	return a.Send(req, v)
 }
 
-func (a asciiClient) Send(m Message, v Version) (Response, error) {
-	payload, err := ascii.Marshal(m)
+func (a streamClient) Send(m Message, v Version) (Response, error) {
+	payload, err := encodeMessage(a.psm, m)
 	if err != nil {
 		return nil, err
 	}
+	if a.serial && (m.Type() == DisconnectMessageType) {
+		// A serial line has no end of stream to show that the device ended
+		// the session, so the line is closed without waiting for it.
+		a.conn.Write(payload)
+		a.conn.Close()
+		return nil, errConnectionClosed
+	}
+
 	a.conn.Write(payload)
 	return a.Receive(m.TransactionID(), v)
 }
 
-// Receive scans the connection stream for a ASCII message with a
-// transaction ID matching the request. Any other messages are ignored.
-func (a asciiClient) Receive(id NullInt64, v Version) (Response, error) {
-	timeout := time.After(clientTimeout)
+// errConnectionClosed is returned for a request that was pending when the
+// device closed the connection.
+var errConnectionClosed = errors.New("connection closed by the device")
+
+// Receive scans the connection stream for a message with a transaction
+// ID matching the request. Any other messages are ignored.
+func (a streamClient) Receive(id NullInt64, v Version) (Response, error) {
+	timeout := time.After(responseTimeout(a.timeout))
 	for {
 		select {
 		case <-timeout:
 			return nil, fmt.Errorf("timeout waiting for response")
-		case err := <-a.errCh:
+		case err, ok := <-a.errCh:
+			if !ok {
+				return nil, errConnectionClosed
+			}
 			return nil, err
-		case data := <-a.dataCh:
-			msg, err := ReceiveASCIIMessage(data, v)
+		case data, ok := <-a.dataCh:
+			if !ok {
+				return nil, errConnectionClosed
+			}
+			msg, err := decodeMessage(a.psm, data, v)
 			if err != nil {
 				continue
 			}
@@ -399,15 +679,12 @@ func (a asciiClient) Receive(id NullInt64, v Version) (Response, error) {
 			if !resp.TransactionMatch(id) {
 				continue
 			}
-			if resp.Result().Code != ResultCodeSuccess {
-				return resp, fmt.Errorf("gems response: %s", resp.Result())
-			}
 			return resp, nil
 		}
 	}
 }
 
-func (a *asciiClient) Close() error {
+func (a *streamClient) Close() error {
 	close(a.dataCh)
 	close(a.errCh)
 	return a.conn.Close()
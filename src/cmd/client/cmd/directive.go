@@ -1,8 +1,6 @@
 package cmd
 
 import (
-	"fmt"
-	"log"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -16,7 +14,7 @@ func init() {
 }
 
 var directiveCmd = &cobra.Command{
-	Use:   "directive [psm (ascii|xml)] [address (host:port)] [directive name]",
+	Use:   "directive [psm (ascii|xml|xml-tcp|xml-tcp-length)] [address (host:port)] [directive name]",
 	Short: "Send a directive",
 	Long: `Connects to a GEMS server and sends a DirectiveMessage.
 The DirectiveMessage invokes an action on the GEMS device. The message may contain
@@ -43,7 +41,7 @@ func directive(cmd *cobra.Command, args []string) {
 	if err != nil {
 		fatal(err)
 	}
-	log.Println(client.Format(resp))
-	fmt.Println(stdOut.Format(resp))
+	logResponse(resp)
+	printResponse(resp)
 	disconnect()
 }
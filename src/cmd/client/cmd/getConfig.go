@@ -1,9 +1,6 @@
 package cmd
 
 import (
-	"fmt"
-	"log"
-
 	"github.com/spf13/cobra"
 )
 
@@ -18,7 +15,7 @@ func init() {
 }
 
 var getConfigCmd = &cobra.Command{
-	Use:   "get [psm (ascii|xml)] [address (host:port)]",
+	Use:   "get [psm (ascii|xml|xml-tcp|xml-tcp-length)] [address (host:port)]",
 	Short: "Get the value of one or more parameters",
 	Long: `Connects to a GEMS server and sends a GetConfigMessage.
 The GetConfigMessage requests the current configuration from the GEMS 
@@ -33,7 +30,7 @@ func getConfig(cmd *cobra.Command, args []string) {
 	if err != nil {
 		fatal(err)
 	}
-	log.Println(client.Format(resp))
-	fmt.Println(stdOut.Format(resp))
+	logResponse(resp)
+	printResponse(resp)
 	disconnect()
 }
@@ -1,9 +1,6 @@
 package cmd
 
 import (
-	"fmt"
-	"log"
-
 	"github.com/spf13/cobra"
 )
 
@@ -12,7 +9,7 @@ func init() {
 }
 
 var getConfigListCmd = &cobra.Command{
-	Use:   "get-config-list [psm (ascii|xml)] [address (host:port)]",
+	Use:   "get-config-list [psm (ascii|xml|xml-tcp|xml-tcp-length)] [address (host:port)]",
 	Short: "List available configurations on the device",
 	Long: `Connects to a GEMS server and sends a GetConfigListMessage.
 The GetConfigListMessage retrieves all configurations available on 
@@ -27,8 +24,8 @@ func getConfigList(cmd *cobra.Command, args []string) {
 	if err != nil {
 		fatal(err)
 	}
-	log.Println(client.Format(resp))
-	fmt.Println(stdOut.Format(resp))
+	logResponse(resp)
+	printResponse(resp)
 
 	disconnect()
 }
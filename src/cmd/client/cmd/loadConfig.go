@@ -1,9 +1,6 @@
 package cmd
 
 import (
-	"fmt"
-	"log"
-
 	"github.com/spf13/cobra"
 )
 
@@ -12,7 +9,7 @@ func init() {
 }
 
 var loadConfigCmd = &cobra.Command{
-	Use:   "load [psm (ascii|xml)] [address (host:port)] [configuration name]",
+	Use:   "load [psm (ascii|xml|xml-tcp|xml-tcp-length)] [address (host:port)] [configuration name]",
 	Short: "Load a saved configuration",
 	Long: `Connects to a GEMS server and sends a LoadConfigMessage.
 The LoadConfigMessage loads the configuration with the provided name.
@@ -28,6 +25,6 @@ func loadConfig(cmd *cobra.Command, args []string) {
 	if err != nil {
 		fatal(err)
 	}
-	log.Println(client.Format(resp))
-	fmt.Println(stdOut.Format(resp))
+	logResponse(resp)
+	printResponse(resp)
 }
@@ -1,9 +1,6 @@
 package cmd
 
 import (
-	"fmt"
-	"log"
-
 	"github.com/spf13/cobra"
 )
 
@@ -12,7 +9,7 @@ func init() {
 }
 
 var pingCmd = &cobra.Command{
-	Use:   "ping [psm (ascii|xml)] [address (host:port)]",
+	Use:   "ping [psm (ascii|xml|xml-tcp|xml-tcp-length)] [address (host:port)]",
 	Short: "Ping a device",
 	Long: `Connects to a GEMS server and sends a PingMessage.
 The PingMessage provides a method for determining if a GEMS device
@@ -27,7 +24,7 @@ func ping(cmd *cobra.Command, args []string) {
 	if err != nil {
 		fatal(err)
 	}
-	log.Println(client.Format(resp))
-	fmt.Println(stdOut.Format(resp))
+	logResponse(resp)
+	printResponse(resp)
 	disconnect()
 }
@@ -1,8 +1,10 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/url"
 	"os"
 	"strings"
 
@@ -19,8 +21,21 @@ var (
 	password string
 	tls      bool
 	insecure bool
+	proxy    string
 	client   *gems.Client
-	stdOut   = gems.ResponseContentFormatter{}
+	output   string
+	facts    bool
+	format   string
+	stdOut   gems.MessageFormatter
+
+	logLevel    string
+	logFormat   string
+	logFilename string
+	logFile     *os.File
+	logger      *slog.Logger
+
+	record     string
+	recordFile *os.File
 )
 
 func init() {
@@ -29,14 +44,71 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&version, "version", "", "set the GEMS version (default: 1.4)")
 	rootCmd.PersistentFlags().BoolVar(&tls, "tls", false, "connect using TLS")
 	rootCmd.PersistentFlags().BoolVar(&insecure, "insecure", false, "allow self-signed certificates when connecting using TLS")
+	rootCmd.PersistentFlags().StringVar(&proxy, "proxy", "", "connect through a proxy (socks5://[user:pass@]host:port or http://[user:pass@]host:port)")
 
 	rootCmd.PersistentFlags().StringVar(&user, "user", "", "username for GEMS authentication")
 	rootCmd.PersistentFlags().StringVar(&password, "pass", "", "password for GEMS authentication")
+
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "minimum level of log messages (debug|info|warn|error)")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "format of log messages (text|json)")
+	rootCmd.PersistentFlags().StringVar(&logFilename, "log-file", "", "append log messages to a file instead of writing them to stderr")
+	rootCmd.PersistentFlags().StringVar(&output, "output", "text", "format of the responses written to stdout (text|json|yaml|csv|ascii|xml)")
+	rootCmd.PersistentFlags().BoolVar(&facts, "facts", false, "write the parameters, configurations and directives in responses as Caldera facts in JSON")
+	rootCmd.PersistentFlags().StringVar(&format, "format", "", "format the responses written to stdout with a Go template, e.g. '{{.Type}} {{resultCode .}}'")
+	rootCmd.MarkFlagsMutuallyExclusive("output", "facts", "format")
+	rootCmd.PersistentFlags().StringVar(&record, "record", "", "append the exchanges with the server to a transcript file")
 }
 
 var rootCmd = &cobra.Command{
 	Use:  "gems-client",
 	Long: "A client for producing GEMS communications.",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if facts {
+			output = "facts"
+		}
+		if format != "" {
+			output = "template"
+		}
+
+		switch output {
+		case "text":
+			stdOut = gems.ResponseContentFormatter{}
+		case "json":
+			stdOut = gems.JSONFormatter{}
+		case "yaml":
+			stdOut = gems.YAMLFormatter{}
+		case "csv":
+			stdOut = gems.CSVFormatter{}
+		case "ascii":
+			stdOut = gems.ASCIIFormatter{}
+		case "xml":
+			stdOut = gems.XMLFormatter{}
+		case "facts":
+			stdOut = gems.FactFormatter{}
+		case "template":
+			tmpl, err := gems.NewTemplateFormatter(format)
+			if err != nil {
+				return fmt.Errorf("invalid format: %w", err)
+			}
+			stdOut = tmpl
+		default:
+			return fmt.Errorf("unknown output format '%s'", output)
+		}
+
+		logOut := os.Stderr
+		if logFilename != "" {
+			var err error
+			logFile, err = os.OpenFile(logFilename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+			if err != nil {
+				return fmt.Errorf("failed to open log file: %w", err)
+			}
+			logOut = logFile
+		}
+
+		var err error
+		logger, err = gems.NewLogger(logOut, logFormat, logLevel)
+		return err
+	},
 }
 
 func connect(args []string) {
@@ -51,14 +123,31 @@ func connect(args []string) {
 	case "1.4", "14", "":
 		v = gemsV14.GemsV14{}
 	default:
-		fmt.Printf("version '%s' not implemented\n", version)
-		os.Exit(1)
+		exit("unsupported GEMS version", fmt.Errorf("version '%s' not implemented", version))
 	}
 
-	client, err = gems.NewClient(v, psm, gems.DefaultFormatter{})
+	opts := []gems.ClientOption{gems.WithClientLogger(logger)}
+	if record != "" {
+		recordFile, err = os.OpenFile(record, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			exit("failed to open transcript", err)
+		}
+		opts = append(opts, gems.WithTranscript(gems.NewTranscriptWriter(recordFile)))
+	}
+	if proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if (err == nil) && (proxyURL.Host == "") {
+			err = fmt.Errorf("'%s' has no host", proxy)
+		}
+		if err != nil {
+			exit("invalid proxy URL", err)
+		}
+		opts = append(opts, gems.WithProxy(proxyURL))
+	}
+
+	client, err = gems.NewClient(v, psm, gems.DefaultFormatter{}, opts...)
 	if err != nil {
-		fmt.Printf("failed to initialize client: %s\n", err)
-		os.Exit(1)
+		exit("failed to initialize client", err)
 	}
 
 	if (strings.ToLower(user) != "none") && (strings.ToLower(password) != "none") &&
@@ -73,26 +162,66 @@ func connect(args []string) {
 		err = client.Connect(addr, gems.ConnectionTypeControlAndStatus, token, target)
 	}
 	if err != nil {
-		fmt.Printf("failed to connect to server: %s\n", err)
-		os.Exit(1)
+		exit("failed to connect to server", err)
 	}
-	log.Printf("connected to %s", client.ServerAddr())
+}
+
+// logResponse logs the full content of a response received from the server.
+func logResponse(resp gems.Response) {
+	logger.Info("response", slog.String(gems.LogKeyMessageType, resp.Type().String()), slog.String("content", client.Format(resp)))
 }
 
 func disconnect() {
-	log.Println("disconnecting from server")
+	logger.Info("disconnecting from server")
 	client.Disconnect(gems.DisconnectReasonNormalTermination)
+	if recordFile != nil {
+		recordFile.Close()
+	}
+	if logFile != nil {
+		logFile.Close()
+	}
+}
+
+// printResponse writes resp to stdout in the output format. It exits if
+// resp cannot be formatted, such as when the --format template fails.
+func printResponse(resp gems.Response) {
+	out, err := stdOut.FormatMessage(resp)
+	if err != nil {
+		logger.Error("failed to format response", slog.Any("error", err))
+		disconnect()
+		os.Exit(1)
+	}
+	fmt.Println(out)
 }
 
+// fatal exits after a failed request. A response with a failed result is
+// still written to stdout.
 func fatal(err error) {
-	log.Println(err)
+	var respErr *gems.ResponseError
+	if errors.As(err, &respErr) {
+		printResponse(respErr.Response)
+	}
+	logger.Error("request failed", slog.Any("error", err))
 	disconnect()
 	os.Exit(1)
 }
 
+// exit logs err and exits when the client cannot be set up or connect to
+// the server.
+func exit(msg string, err error) {
+	logger.Error(msg, slog.Any("error", err))
+	if recordFile != nil {
+		recordFile.Close()
+	}
+	if logFile != nil {
+		logFile.Close()
+	}
+	os.Exit(1)
+}
+
+// Execute runs the command line. Cobra writes any error to stderr.
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
 		os.Exit(1)
 	}
 }
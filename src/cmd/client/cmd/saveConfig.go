@@ -1,9 +1,6 @@
 package cmd
 
 import (
-	"fmt"
-	"log"
-
 	"github.com/spf13/cobra"
 )
 
@@ -12,7 +9,7 @@ func init() {
 }
 
 var saveConfigCmd = &cobra.Command{
-	Use:   "save [psm (ascii|xml)] [address (host:port)] [configuration name]",
+	Use:   "save [psm (ascii|xml|xml-tcp|xml-tcp-length)] [address (host:port)] [configuration name]",
 	Short: "Save a device configuration",
 	Long: `Connects to a GEMS server and sends a SaveConfigMessage.
 The SaveConfigMessage saves the configuration as the provided name.
@@ -28,7 +25,7 @@ func saveConfig(cmd *cobra.Command, args []string) {
 	if err != nil {
 		fatal(err)
 	}
-	log.Println(client.Format(resp))
-	fmt.Println(stdOut.Format(resp))
+	logResponse(resp)
+	printResponse(resp)
 	disconnect()
 }
@@ -1,8 +1,6 @@
 package cmd
 
 import (
-	"fmt"
-	"log"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -21,7 +19,7 @@ func init() {
 }
 
 var setConfigCmd = &cobra.Command{
-	Use:   "set [psm (ascii|xml)] [address (host:port)]",
+	Use:   "set [psm (ascii|xml|xml-tcp|xml-tcp-length)] [address (host:port)]",
 	Short: "Set the value of one or more parameters",
 	Long: `Connects to a GEMS server and sends a SetConfigMessage.
 The SetConfigMessage contains a list of parameters to set. New parameter
@@ -46,7 +44,7 @@ func setConfig(cmd *cobra.Command, args []string) {
 	if err != nil {
 		fatal(err)
 	}
-	log.Println(client.Format(resp))
-	fmt.Println(stdOut.Format(resp))
+	logResponse(resp)
+	printResponse(resp)
 	disconnect()
 }
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	gems "github.com/mitre/gems/src"
+	"github.com/mitre/gems/src/gemsV14"
+)
+
+// upstream holds a client connection to the upstream device for each
+// target requested by downstream clients. Connections are opened on first
+// use and reopened after a failure.
+type upstream struct {
+	psm      string
+	addr     string
+	token    string
+	tls      bool
+	insecure bool
+	logger   *slog.Logger
+
+	mu      sync.Mutex
+	targets map[string]*upstreamTarget
+}
+
+// upstreamTarget serializes the messages forwarded to one target, so a
+// slow target does not hold up the others.
+type upstreamTarget struct {
+	mu     sync.Mutex
+	client *gems.Client
+}
+
+func (u *upstream) target(name string) *upstreamTarget {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	t, found := u.targets[name]
+	if !found {
+		t = &upstreamTarget{}
+		u.targets[name] = t
+	}
+	return t
+}
+
+func (u *upstream) connect(target string) (*gems.Client, error) {
+	c, err := gems.NewClient(gemsV14.GemsV14{}, u.psm, gems.DefaultFormatter{}, gems.WithClientLogger(u.logger))
+	if err != nil {
+		return nil, err
+	}
+	if u.tls {
+		err = c.ConnectTLS(u.addr, gems.ConnectionTypeControlAndStatus, u.token, target, u.insecure)
+	} else {
+		err = c.Connect(u.addr, gems.ConnectionTypeControlAndStatus, u.token, target)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Forward sends m to the upstream device and returns its response.
+func (u *upstream) Forward(m gems.Message) (gems.Response, error) {
+	t := u.target(m.Target())
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.client == nil {
+		c, err := u.connect(m.Target())
+		if err != nil {
+			return nil, err
+		}
+		t.client = c
+	}
+
+	resp, err := t.client.Forward(m)
+	if resp == nil {
+		t.client.Disconnect(gems.DisconnectReasonNormalTermination)
+		t.client = nil
+	}
+	return resp, err
+}
+
+func (u *upstream) Close() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for name, t := range u.targets {
+		t.mu.Lock()
+		if t.client != nil {
+			t.client.Disconnect(gems.DisconnectReasonNormalTermination)
+			t.client = nil
+		}
+		t.mu.Unlock()
+		delete(u.targets, name)
+	}
+}
+
+// proxy forwards messages from downstream clients to the upstream device,
+// applying its rules to both the requests and the responses.
+type proxy struct {
+	upstream *upstream
+	rules    []rule
+	logger   *slog.Logger
+}
+
+// apply runs the rules matching m. It returns a nil Message if m is
+// dropped.
+func (p *proxy) apply(m gems.Message, v gems.Version) gems.Message {
+	for _, r := range p.rules {
+		if !r.matches(m) {
+			continue
+		}
+
+		switch r.Action {
+		case logAction:
+			p.logger.Info("matched message", slog.String("rule", r.Name), slog.String(gems.LogKeyMessageType, m.Type().String()),
+				slog.Any("body", m.Body()))
+		case dropAction:
+			p.logger.Info("dropping message", slog.String("rule", r.Name), slog.String(gems.LogKeyMessageType, m.Type().String()))
+			return nil
+		case delayAction:
+			time.Sleep(r.delay)
+		case rewriteAction:
+			rewritten, err := r.rewrite(m, v)
+			if err != nil {
+				p.logger.Warn("rewrite failed", slog.String("rule", r.Name), slog.Any("error", err))
+				continue
+			}
+			p.logger.Info("rewrote message", slog.String("rule", r.Name), slog.String(gems.LogKeyMessageType, m.Type().String()))
+			m = rewritten
+		}
+	}
+	return m
+}
+
+func (p *proxy) Handler(m gems.Message, v gems.Version) (gems.Response, error) {
+	req := p.apply(m, v)
+	if req == nil {
+		return nil, nil
+	}
+
+	resp, err := p.upstream.Forward(req)
+	if resp == nil {
+		return communicationError(m, v, err)
+	}
+
+	if msg := p.apply(resp, v); msg != nil {
+		resp, _ = msg.(gems.Response)
+		return resp, nil
+	}
+	return nil, nil
+}
+
+// communicationError answers m when the upstream device cannot be reached.
+func communicationError(m gems.Message, v gems.Version, err error) (gems.Response, error) {
+	mb := v.NewMessageBuilder().Type(m.Type().ResponseType()).Token(m.Token()).Target(m.Target())
+	if m.TransactionID().Valid {
+		mb.TransactionID(m.TransactionID().Int64)
+	}
+	msg, buildErr := mb.ResultCode(gems.ResultCodeCommunicationError).ResponseDescription(err.Error()).Build()
+	if buildErr != nil {
+		return nil, buildErr
+	}
+	resp, _ := msg.(gems.Response)
+	return resp, nil
+}
+
+func fatal(msg string, err error) {
+	slog.Error(msg, slog.Any("error", err))
+	os.Exit(1)
+}
+
+func main() {
+	if len(os.Args) < 4 {
+		fmt.Printf("usage: %s (xml|ascii|xml-tcp) listen-addr upstream-addr [flags]\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	psm := os.Args[1]
+	listenAddr := os.Args[2]
+	upstreamAddr := os.Args[3]
+
+	flags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	upstreamPSM := flags.String("upstream-psm", psm, "PSM of the upstream device (xml|ascii|xml-tcp|xml-tcp-length), translating messages when it differs from the listening PSM")
+	rulesPath := flags.String("rules", "", "JSON file of rules applied to proxied messages")
+	authToken := flags.String("auth", "", "token required from downstream clients")
+	token := flags.String("token", "", "GEMS authentication token for the upstream device")
+	useTLS := flags.Bool("tls", false, "connect to the upstream device using TLS")
+	insecure := flags.Bool("insecure", false, "allow self-signed upstream certificates")
+	logLevel := flags.String("log-level", "info", "minimum level of log messages (debug|info|warn|error)")
+	logFormat := flags.String("log-format", "text", "format of log messages written to stderr (text|json)")
+	flags.Parse(os.Args[4:])
+
+	logger, err := gems.NewLogger(os.Stderr, *logFormat, *logLevel)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
+	var rules []rule
+	if *rulesPath != "" {
+		if rules, err = loadRules(*rulesPath); err != nil {
+			fatal("failed to load rules", err)
+		}
+	}
+
+	switch *upstreamPSM {
+	case "ascii", "xml", "xml-tcp", "xml-tcp-length":
+	default:
+		fmt.Printf("invalid upstream psm '%s', must be 'ascii', 'xml', 'xml-tcp' or 'xml-tcp-length'\n", *upstreamPSM)
+		os.Exit(1)
+	}
+
+	up := &upstream{
+		psm:      *upstreamPSM,
+		addr:     upstreamAddr,
+		token:    *token,
+		tls:      *useTLS,
+		insecure: *insecure,
+		logger:   logger.With(slog.String("side", "upstream")),
+		targets:  make(map[string]*upstreamTarget),
+	}
+	defer up.Close()
+	p := &proxy{upstream: up, rules: rules, logger: logger}
+
+	opts := []gems.ServerOption{gems.WithLogger(logger.With(slog.String("side", "downstream")))}
+	var server gems.Server
+	switch psm {
+	case "ascii":
+		server = gems.NewASCIIServer(listenAddr, p.Handler, gems.BodyFormatter{}, gemsV14.GemsV14{}, *authToken, opts...)
+	case "xml":
+		server = gems.NewXMLServer(listenAddr, p.Handler, gems.BodyFormatter{}, gemsV14.GemsV14{}, *authToken, opts...)
+	case "xml-tcp":
+		server = gems.NewXMLTCPServer(listenAddr, p.Handler, gems.BodyFormatter{}, gemsV14.GemsV14{}, *authToken, opts...)
+	default:
+		fmt.Printf("invalid psm '%s', must be 'ascii', 'xml' or 'xml-tcp'\n", psm)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	server.Start()
+	logger.Info("proxy listening", slog.String("addr", server.Addr()), slog.String("upstream", upstreamAddr),
+		slog.String("upstream_psm", *upstreamPSM), slog.Int("rules", len(rules)))
+
+	<-ctx.Done()
+	logger.Info("shutting down the proxy")
+	server.Close()
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	gems "github.com/mitre/gems/src"
+	"github.com/mitre/gems/src/gemsV14"
+)
+
+// Rule actions.
+const (
+	logAction     = "log"
+	dropAction    = "drop"
+	delayAction   = "delay"
+	rewriteAction = "rewrite"
+)
+
+// match selects the messages a rule applies to. Empty fields match any
+// message.
+type match struct {
+	// Type is a message type name or ASCII type, e.g. "GetConfigResponse"
+	// or "GET-R".
+	Type string `json:"type,omitempty"`
+	// Parameter requires a parameter, argument or desired parameter with
+	// this name, and Value requires that parameter to have this value in
+	// its ASCII form.
+	Parameter string `json:"parameter,omitempty"`
+	Value     string `json:"value,omitempty"`
+}
+
+// rule is applied to the requests passing from clients to the upstream
+// device and to the responses passing back.
+type rule struct {
+	Name   string `json:"name,omitempty"`
+	Match  match  `json:"match"`
+	Action string `json:"action"`
+
+	// Delay holds a message for a delay action.
+	Delay string `json:"delay,omitempty"`
+	delay time.Duration
+
+	// Parameters replaces the values of the named parameters, and
+	// Directive replaces the directive name, for a rewrite action. Values
+	// are given in the GEMS-ASCII form.
+	Parameters map[string]string `json:"parameters,omitempty"`
+	Directive  string            `json:"directive,omitempty"`
+}
+
+func loadRules(path string) ([]rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid rules: %w", err)
+	}
+
+	for i := range rules {
+		r := &rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("%s-%d", r.Action, i)
+		}
+		if (r.Match.Type != "") && (messageType(r.Match.Type) == gems.UndefinedMessageType) {
+			return nil, fmt.Errorf("rule '%s' has unknown message type '%s'", r.Name, r.Match.Type)
+		}
+
+		switch r.Action {
+		case logAction, dropAction:
+		case delayAction:
+			if r.delay, err = time.ParseDuration(r.Delay); err != nil {
+				return nil, fmt.Errorf("rule '%s': %w", r.Name, err)
+			}
+		case rewriteAction:
+			if (len(r.Parameters) == 0) && (r.Directive == "") {
+				return nil, fmt.Errorf("rule '%s' does not rewrite anything", r.Name)
+			}
+		default:
+			return nil, fmt.Errorf("rule '%s' has unknown action '%s'", r.Name, r.Action)
+		}
+	}
+	return rules, nil
+}
+
+func messageType(name string) gems.MessageType {
+	if t := gems.MessageTypeFromASCII(name); t != gems.UndefinedMessageType {
+		return t
+	}
+	return gems.MessageTypeFromXMLName(xml.Name{Local: name})
+}
+
+func (r rule) matches(m gems.Message) bool {
+	if (r.Match.Type != "") && (messageType(r.Match.Type) != m.Type()) {
+		return false
+	}
+	if r.Match.Parameter == "" {
+		return true
+	}
+
+	for name, value := range messageParameters(m) {
+		if (name == r.Match.Parameter) && ((r.Match.Value == "") || (value == r.Match.Value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// messageParameters returns the ASCII values of the parameters in m by
+// name. Desired parameters have no value.
+func messageParameters(m gems.Message) map[string]string {
+	params := make(map[string]string)
+
+	body := m.Body()
+	for _, field := range []string{"parameters", "arguments", "return_values"} {
+		values, _ := body[field].([]string)
+		for _, p := range values {
+			name, value, _ := parseParameter(p)
+			params[name] = value
+		}
+	}
+	if names, ok := body["desired_parameters"].([]string); ok {
+		for _, name := range names {
+			params[name] = ""
+		}
+	}
+	return params
+}
+
+// parseParameter splits an ASCII parameter "name:type=value" into its
+// name and value.
+func parseParameter(p string) (name string, value string, ok bool) {
+	head, value, ok := strings.Cut(p, "=")
+	name, _, _ = strings.Cut(head, ":")
+	return name, value, ok
+}
+
+// rewrite returns a copy of m with the parameter values and directive
+// name replaced as the rule specifies. Parameters are also replaced
+// inside ParameterSets.
+func (r rule) rewrite(m gems.Message, v gems.Version) (gems.Message, error) {
+	var err error
+	rewritten, rerr := gems.RewriteMessage(m, v, func(c *gems.MessageContent) {
+		c.Parameters, _, err = r.rewriteParameters(c.Parameters, v)
+		if (r.Directive != "") && (c.DirectiveName != "") {
+			c.DirectiveName = r.Directive
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rewritten, rerr
+}
+
+// rewriteParameters returns params with the values of the named
+// parameters replaced, and whether any were replaced.
+func (r rule) rewriteParameters(params []gems.Parameter, v gems.Version) ([]gems.Parameter, bool, error) {
+	rewritten := make([]gems.Parameter, len(params))
+	changed := false
+	for i, p := range params {
+		rewritten[i] = p
+
+		if p.Type() == gems.ParameterSetType {
+			children, err := p.Children()
+			if err != nil {
+				return nil, false, err
+			}
+			children, found, err := r.rewriteParameters(children, v)
+			if err != nil {
+				return nil, false, err
+			}
+			if !found {
+				continue
+			}
+
+			pb := v.NewParameterBuilder().Name(p.Name()).Parameters(children...)
+			// The values of an array ParameterSet are unnamed ParameterSets.
+			if (children[0].Name() == "") && (children[0].Type() == gems.ParameterSetType) {
+				pb = pb.Multiplicity(len(children))
+			}
+			if rewritten[i], err = pb.Build(); err != nil {
+				return nil, false, err
+			}
+			changed = true
+			continue
+		}
+
+		value, found := r.Parameters[p.Name()]
+		if !found {
+			continue
+		}
+		// The name, datatype and multiplicity are kept in their ASCII
+		// form, which is already escaped.
+		head, _, _ := strings.Cut(p.String(), "=")
+		replaced, err := gemsV14.UnmarshalParameterASCII([]byte(head + "=" + value))
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid value '%s' for parameter '%s': %w", value, p.Name(), err)
+		}
+		rewritten[i] = replaced
+		changed = true
+	}
+	return rewritten, changed, nil
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	gems "github.com/mitre/gems/src"
+	"github.com/mitre/gems/src/gemsV14"
+)
+
+var v = gemsV14.GemsV14{}
+
+func build(t *testing.T, mb gems.MessageBuilder) gems.Message {
+	t.Helper()
+
+	m, err := mb.Target("System/Device1").TransactionID(7).Build()
+	if err != nil {
+		t.Fatalf("build error: %s", err)
+	}
+	return m
+}
+
+var loadRulesTests = []struct {
+	Name  string
+	Rules string
+	// Err is a substring of the error, or "" if the rules are valid.
+	Err    string
+	Expect []rule
+}{
+	{
+		Name: "valid",
+		Rules: `[
+			{"match": {"type": "GET-R"}, "action": "log"},
+			{"name": "hold", "match": {"type": "PingMessage"}, "action": "delay", "delay": "250ms"},
+			{"match": {"parameter": "Gain", "value": "3"}, "action": "rewrite", "parameters": {"Gain": "1"}},
+			{"match": {"type": "DIR"}, "action": "rewrite", "directive": "Reset"},
+			{"action": "drop"}
+		]`,
+		Expect: []rule{
+			{Name: "log-0", Match: match{Type: "GET-R"}, Action: logAction},
+			{Name: "hold", Match: match{Type: "PingMessage"}, Action: delayAction, Delay: "250ms", delay: 250 * time.Millisecond},
+			{Name: "rewrite-2", Match: match{Parameter: "Gain", Value: "3"}, Action: rewriteAction, Parameters: map[string]string{"Gain": "1"}},
+			{Name: "rewrite-3", Match: match{Type: "DIR"}, Action: rewriteAction, Directive: "Reset"},
+			{Name: "drop-4", Action: dropAction},
+		},
+	},
+	{Name: "invalid JSON", Rules: `{"action": "drop"}`, Err: "invalid rules"},
+	{Name: "unknown type", Rules: `[{"match": {"type": "BOGUS"}, "action": "drop"}]`, Err: "rule 'drop-0' has unknown message type 'BOGUS'"},
+	{Name: "unknown action", Rules: `[{"name": "x", "action": "mangle"}]`, Err: "rule 'x' has unknown action 'mangle'"},
+	{Name: "invalid delay", Rules: `[{"action": "delay", "delay": "soon"}]`, Err: "rule 'delay-0': "},
+	{Name: "empty rewrite", Rules: `[{"action": "rewrite"}]`, Err: "rule 'rewrite-0' does not rewrite anything"},
+}
+
+func TestLoadRules(t *testing.T) {
+	for _, test := range loadRulesTests {
+		t.Run(test.Name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rules.json")
+			if err := os.WriteFile(path, []byte(test.Rules), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			rules, err := loadRules(path)
+			if test.Err != "" {
+				if (err == nil) || !strings.Contains(err.Error(), test.Err) {
+					t.Errorf("incorrect error: have %v, want %s", err, test.Err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(rules, test.Expect) {
+				t.Errorf("incorrect rules:\nhave %+v\nwant %+v", rules, test.Expect)
+			}
+		})
+	}
+
+	if _, err := loadRules(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+var matchTests = []struct {
+	Name    string
+	Match   match
+	Message gems.MessageBuilder
+	Expect  bool
+}{
+	{Name: "any", Message: v.NewMessageBuilder().Type(gems.PingMessageType), Expect: true},
+	{Name: "ASCII type", Match: match{Type: "GET-R"}, Message: v.NewMessageBuilder().Type(gems.GetConfigResponseType).ResultCode(gems.ResultCodeSuccess), Expect: true},
+	{Name: "XML type", Match: match{Type: "GetConfigResponse"}, Message: v.NewMessageBuilder().Type(gems.GetConfigResponseType).ResultCode(gems.ResultCodeSuccess), Expect: true},
+	{Name: "ASCII type of request", Match: match{Type: "GET-R"}, Message: v.NewMessageBuilder().Type(gems.GetConfigMessageType)},
+	{Name: "XML type of request", Match: match{Type: "GetConfigResponse"}, Message: v.NewMessageBuilder().Type(gems.GetConfigMessageType)},
+	{Name: "parameter", Match: match{Parameter: "Gain"}, Message: v.NewMessageBuilder().Type(gems.SetConfigMessageType).ASCIIParameters("Level:int=2", "Gain:int=3"), Expect: true},
+	{Name: "missing parameter", Match: match{Parameter: "Gain"}, Message: v.NewMessageBuilder().Type(gems.SetConfigMessageType).ASCIIParameters("Level:int=2")},
+	{Name: "parameter value", Match: match{Parameter: "Gain", Value: "3"}, Message: v.NewMessageBuilder().Type(gems.SetConfigMessageType).ASCIIParameters("Gain:int=3"), Expect: true},
+	{Name: "other parameter value", Match: match{Parameter: "Gain", Value: "3"}, Message: v.NewMessageBuilder().Type(gems.SetConfigMessageType).ASCIIParameters("Gain:int=4")},
+	{Name: "value of other parameter", Match: match{Parameter: "Gain", Value: "3"}, Message: v.NewMessageBuilder().Type(gems.SetConfigMessageType).ASCIIParameters("Gain:int=4", "Level:int=3")},
+	{Name: "desired parameter", Match: match{Parameter: "Gain"}, Message: v.NewMessageBuilder().Type(gems.GetConfigMessageType).DesiredParameters("Gain"), Expect: true},
+	{Name: "desired parameter has no value", Match: match{Parameter: "Gain", Value: "3"}, Message: v.NewMessageBuilder().Type(gems.GetConfigMessageType).DesiredParameters("Gain")},
+	{Name: "directive argument", Match: match{Parameter: "Mode", Value: "FAST"}, Message: v.NewMessageBuilder().Type(gems.DirectiveMessageType).Directive("Reboot").ASCIIParameters("Mode:string=FAST"), Expect: true},
+	{Name: "type and parameter", Match: match{Type: "SET", Parameter: "Gain"}, Message: v.NewMessageBuilder().Type(gems.SetConfigMessageType).ASCIIParameters("Gain:int=3"), Expect: true},
+	{Name: "type but not parameter", Match: match{Type: "SET", Parameter: "Gain"}, Message: v.NewMessageBuilder().Type(gems.SetConfigMessageType).ASCIIParameters("Level:int=3")},
+}
+
+func TestRuleMatches(t *testing.T) {
+	for _, test := range matchTests {
+		t.Run(test.Name, func(t *testing.T) {
+			r := rule{Match: test.Match, Action: logAction}
+			if have := r.matches(build(t, test.Message)); have != test.Expect {
+				t.Errorf("incorrect match: have %t, want %t", have, test.Expect)
+			}
+		})
+	}
+}
+
+var rewriteTests = []struct {
+	Name    string
+	Rule    rule
+	Message gems.MessageBuilder
+	Field   string
+	Expect  any
+}{
+	{
+		Name:    "parameter value",
+		Rule:    rule{Parameters: map[string]string{"Gain": "1"}},
+		Message: v.NewMessageBuilder().Type(gems.SetConfigMessageType).ASCIIParameters("Level:int=2", "Gain:int=3"),
+		Field:   "parameters",
+		Expect:  []string{"Level:int=2", "Gain:int=1"},
+	},
+	{
+		Name:    "several parameter values",
+		Rule:    rule{Parameters: map[string]string{"Gain": "1", "Level": "9"}},
+		Message: v.NewMessageBuilder().Type(gems.SetConfigMessageType).ASCIIParameters("Level:int=2", "Gain:int=3"),
+		Field:   "parameters",
+		Expect:  []string{"Level:int=9", "Gain:int=1"},
+	},
+	{
+		Name:    "response parameter value",
+		Rule:    rule{Parameters: map[string]string{"Gain": "1"}},
+		Message: v.NewMessageBuilder().Type(gems.GetConfigResponseType).ResultCode(gems.ResultCodeSuccess).ASCIIParameters("Gain:int=3"),
+		Field:   "parameters",
+		Expect:  []string{"Gain:int=1"},
+	},
+	{
+		Name:    "missing parameter",
+		Rule:    rule{Parameters: map[string]string{"Gain": "1"}},
+		Message: v.NewMessageBuilder().Type(gems.SetConfigMessageType).ASCIIParameters("Level:int=2"),
+		Field:   "parameters",
+		Expect:  []string{"Level:int=2"},
+	},
+	{
+		Name:    "escaped value",
+		Rule:    rule{Parameters: map[string]string{"Mode": "A|B;C"}},
+		Message: v.NewMessageBuilder().Type(gems.DirectiveMessageType).Directive("Reboot").ASCIIParameters("Mode:string=FAST"),
+		Field:   "arguments",
+		Expect:  []string{"Mode:string=A&bB&dC"},
+	},
+	{
+		Name:    "parameter set member",
+		Rule:    rule{Parameters: map[string]string{"Gain": "1"}},
+		Message: v.NewMessageBuilder().Type(gems.SetConfigMessageType).ASCIIParameters("Amp:set_type=Gain:int=3;Mode:string=x;"),
+		Field:   "parameters",
+		Expect:  []string{"Amp:set_type=Gain:int=1;Mode:string=x;"},
+	},
+	{
+		Name:    "parameter set list members",
+		Rule:    rule{Parameters: map[string]string{"Gain": "1"}},
+		Message: v.NewMessageBuilder().Type(gems.SetConfigMessageType).ASCIIParameters("Chans:set_type[2]=Gain:int=3;,Gain:int=4;"),
+		Field:   "parameters",
+		Expect:  []string{"Chans:set_type[2]=Gain:int=1;,Gain:int=1;"},
+	},
+	{
+		Name:    "directive name",
+		Rule:    rule{Directive: "Reset"},
+		Message: v.NewMessageBuilder().Type(gems.DirectiveMessageType).Directive("Reboot").ASCIIParameters("Mode:string=FAST"),
+		Field:   "directive_name",
+		Expect:  "Reset",
+	},
+	{
+		Name:    "directive argument",
+		Rule:    rule{Parameters: map[string]string{"Mode": "SLOW"}},
+		Message: v.NewMessageBuilder().Type(gems.DirectiveMessageType).Directive("Reboot").ASCIIParameters("Mode:string=FAST"),
+		Field:   "arguments",
+		Expect:  []string{"Mode:string=SLOW"},
+	},
+	{
+		Name:    "directive response name",
+		Rule:    rule{Directive: "Reset"},
+		Message: v.NewMessageBuilder().Type(gems.DirectiveResponseType).ResultCode(gems.ResultCodeSuccess).Directive("Reboot"),
+		Field:   "directive_name",
+		Expect:  "Reset",
+	},
+	{
+		Name:    "directive name of other message",
+		Rule:    rule{Directive: "Reset"},
+		Message: v.NewMessageBuilder().Type(gems.SetConfigMessageType).ASCIIParameters("Gain:int=3"),
+		Field:   "parameters",
+		Expect:  []string{"Gain:int=3"},
+	},
+}
+
+func TestRuleRewrite(t *testing.T) {
+	for _, test := range rewriteTests {
+		t.Run(test.Name, func(t *testing.T) {
+			test.Rule.Action = rewriteAction
+			m := build(t, test.Message)
+			rewritten, err := test.Rule.rewrite(m, v)
+			if err != nil {
+				t.Fatalf("rewrite error: %s", err)
+			}
+
+			if have := rewritten.Body()[test.Field]; !reflect.DeepEqual(have, test.Expect) {
+				t.Errorf("incorrect %s: have %#v, want %#v", test.Field, have, test.Expect)
+			}
+			if rewritten.Type() != m.Type() {
+				t.Errorf("incorrect type: have %s, want %s", rewritten.Type(), m.Type())
+			}
+			if (rewritten.Target() != m.Target()) || (rewritten.TransactionID() != m.TransactionID()) {
+				t.Errorf("incorrect header: have %s %v, want %s %v", rewritten.Target(), rewritten.TransactionID(), m.Target(), m.TransactionID())
+			}
+		})
+	}
+}
+
+func TestRuleRewriteInvalidValue(t *testing.T) {
+	r := rule{Name: "bad", Action: rewriteAction, Parameters: map[string]string{"Gain": "x"}}
+	m := build(t, v.NewMessageBuilder().Type(gems.SetConfigMessageType).ASCIIParameters("Gain:int=3"))
+	if _, err := r.rewrite(m, v); (err == nil) || !strings.Contains(err.Error(), "invalid value 'x' for parameter 'Gain'") {
+		t.Errorf("incorrect error: %v", err)
+	}
+}
+
+var applyTests = []struct {
+	Name    string
+	Rules   []rule
+	Message gems.MessageBuilder
+	// Expect is the directive name of the applied message, or "" if it
+	// is dropped.
+	Expect string
+}{
+	{Name: "no rules", Message: v.NewMessageBuilder().Type(gems.DirectiveMessageType).Directive("Reboot"), Expect: "Reboot"},
+	{
+		Name:    "drop",
+		Rules:   []rule{{Name: "drop", Match: match{Type: "DIR"}, Action: dropAction}},
+		Message: v.NewMessageBuilder().Type(gems.DirectiveMessageType).Directive("Reboot"),
+	},
+	{
+		Name:    "drop other type",
+		Rules:   []rule{{Name: "drop", Match: match{Type: "DIR-R"}, Action: dropAction}},
+		Message: v.NewMessageBuilder().Type(gems.DirectiveMessageType).Directive("Reboot"),
+		Expect:  "Reboot",
+	},
+	{
+		Name: "rewrite then drop",
+		Rules: []rule{
+			{Name: "rename", Match: match{Type: "DIR"}, Action: rewriteAction, Directive: "Reset"},
+			{Name: "drop", Match: match{Type: "DirectiveMessage"}, Action: dropAction},
+		},
+		Message: v.NewMessageBuilder().Type(gems.DirectiveMessageType).Directive("Reboot"),
+	},
+	{
+		Name: "rewrite and log",
+		Rules: []rule{
+			{Name: "rename", Match: match{Type: "DIR"}, Action: rewriteAction, Directive: "Reset"},
+			{Name: "log", Action: logAction},
+		},
+		Message: v.NewMessageBuilder().Type(gems.DirectiveMessageType).Directive("Reboot"),
+		Expect:  "Reset",
+	},
+}
+
+func TestProxyApply(t *testing.T) {
+	for _, test := range applyTests {
+		t.Run(test.Name, func(t *testing.T) {
+			p := &proxy{rules: test.Rules, logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+			m := p.apply(build(t, test.Message), v)
+			switch {
+			case (test.Expect == "") && (m != nil):
+				t.Errorf("message was not dropped")
+			case (test.Expect != "") && (m == nil):
+				t.Errorf("message was dropped")
+			case m != nil:
+				if have := m.Body()["directive_name"]; have != test.Expect {
+					t.Errorf("incorrect directive name: have %v, want %s", have, test.Expect)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	gems "github.com/mitre/gems/src"
+	"github.com/mitre/gems/src/gemsV14"
+)
+
+// adminAPI is a REST API for inspecting and changing the state of the
+// virtual devices without speaking GEMS. Parameters are exchanged in the
+// GEMS ASCII form, e.g. "TransmitPower:double=20".
+//
+// Requests for device state select the device with the "target" query
+// parameter, which may be omitted when the server hosts a single device.
+// When token is set every request must carry it as a bearer token.
+type adminAPI struct {
+	server  gems.Server
+	devices map[string]*demoDevice
+	faults  *gems.FaultInjector
+	token   string
+}
+
+func newAdminAPI(server gems.Server, devices []*demoDevice, faults *gems.FaultInjector, token string) *adminAPI {
+	api := &adminAPI{server: server, devices: make(map[string]*demoDevice), faults: faults, token: token}
+	for _, device := range devices {
+		api.devices[device.target] = device
+	}
+	return api
+}
+
+func (api *adminAPI) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /sessions", api.listSessions)
+	mux.HandleFunc("DELETE /sessions/{id}", api.kickSession)
+	mux.HandleFunc("GET /targets", api.listTargets)
+	mux.HandleFunc("GET /parameters", api.getParameters)
+	mux.HandleFunc("GET /parameters/{name}", api.getParameter)
+	mux.HandleFunc("PUT /parameters", api.setParameters)
+	mux.HandleFunc("GET /configs", api.listConfigs)
+	mux.HandleFunc("POST /configs/{name}/load", api.loadConfig)
+	mux.HandleFunc("POST /configs/{name}/save", api.saveConfig)
+	mux.HandleFunc("POST /async", api.pushStatus)
+	mux.HandleFunc("GET /faults", api.listFaults)
+	mux.HandleFunc("POST /faults/enable", api.switchFaults(true))
+	mux.HandleFunc("POST /faults/disable", api.switchFaults(false))
+	mux.HandleFunc("PUT /faults/{name}", api.setFault)
+	mux.HandleFunc("DELETE /faults/{name}", api.removeFault)
+	mux.HandleFunc("POST /faults/{name}/enable", api.switchFault(true))
+	mux.HandleFunc("POST /faults/{name}/disable", api.switchFault(false))
+	return api.authorize(mux)
+}
+
+// authorize rejects requests that do not carry the API token in an
+// "Authorization: Bearer" header.
+func (api *adminAPI) authorize(next http.Handler) http.Handler {
+	if api.token == "" {
+		return next
+	}
+
+	want := []byte("Bearer " + api.token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gems-admin"`)
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid bearer token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serveAdmin starts the admin API listener. It returns the server so the
+// caller can close it on shutdown. The API changes device state and
+// closes sessions, so it refuses to listen beyond the loopback interface
+// without a token.
+func serveAdmin(addr string, api *adminAPI) (*http.Server, error) {
+	if api.token == "" && !isLoopback(addr) {
+		return nil, fmt.Errorf("admin API address '%s' is not a loopback address and requires --admin-token", addr)
+	}
+
+	srv := &http.Server{Addr: addr, Handler: api.Handler(), ReadHeaderTimeout: time.Minute}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fatal(err)
+		}
+	}()
+	return srv, nil
+}
+
+// isLoopback reports whether addr listens only on the loopback interface.
+// An address without a host listens on every interface.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return (ip != nil) && ip.IsLoopback()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func (api *adminAPI) device(w http.ResponseWriter, r *http.Request) (*demoDevice, bool) {
+	target := r.URL.Query().Get("target")
+	device, found := api.devices[target]
+	if !found && target == "" && len(api.devices) == 1 {
+		for _, d := range api.devices {
+			device, found = d, true
+		}
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown target '%s'", target))
+	}
+	return device, found
+}
+
+func parameterStrings(params []gems.Parameter) []string {
+	s := make([]string, len(params))
+	for i, p := range params {
+		s[i] = p.String()
+	}
+	return s
+}
+
+func (api *adminAPI) listSessions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, api.server.Sessions())
+}
+
+func (api *adminAPI) kickSession(w http.ResponseWriter, r *http.Request) {
+	if err := api.server.CloseSession(r.PathValue("id")); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (api *adminAPI) listTargets(w http.ResponseWriter, r *http.Request) {
+	targets := make([]string, 0, len(api.devices))
+	for target := range api.devices {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	writeJSON(w, http.StatusOK, targets)
+}
+
+func (api *adminAPI) getParameters(w http.ResponseWriter, r *http.Request) {
+	device, ok := api.device(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, parameterStrings(device.Parameters()))
+}
+
+func (api *adminAPI) getParameter(w http.ResponseWriter, r *http.Request) {
+	device, ok := api.device(w, r)
+	if !ok {
+		return
+	}
+
+	name := r.PathValue("name")
+	for _, p := range device.Parameters() {
+		if p.Name() == name {
+			writeJSON(w, http.StatusOK, p.String())
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, fmt.Errorf("unknown parameter '%s'", name))
+}
+
+// setParameters writes a JSON list of ASCII parameters to the device,
+// adding any that do not exist yet.
+func (api *adminAPI) setParameters(w http.ResponseWriter, r *http.Request) {
+	device, ok := api.device(w, r)
+	if !ok {
+		return
+	}
+
+	var values []string
+	if err := json.NewDecoder(r.Body).Decode(&values); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("expected a list of parameters: %w", err))
+		return
+	}
+
+	params := make([]gems.Parameter, 0, len(values))
+	for _, v := range values {
+		xp, err := gemsV14.UnmarshalParameterASCII([]byte(v))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid parameter '%s': %w", v, err))
+			return
+		}
+		p, _ := xp.(gems.Parameter)
+		params = append(params, p)
+	}
+
+	if err := device.WriteParameters(params); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, parameterStrings(params))
+}
+
+func (api *adminAPI) listConfigs(w http.ResponseWriter, r *http.Request) {
+	device, ok := api.device(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, device.Configurations())
+}
+
+func (api *adminAPI) loadConfig(w http.ResponseWriter, r *http.Request) {
+	device, ok := api.device(w, r)
+	if !ok {
+		return
+	}
+
+	device.mu.Lock()
+	loaded, err := device.LoadConfig(r.PathValue("name"))
+	device.mu.Unlock()
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"parameters_loaded": loaded})
+}
+
+func (api *adminAPI) saveConfig(w http.ResponseWriter, r *http.Request) {
+	device, ok := api.device(w, r)
+	if !ok {
+		return
+	}
+
+	device.mu.Lock()
+	saved := device.SaveConfig(r.PathValue("name"))
+	device.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]int{"parameters_saved": saved})
+}
+
+// pushStatus sends an AsyncStatusMessage with the current value of the
+// parameters named in the comma separated "names" query parameter, or of
+// every parameter.
+func (api *adminAPI) pushStatus(w http.ResponseWriter, r *http.Request) {
+	device, ok := api.device(w, r)
+	if !ok {
+		return
+	}
+
+	params := device.Parameters()
+	if names := r.URL.Query().Get("names"); names != "" {
+		wanted := make(map[string]bool)
+		for _, name := range strings.Split(names, ",") {
+			wanted[name] = true
+		}
+		selected := params[:0]
+		for _, p := range params {
+			if wanted[p.Name()] {
+				selected = append(selected, p)
+			}
+		}
+		params = selected
+	}
+	if len(params) == 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("no parameters to send"))
+		return
+	}
+
+	if err := device.PublishNow(params); err != nil {
+		writeError(w, http.StatusNotImplemented, err)
+		return
+	}
+	slog.Info("pushed status", slog.String("target", device.target), slog.Int("parameters", len(params)))
+	writeJSON(w, http.StatusOK, parameterStrings(params))
+}
+
+type faultState struct {
+	Enabled bool             `json:"enabled"`
+	Rules   []gems.FaultRule `json:"rules"`
+}
+
+func (api *adminAPI) listFaults(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, faultState{Enabled: api.faults.Enabled(), Rules: api.faults.Rules()})
+}
+
+// switchFaults turns all fault injection on or off.
+func (api *adminAPI) switchFaults(enabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		api.faults.SetEnabled(enabled)
+		slog.Info("switched fault injection", slog.Bool("enabled", enabled))
+		api.listFaults(w, r)
+	}
+}
+
+// setFault adds or replaces the named rule with the JSON rule in the
+// request body.
+func (api *adminAPI) setFault(w http.ResponseWriter, r *http.Request) {
+	var rule gems.FaultRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid fault rule: %w", err))
+		return
+	}
+	rule.Name = r.PathValue("name")
+
+	if err := api.faults.SetRule(rule); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rule)
+}
+
+func (api *adminAPI) removeFault(w http.ResponseWriter, r *http.Request) {
+	if err := api.faults.RemoveRule(r.PathValue("name")); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// switchFault turns the named rule on or off.
+func (api *adminAPI) switchFault(enabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := api.faults.EnableRule(r.PathValue("name"), enabled); err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		api.listFaults(w, r)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gems "github.com/mitre/gems/src"
+	"github.com/mitre/gems/src/gemsV14"
+)
+
+const adminToken = "s3cret"
+
+// adminRoutes lists a request for every admin API route.
+var adminRoutes = []struct {
+	Method string
+	Path   string
+}{
+	{"GET", "/sessions"},
+	{"DELETE", "/sessions/1"},
+	{"GET", "/targets"},
+	{"GET", "/parameters"},
+	{"GET", "/parameters/flag1"},
+	{"PUT", "/parameters"},
+	{"GET", "/configs"},
+	{"POST", "/configs/default/load"},
+	{"POST", "/configs/default/save"},
+	{"POST", "/async"},
+	{"GET", "/faults"},
+	{"POST", "/faults/enable"},
+	{"POST", "/faults/disable"},
+	{"PUT", "/faults/lossy"},
+	{"DELETE", "/faults/lossy"},
+	{"POST", "/faults/lossy/enable"},
+	{"POST", "/faults/lossy/disable"},
+}
+
+// adminTests run in order against one API; later requests see the state
+// left by earlier ones. "{session}" in a path is replaced by the ID of
+// the test client's session.
+var adminTests = []struct {
+	Name   string
+	Method string
+	Path   string
+	Body   string
+	Status int
+	Expect string
+}{
+	{Name: "list sessions", Method: "GET", Path: "/sessions", Status: 200, Expect: `"id":"{session}","psm":"ascii"`},
+	{Name: "list targets", Method: "GET", Path: "/targets", Status: 200, Expect: `["A","B"]`},
+
+	{Name: "parameters", Method: "GET", Path: "/parameters?target=A", Status: 200, Expect: `"flag1:string=REDACTED"`},
+	{Name: "parameters without target", Method: "GET", Path: "/parameters", Status: 404, Expect: `{"error":"unknown target ''"}`},
+	{Name: "parameters of unknown target", Method: "GET", Path: "/parameters?target=Z", Status: 404, Expect: `{"error":"unknown target 'Z'"}`},
+	{Name: "parameter", Method: "GET", Path: "/parameters/flag1?target=A", Status: 200, Expect: `"flag1:string=REDACTED"`},
+	{Name: "unknown parameter", Method: "GET", Path: "/parameters/Gain?target=A", Status: 404, Expect: `{"error":"unknown parameter 'Gain'"}`},
+	{Name: "parameter of unknown target", Method: "GET", Path: "/parameters/flag1?target=Z", Status: 404, Expect: `unknown target 'Z'`},
+
+	{Name: "write parameters", Method: "PUT", Path: "/parameters?target=A", Body: `["Gain:double=3","flag1:string=x"]`, Status: 200, Expect: `["Gain:double=3","flag1:string=x"]`},
+	{Name: "read written parameter", Method: "GET", Path: "/parameters/Gain?target=A", Status: 200, Expect: `"Gain:double=3"`},
+	{Name: "other target unchanged", Method: "GET", Path: "/parameters/Gain?target=B", Status: 404, Expect: `unknown parameter 'Gain'`},
+	{Name: "parameter without type", Method: "PUT", Path: "/parameters?target=A", Body: `["Gain=3"]`, Status: 400, Expect: `invalid parameter 'Gain=3'`},
+	{Name: "parameter with bad value", Method: "PUT", Path: "/parameters?target=A", Body: `["Gain:double=loud"]`, Status: 400, Expect: `invalid parameter 'Gain:double=loud'`},
+	{Name: "parameter with bad type", Method: "PUT", Path: "/parameters?target=A", Body: `["Gain:decimal=3"]`, Status: 400, Expect: `invalid parameter 'Gain:decimal=3'`},
+	{Name: "parameters not a list", Method: "PUT", Path: "/parameters?target=A", Body: `"Gain:double=3"`, Status: 400, Expect: `expected a list of parameters`},
+	{Name: "write parameters to unknown target", Method: "PUT", Path: "/parameters?target=Z", Body: `["Gain:double=3"]`, Status: 404, Expect: `unknown target 'Z'`},
+
+	{Name: "list configs", Method: "GET", Path: "/configs?target=A", Status: 200, Expect: `["c4ot{configuration-flag}","default","secret"]`},
+	{Name: "list configs of unknown target", Method: "GET", Path: "/configs?target=Z", Status: 404, Expect: `unknown target 'Z'`},
+	{Name: "save config", Method: "POST", Path: "/configs/snapshot/save?target=A", Status: 200, Expect: `{"parameters_saved":7}`},
+	{Name: "saved config listed", Method: "GET", Path: "/configs?target=A", Status: 200, Expect: `["c4ot{configuration-flag}","default","secret","snapshot"]`},
+	{Name: "save config of unknown target", Method: "POST", Path: "/configs/snapshot/save?target=Z", Status: 404, Expect: `unknown target 'Z'`},
+	{Name: "load config", Method: "POST", Path: "/configs/secret/load?target=A", Status: 200, Expect: `{"parameters_loaded":6}`},
+	{Name: "loaded parameter", Method: "GET", Path: "/parameters/flag1?target=A", Status: 200, Expect: `"flag1:string=c4ot{parameter-flag}"`},
+	{Name: "load unknown config", Method: "POST", Path: "/configs/factory/load?target=A", Status: 404, Expect: `unknown configuration name 'factory'`},
+	{Name: "load config of unknown target", Method: "POST", Path: "/configs/secret/load?target=Z", Status: 404, Expect: `unknown target 'Z'`},
+
+	{Name: "push status", Method: "POST", Path: "/async?target=A&names=flag1,Directives", Status: 200, Expect: `["Directives:string=fetchFlag3","flag1:string=c4ot{parameter-flag}"]`},
+	{Name: "push unknown parameters", Method: "POST", Path: "/async?target=A&names=Gain", Status: 400, Expect: `no parameters to send`},
+	{Name: "push status of unknown target", Method: "POST", Path: "/async?target=Z", Status: 404, Expect: `unknown target 'Z'`},
+
+	{Name: "list faults", Method: "GET", Path: "/faults", Status: 200, Expect: `{"enabled":true,"rules":[{"name":"slow","fault":"delay","probability":0,"delay":"1s"}]}`},
+	{Name: "disable faults", Method: "POST", Path: "/faults/disable", Status: 200, Expect: `{"enabled":false,`},
+	{Name: "enable faults", Method: "POST", Path: "/faults/enable", Status: 200, Expect: `{"enabled":true,`},
+	{Name: "add fault", Method: "PUT", Path: "/faults/lossy", Body: `{"fault":"drop","message_types":["GET"],"probability":0.5}`, Status: 200, Expect: `{"name":"lossy","fault":"drop","message_types":["GET"],"probability":0.5}`},
+	{Name: "add unknown fault", Method: "PUT", Path: "/faults/broken", Body: `{"fault":"explode","probability":1}`, Status: 400, Expect: `explode`},
+	{Name: "add fault with bad JSON", Method: "PUT", Path: "/faults/broken", Body: `{"fault":`, Status: 400, Expect: `invalid fault rule`},
+	{Name: "disable fault", Method: "POST", Path: "/faults/lossy/disable", Status: 200, Expect: `"probability":0.5,"disabled":true}`},
+	{Name: "enable fault", Method: "POST", Path: "/faults/lossy/enable", Status: 200, Expect: `"probability":0.5}]}`},
+	{Name: "disable unknown fault", Method: "POST", Path: "/faults/broken/disable", Status: 404, Expect: `broken`},
+	{Name: "enable unknown fault", Method: "POST", Path: "/faults/broken/enable", Status: 404, Expect: `broken`},
+	{Name: "remove fault", Method: "DELETE", Path: "/faults/lossy", Status: 204},
+	{Name: "remove unknown fault", Method: "DELETE", Path: "/faults/lossy", Status: 404, Expect: `lossy`},
+
+	{Name: "close session", Method: "DELETE", Path: "/sessions/{session}", Status: 204},
+	{Name: "close unknown session", Method: "DELETE", Path: "/sessions/nope", Status: 404, Expect: `{"error":"unknown session 'nope'"}`},
+}
+
+func newTestAdminAPI(t *testing.T) (*adminAPI, string) {
+	t.Helper()
+
+	devices := []*demoDevice{newDemoDevice("A"), newDemoDevice("B")}
+	server := gems.NewASCIIServer("", devices[0].Handler, gems.BodyFormatter{}, gemsV14.GemsV14{}, "")
+	for _, device := range devices {
+		device.s = server
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+
+	transport, err := gems.NewPipeTransport("ascii", server)
+	if err != nil {
+		t.Fatalf("transport error: %s", err)
+	}
+	client, err := gems.NewClient(gemsV14.GemsV14{}, "ascii", gems.DefaultFormatter{}, gems.WithTransport(transport))
+	if err != nil {
+		t.Fatalf("client error: %s", err)
+	}
+	if err := client.Connect("A", gems.ConnectionTypeControlAndStatus, "", "A"); err != nil {
+		t.Fatalf("connect error: %s", err)
+	}
+
+	sessions := server.Sessions()
+	if len(sessions) != 1 {
+		t.Fatalf("incorrect number of sessions: %d", len(sessions))
+	}
+
+	faults := gems.NewFaultInjector(gems.FaultRule{Name: "slow", Kind: gems.FaultDelay, Delay: time.Second})
+	return newAdminAPI(server, devices, faults, adminToken), sessions[0].ID
+}
+
+func TestAdminAPI(t *testing.T) {
+	api, session := newTestAdminAPI(t)
+	handler := api.Handler()
+
+	for _, test := range adminTests {
+		t.Run(test.Name, func(t *testing.T) {
+			path := strings.ReplaceAll(test.Path, "{session}", session)
+			req := httptest.NewRequest(test.Method, path, strings.NewReader(test.Body))
+			req.Header.Set("Authorization", "Bearer "+adminToken)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != test.Status {
+				t.Errorf("incorrect status: have %d, want %d: %s", rec.Code, test.Status, rec.Body)
+			}
+			expect := strings.ReplaceAll(test.Expect, "{session}", session)
+			if have := strings.TrimSpace(rec.Body.String()); !strings.Contains(have, expect) {
+				t.Errorf("incorrect body:\nhave %s\nwant %s", have, expect)
+			}
+			if rec.Code != http.StatusNoContent && !json.Valid(rec.Body.Bytes()) {
+				t.Errorf("body is not JSON: %s", rec.Body)
+			}
+		})
+	}
+}
+
+func TestAdminAPIUnauthorized(t *testing.T) {
+	api, _ := newTestAdminAPI(t)
+	handler := api.Handler()
+
+	for _, auth := range []string{"", adminToken, "Bearer wrong", "Basic " + adminToken, "Bearer " + adminToken + " "} {
+		for _, route := range adminRoutes {
+			t.Run(route.Method+" "+route.Path+" "+auth, func(t *testing.T) {
+				req := httptest.NewRequest(route.Method, route.Path, strings.NewReader(`[]`))
+				if auth != "" {
+					req.Header.Set("Authorization", auth)
+				}
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+
+				if rec.Code != http.StatusUnauthorized {
+					t.Errorf("incorrect status: have %d, want %d", rec.Code, http.StatusUnauthorized)
+				}
+				if rec.Header().Get("WWW-Authenticate") == "" {
+					t.Error("missing WWW-Authenticate header")
+				}
+			})
+		}
+	}
+
+	if faults := api.faults.Rules(); len(faults) != 1 {
+		t.Errorf("unauthorized requests changed the fault rules: %v", faults)
+	}
+}
+
+var adminAddrTests = []struct {
+	Addr     string
+	Loopback bool
+}{
+	{Addr: "127.0.0.1:8081", Loopback: true},
+	{Addr: "127.10.0.1:8081", Loopback: true},
+	{Addr: "[::1]:8081", Loopback: true},
+	{Addr: "localhost:8081", Loopback: true},
+	{Addr: ":8081", Loopback: false},
+	{Addr: "0.0.0.0:8081", Loopback: false},
+	{Addr: "[::]:8081", Loopback: false},
+	{Addr: "10.0.0.5:8081", Loopback: false},
+	{Addr: "gems.example.com:8081", Loopback: false},
+	{Addr: "127.0.0.1", Loopback: false},
+}
+
+func TestAdminAddr(t *testing.T) {
+	for _, test := range adminAddrTests {
+		t.Run(test.Addr, func(t *testing.T) {
+			if have := isLoopback(test.Addr); have != test.Loopback {
+				t.Errorf("incorrect loopback: have %t, want %t", have, test.Loopback)
+			}
+
+			if test.Loopback {
+				return
+			}
+			srv, err := serveAdmin(test.Addr, &adminAPI{})
+			if err == nil {
+				srv.Close()
+				t.Fatal("expected the admin API to refuse a non-loopback address without a token")
+			}
+			if !strings.Contains(err.Error(), "--admin-token") {
+				t.Errorf("incorrect error: %s", err)
+			}
+		})
+	}
+}
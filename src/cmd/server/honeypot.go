@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"strings"
+
+	gems "github.com/mitre/gems/src"
+	"github.com/mitre/gems/src/gemsV14"
+)
+
+// honeypot wraps a demo device so that every request appears to succeed.
+// Unknown parameters are fabricated on first read and remembered, writes
+// to unknown parameters are accepted, unknown directives succeed and
+// loading an unknown configuration creates it from the current values.
+type honeypot struct {
+	*demoDevice
+}
+
+func (h honeypot) Handler(r gems.Message, v gems.Version) (gems.Response, error) {
+	h.mu.Lock()
+	switch msg := r.(type) {
+	case *gemsV14.GetConfigMessage:
+		for _, name := range msg.DesiredParameters {
+			if _, found := h.params[name]; !found {
+				h.params[name] = fabricateParameter(name)
+			}
+		}
+
+	case *gemsV14.SetConfigMessage:
+		for _, xp := range msg.Parameters {
+			p, _ := xp.(gems.Parameter)
+			if p == nil {
+				continue
+			}
+			if _, found := h.params[p.Name()]; !found {
+				h.params[p.Name()] = p
+			}
+		}
+
+	case *gemsV14.DirectiveMessage:
+		if _, found := h.directives[msg.DirectiveName]; !found {
+			h.directives[msg.DirectiveName] = acknowledgeDirective
+		}
+
+	case *gemsV14.LoadConfigMessage:
+		if _, found := h.configs[msg.ConfigName]; !found {
+			h.SaveConfig(msg.ConfigName)
+		}
+	}
+	h.mu.Unlock()
+
+	return h.demoDevice.Handler(r, v)
+}
+
+func acknowledgeDirective([]gems.Parameter) ([]gems.Parameter, gems.Result) {
+	return []gems.Parameter{}, gems.Result{Code: gems.ResultCodeSuccess}
+}
+
+// fabricateParameter returns a plausible value for an unknown parameter,
+// guessing its type from common words in the name. Values are seeded
+// from the name so the same parameter looks the same on every device.
+func fabricateParameter(name string) gems.Parameter {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	rnd := rand.New(rand.NewSource(int64(h.Sum64())))
+
+	lower := strings.ToLower(name)
+	contains := func(words ...string) bool {
+		for _, w := range words {
+			if strings.Contains(lower, w) {
+				return true
+			}
+		}
+		return false
+	}
+
+	pb := gemsV14.NewParameterBuilder().Name(name)
+	switch {
+	case contains("enable", "lock", "active", "online", "alarm", "fault"):
+		pb = pb.Boolean(rnd.Intn(4) != 0)
+	case contains("temp"):
+		pb = pb.Double(roundTo(25+rnd.Float64()*30, 1))
+	case contains("freq"):
+		pb = pb.Double(roundTo(2200+rnd.Float64()*100, 3))
+	case contains("level", "power", "gain", "snr", "ebn0", "atten"):
+		pb = pb.Double(roundTo(-70+rnd.Float64()*90, 2))
+	case contains("rate", "baud"):
+		pb = pb.Int(1000 * (1 + rnd.Intn(4000)))
+	case contains("count", "errors", "frames", "packets"):
+		pb = pb.Long(rnd.Intn(1000000))
+	case contains("id", "index", "number", "channel", "port"):
+		pb = pb.Int(rnd.Intn(16))
+	case contains("version", "firmware"):
+		pb = pb.String(fmt.Sprintf("%d.%d.%d", 1+rnd.Intn(4), rnd.Intn(10), rnd.Intn(20)))
+	case contains("mode", "state", "status"):
+		states := []string{"NOMINAL", "STANDBY", "ONLINE", "IDLE"}
+		pb = pb.String(states[rnd.Intn(len(states))])
+	default:
+		pb = pb.String(fmt.Sprintf("%s-%02d", name, rnd.Intn(100)))
+	}
+
+	p, _ := pb.Build()
+	return p
+}
+
+func roundTo(f float64, places int) float64 {
+	scale := math.Pow10(places)
+	return math.Round(f*scale) / scale
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	gems "github.com/mitre/gems/src"
+	"github.com/mitre/gems/src/gemsV14"
+)
+
+var honeypotTests = []struct {
+	Name    string
+	Message gems.MessageBuilder
+	Field   string
+	Expect  any
+}{
+	{
+		Name:    "fabricated parameter",
+		Message: gemsV14.GemsV14{}.NewMessageBuilder().Type(gems.GetConfigMessageType).DesiredParameters("RxTemp", "LockStatus"),
+		Field:   "parameters",
+		Expect:  []string{fabricateParameter("RxTemp").String(), fabricateParameter("LockStatus").String()},
+	},
+	{
+		Name:    "fabricated parameter is remembered",
+		Message: gemsV14.GemsV14{}.NewMessageBuilder().Type(gems.GetConfigMessageType).DesiredParameters("RxTemp"),
+		Field:   "parameters",
+		Expect:  []string{fabricateParameter("RxTemp").String()},
+	},
+	{
+		Name:    "write unknown parameter",
+		Message: gemsV14.GemsV14{}.NewMessageBuilder().Type(gems.SetConfigMessageType).ASCIIParameters("Mode:string=MAINT"),
+		Field:   "parameters_set",
+		Expect:  1,
+	},
+	{
+		Name:    "read written parameter",
+		Message: gemsV14.GemsV14{}.NewMessageBuilder().Type(gems.GetConfigMessageType).DesiredParameters("Mode"),
+		Field:   "parameters",
+		Expect:  []string{"Mode:string=MAINT"},
+	},
+	{
+		Name:    "unknown directive",
+		Message: gemsV14.GemsV14{}.NewMessageBuilder().Type(gems.DirectiveMessageType).Directive("selfDestruct"),
+		Field:   "directive_name",
+		Expect:  "selfDestruct",
+	},
+	{
+		Name:    "load unknown configuration",
+		Message: gemsV14.GemsV14{}.NewMessageBuilder().Type(gems.LoadConfigMessageType).ConfigurationName("factory"),
+		Field:   "result_code",
+		Expect:  "SUCCESS",
+	},
+}
+
+func TestHoneypot(t *testing.T) {
+	device := honeypot{newDemoDevice("")}
+
+	for _, test := range honeypotTests {
+		t.Run(test.Name, func(t *testing.T) {
+			msg, err := test.Message.Build()
+			if err != nil {
+				t.Fatalf("build error: %s", err)
+			}
+
+			resp, err := device.Handler(msg, gemsV14.GemsV14{})
+			if err != nil {
+				t.Fatalf("handler error: %s", err)
+			}
+			if resp.Result().Code != gems.ResultCodeSuccess {
+				t.Fatalf("incorrect result: %v", resp.Result())
+			}
+			if have := resp.Body()[test.Field]; !reflect.DeepEqual(have, test.Expect) {
+				t.Errorf("incorrect %s: have %#v, want %#v", test.Field, have, test.Expect)
+			}
+		})
+	}
+
+	if configs := device.Configurations(); !reflect.DeepEqual(configs, []string{"c4ot{configuration-flag}", "default", "factory", "secret"}) {
+		t.Errorf("unknown configuration was not created: %q", configs)
+	}
+}
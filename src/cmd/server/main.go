@@ -2,13 +2,19 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	gems "github.com/mitre/gems/src"
+	"github.com/mitre/gems/src/ascii"
 	"github.com/mitre/gems/src/gemsV14"
 )
 
@@ -37,25 +43,35 @@ var (
 	directivesList, _ = gemsV14.NewParameterBuilder().Name("Directives").String("fetchFlag3").Build()
 )
 
-type demoServer struct {
+type demoDevice struct {
 	s          gems.Server
+	target     string
+	sim        *simulation
 	configs    map[string][]gems.Parameter
 	params     map[string]gems.Parameter
 	directives map[string]gems.DirectiveFunction
+	mu         sync.Mutex
 }
 
-func newDemoServer(psm string, addr string) *demoServer {
-	demo := &demoServer{}
-
+func newServer(psm string, addr string, handler gems.MessageHandler, authToken string, opts ...gems.ServerOption) gems.Server {
 	switch psm {
 	case "ascii":
-		demo.s = gems.NewASCIIServer(addr, demo.Handler, gems.BodyFormatter{}, gemsV14.GemsV14{}, "")
+		return gems.NewASCIIServer(addr, handler, gems.BodyFormatter{}, gemsV14.GemsV14{}, authToken, opts...)
 	case "xml":
-		demo.s = gems.NewXMLServer(addr, demo.Handler, gems.BodyFormatter{}, gemsV14.GemsV14{}, "")
+		return gems.NewXMLServer(addr, handler, gems.BodyFormatter{}, gemsV14.GemsV14{}, authToken, opts...)
+	case "xml-tcp":
+		return gems.NewXMLTCPServer(addr, handler, gems.BodyFormatter{}, gemsV14.GemsV14{}, authToken, opts...)
+	case "combined":
+		return gems.NewCombinedServer(addr, handler, gems.BodyFormatter{}, gemsV14.GemsV14{}, authToken, opts...)
 	default:
-		fmt.Printf("invalid psm '%s', must be 'ascii' or 'xml'\n", psm)
+		fmt.Printf("invalid psm '%s', must be 'ascii', 'xml', 'xml-tcp' or 'combined'\n", psm)
 		os.Exit(1)
 	}
+	return nil
+}
+
+func newDemoDevice(target string) *demoDevice {
+	demo := &demoDevice{target: target}
 
 	demo.configs = map[string][]gems.Parameter{
 		"default":                  {channel0, channel1, channel2, channelList, hiddenFlag1, directivesList},
@@ -69,7 +85,118 @@ func newDemoServer(psm string, addr string) *demoServer {
 	return demo
 }
 
-func (s *demoServer) Handler(r gems.Message, v gems.Version) (gems.Response, error) {
+// Simulate adds the simulated parameters to every configuration and
+// registers the directives that drive step signals.
+func (s *demoDevice) Simulate(sim *simulation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sim = sim
+	params := sim.Parameters()
+	for name := range s.configs {
+		s.configs[name] = append(s.configs[name], params...)
+	}
+	for _, p := range params {
+		s.params[p.Name()] = p
+	}
+	for name, f := range sim.Directives() {
+		s.directives[name] = f
+	}
+}
+
+// Publish updates the current value of the changed parameters and sends
+// them to connected clients in an AsyncStatusMessage.
+func (s *demoDevice) Publish(changed []gems.Parameter) {
+	s.mu.Lock()
+	current := make([]gems.Parameter, 0, len(changed))
+	for _, p := range changed {
+		if _, found := s.params[p.Name()]; found {
+			s.params[p.Name()] = p
+			current = append(current, p)
+		}
+	}
+	s.mu.Unlock()
+
+	if len(current) == 0 {
+		return
+	}
+
+	// The XML PSM cannot push messages, so its clients only see the
+	// updated values when they read them.
+	if _, ok := s.s.(gems.Publisher); !ok {
+		return
+	}
+	if err := s.PublishNow(current); err != nil {
+		slog.Warn("publish failed", slog.String("target", s.target), slog.Any("error", err))
+	}
+}
+
+// PublishNow sends params to connected clients in an AsyncStatusMessage.
+func (s *demoDevice) PublishNow(params []gems.Parameter) error {
+	msg, err := gemsV14.GemsV14{}.NewMessageBuilder().Type(gems.AsyncStatusMessageType).Token(connectedToken).Target(s.target).
+		ResultCode(gems.ResultCodeSuccess).Parameters(params...).Build()
+	if err != nil {
+		return err
+	}
+
+	// GEMS-XML is carried in HTTP request and response bodies, so the XML
+	// server has no channel to push unsolicited messages to a client.
+	publisher, ok := s.s.(gems.Publisher)
+	if !ok {
+		return fmt.Errorf("%s not supported by the server", msg.Type())
+	}
+	return publisher.Publish(msg)
+}
+
+// Parameters returns the current parameters sorted by name.
+func (s *demoDevice) Parameters() []gems.Parameter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	params := make([]gems.Parameter, 0, len(s.params))
+	for _, p := range s.params {
+		params = append(params, p)
+	}
+	sort.Slice(params, func(i, j int) bool {
+		return params[i].Name() < params[j].Name()
+	})
+	return params
+}
+
+// WriteParameters sets the value of params, adding any parameter the
+// device does not have.
+func (s *demoDevice) WriteParameters(params []gems.Parameter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sim != nil {
+		if err := s.sim.Validate(params); err != nil {
+			return err
+		}
+	}
+	for _, p := range params {
+		if s.sim != nil {
+			s.sim.Override(p)
+		}
+		s.params[p.Name()] = p
+	}
+	return nil
+}
+
+// Configurations returns the names of the saved configurations.
+func (s *demoDevice) Configurations() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	configs := make([]string, 0, len(s.configs))
+	for name := range s.configs {
+		configs = append(configs, name)
+	}
+	sort.Strings(configs)
+	return configs
+}
+
+func (s *demoDevice) Handler(r gems.Message, v gems.Version) (gems.Response, error) {
 	mb := v.NewMessageBuilder().Token(connectedToken).ResultCode(gems.ResultCodeSuccess)
 	if r.TransactionID().Valid {
 		mb.TransactionID(r.TransactionID().Int64)
@@ -81,6 +208,9 @@ func (s *demoServer) Handler(r gems.Message, v gems.Version) (gems.Response, err
 		return resp, err
 	}
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	switch r.Type() {
 	case gems.LoadConfigMessageType:
 		mb = mb.Type(gems.LoadConfigResponseType)
@@ -138,7 +268,7 @@ func (s *demoServer) Handler(r gems.Message, v gems.Version) (gems.Response, err
 	return resp, nil
 }
 
-func (s *demoServer) LoadConfig(c string) (int, error) {
+func (s *demoDevice) LoadConfig(c string) (int, error) {
 	params, found := s.configs[c]
 	if !found {
 		return 0, fmt.Errorf("unknown configuration name '%s'", c)
@@ -151,7 +281,7 @@ func (s *demoServer) LoadConfig(c string) (int, error) {
 	return len(params), nil
 }
 
-func (s *demoServer) GetConfig(desired []string) ([]gems.Parameter, gems.Result) {
+func (s *demoDevice) GetConfig(desired []string) ([]gems.Parameter, gems.Result) {
 	var p []gems.Parameter
 
 	switch len(desired) {
@@ -173,7 +303,7 @@ func (s *demoServer) GetConfig(desired []string) ([]gems.Parameter, gems.Result)
 	return p, gems.Result{Code: gems.ResultCodeSuccess}
 }
 
-func (s *demoServer) SetConfig(params []gems.Parameter) (int, gems.Result) {
+func (s *demoDevice) SetConfig(params []gems.Parameter) (int, gems.Result) {
 	for _, p := range params {
 		if _, found := s.params[p.Name()]; !found {
 			result := gems.Result{Code: gems.ResultCodeInvalidParameter, Description: p.Name()}
@@ -181,14 +311,23 @@ func (s *demoServer) SetConfig(params []gems.Parameter) (int, gems.Result) {
 		}
 	}
 
+	if s.sim != nil {
+		if err := s.sim.Validate(params); err != nil {
+			return 0, gems.Result{Code: gems.ResultCodeInvalidRange, Description: err.Error()}
+		}
+	}
+
 	for _, p := range params {
+		if s.sim != nil {
+			s.sim.Override(p)
+		}
 		s.params[p.Name()] = p
 	}
 
 	return len(params), gems.Result{Code: gems.ResultCodeSuccess}
 }
 
-func (s *demoServer) SaveConfig(name string) int {
+func (s *demoDevice) SaveConfig(name string) int {
 	params := make([]gems.Parameter, 0, len(s.params))
 	for _, p := range s.params {
 		params = append(params, p)
@@ -198,7 +337,7 @@ func (s *demoServer) SaveConfig(name string) int {
 	return len(params)
 }
 
-func (s *demoServer) CallDirective(name string, args *gemsV14.Arguments) ([]gems.Parameter, gems.Result) {
+func (s *demoDevice) CallDirective(name string, args *gemsV14.Arguments) ([]gems.Parameter, gems.Result) {
 	var params []gems.Parameter
 	f, found := s.directives[name]
 	if !found {
@@ -223,26 +362,184 @@ func fetchFlag3([]gems.Parameter) ([]gems.Parameter, gems.Result) {
 	return []gems.Parameter{flag3}, result
 }
 
+func fatal(err error) {
+	slog.Error(err.Error())
+	os.Exit(1)
+}
+
 func main() {
 	if len(os.Args) < 3 {
-		fmt.Printf("usage: %s (xml|ascii) addr [--auth]\n", os.Args[0])
+		fmt.Printf("usage: %s (xml|ascii|xml-tcp|combined) addr [flags]\n", os.Args[0])
 		os.Exit(1)
 	}
 
 	psm := os.Args[1]
 	port := os.Args[2]
 
-	server := newDemoServer(psm, port)
+	flags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	authToken := flags.String("auth", "", "token required in ConnectionRequestMessages")
+	targets := flags.String("targets", "", "comma separated list of target devices to host (default: one device accepting any target)")
+	simulate := flags.Bool("sim", false, "simulate telemetry for numeric parameters")
+	simConfig := flags.String("sim-config", "", "JSON file defining the simulated parameters (implies --sim)")
+	tick := flags.Duration("tick", 0, "simulation tick rate (overrides the simulation config)")
+	honeypotLog := flags.String("honeypot", "", "append a JSON-lines log of every connection and message to this file ('-' for stdout)")
+	fakeData := flags.Bool("fake-data", false, "answer requests for unknown parameters, directives and configurations with fabricated data")
+	logLevel := flags.String("log-level", "info", "minimum level of log messages (debug|info|warn|error)")
+	logFormat := flags.String("log-format", "text", "format of log messages written to stderr (text|json)")
+	metricsAddr := flags.String("metrics", "", "serve Prometheus metrics at http://<addr>/metrics")
+	adminAddr := flags.String("admin", "", "serve the admin REST API at http://<addr>/")
+	adminToken := flags.String("admin-token", "", "bearer token required by the admin API (required unless --admin is a loopback address)")
+	faultRules := flags.String("faults", "", "JSON file of fault injection rules")
+	replay := flags.String("replay", "", "answer requests with the responses recorded in a transcript")
+	replayTiming := flags.Bool("replay-timing", false, "delay replayed responses by their recorded latency")
+	maxMessageSize := flags.Int("max-message-size", ascii.DefaultMaxMessageSize, "largest message in bytes accepted by the server")
+	flags.Parse(os.Args[3:])
+
+	logger, err := gems.NewLogger(os.Stderr, *logFormat, *logLevel)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
+	opts := []gems.ServerOption{gems.WithLogger(logger), gems.WithMaxMessageSize(*maxMessageSize)}
+	if *honeypotLog != "" {
+		out := os.Stdout
+		if *honeypotLog != "-" {
+			f, err := os.OpenFile(*honeypotLog, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+			if err != nil {
+				fatal(err)
+			}
+			defer f.Close()
+			out = f
+		}
+		opts = append(opts, gems.WithEventHandler(gems.NewJSONEventWriter(out).Handle))
+		logger.Info("logging events", slog.String("path", *honeypotLog))
+	}
+
+	if *metricsAddr != "" {
+		metrics := gems.NewMetrics()
+		opts = append(opts, gems.WithMetrics(metrics))
+
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", metrics)
+		metricsServer := &http.Server{Addr: *metricsAddr, Handler: mux, ReadHeaderTimeout: time.Minute}
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fatal(err)
+			}
+		}()
+		defer metricsServer.Close()
+		logger.Info("serving metrics", slog.String("addr", *metricsAddr))
+	}
+
+	faults := gems.NewFaultInjector()
+	if *faultRules != "" {
+		data, err := os.ReadFile(*faultRules)
+		if err != nil {
+			fatal(err)
+		}
+		rules, err := gems.ParseFaultRules(data)
+		if err != nil {
+			fatal(err)
+		}
+		faults = gems.NewFaultInjector(rules...)
+		logger.Info("injecting faults", slog.Int("rules", len(rules)))
+	}
+	opts = append(opts, gems.WithFaultInjector(faults))
+
+	var replayer *gems.Replayer
+	if *replay != "" {
+		f, err := os.Open(*replay)
+		if err != nil {
+			fatal(err)
+		}
+		entries, err := gems.ReadTranscript(f)
+		f.Close()
+		if err != nil {
+			fatal(err)
+		}
+		if replayer, err = gems.NewReplayer(entries, gemsV14.GemsV14{}); err != nil {
+			fatal(err)
+		}
+		replayer.Timing = *replayTiming
+		logger.Info("replaying transcript", slog.String("path", *replay), slog.Int("exchanges", replayer.Len()))
+	}
+
+	handler := func(device *demoDevice) gems.MessageHandler {
+		if replayer != nil {
+			return replayer.Handle
+		}
+		if *fakeData {
+			return honeypot{device}.Handler
+		}
+		return device.Handler
+	}
+
+	var (
+		devices []*demoDevice
+		server  gems.Server
+	)
+	switch *targets {
+	case "":
+		device := newDemoDevice("")
+		devices = append(devices, device)
+		server = newServer(psm, port, handler(device), *authToken, opts...)
+	default:
+		router := gems.NewRouter()
+		for _, target := range strings.Split(*targets, ",") {
+			device := newDemoDevice(target)
+			devices = append(devices, device)
+			router.Register(target, handler(device))
+		}
+		server = newServer(psm, port, router.Handle, *authToken, append(opts, gems.WithTargetFilter(router.HasTarget))...)
+		logger.Info("hosting targets", slog.String("targets", strings.Join(router.Targets(), ",")))
+	}
+	for _, device := range devices {
+		device.s = server
+	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
 
-	server.s.Start()
-	log.Printf("server listening at %s", server.s.Addr())
+	if *simulate || *simConfig != "" {
+		cfg := defaultSimulation
+		if *simConfig != "" {
+			var err error
+			if cfg, err = loadSimulationConfig(*simConfig); err != nil {
+				fatal(err)
+			}
+		}
+		if *tick > 0 {
+			cfg.Tick.Duration = *tick
+		}
+
+		for _, device := range devices {
+			sim, err := newSimulation(cfg)
+			if err != nil {
+				fatal(err)
+			}
+			device.Simulate(sim)
+			go sim.Run(ctx, device.Publish)
+		}
+		logger.Info("simulating telemetry", slog.Int("parameters", len(cfg.Signals)), slog.Duration("tick", cfg.Tick.Duration))
+	}
+
+	if *adminAddr != "" {
+		admin, err := serveAdmin(*adminAddr, newAdminAPI(server, devices, faults, *adminToken))
+		if err != nil {
+			fatal(err)
+		}
+		defer admin.Close()
+		logger.Info("serving admin API", slog.String("addr", *adminAddr))
+	}
+
+	server.Start()
+	logger.Info("server listening", slog.String("addr", server.Addr()))
 
 	<-ctx.Done()
-	log.Println("shutting down the server")
+	logger.Info("shutting down the server")
 	_, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	server.s.Close()
+	server.Close()
 }
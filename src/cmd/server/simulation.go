@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	gems "github.com/mitre/gems/src"
+	"github.com/mitre/gems/src/gemsV14"
+)
+
+// Simulation models supported by the engine.
+const (
+	constantModel   = "constant"
+	rampModel       = "ramp"
+	sineModel       = "sine"
+	randomWalkModel = "random_walk"
+	stepModel       = "step"
+	derivedModel    = "derived"
+)
+
+// duration is a time.Duration that is read from JSON as a Go
+// duration string, e.g. "500ms" or "1m".
+type duration struct {
+	time.Duration
+}
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	var err error
+	d.Duration, err = time.ParseDuration(s)
+	return err
+}
+
+// signalSpec describes how a single numeric parameter evolves over time.
+type signalSpec struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Model string `json:"model"`
+
+	// Value is the constant value, the starting value of a ramp or
+	// random walk, the center of a sine wave and the first step level.
+	Value float64 `json:"value"`
+
+	// Rate is the change per second of a ramp.
+	Rate float64 `json:"rate,omitempty"`
+
+	// Amplitude and Period shape a sine wave.
+	Amplitude float64  `json:"amplitude,omitempty"`
+	Period    duration `json:"period,omitempty"`
+
+	// Step is the largest change per tick of a random walk.
+	Step float64 `json:"step,omitempty"`
+
+	// Directive advances a step signal to the next of its Levels.
+	Directive string    `json:"directive,omitempty"`
+	Levels    []float64 `json:"levels,omitempty"`
+
+	// Source, Scale and Offset derive a value from another signal:
+	// Scale * Source + Offset.
+	Source string  `json:"source,omitempty"`
+	Scale  float64 `json:"scale,omitempty"`
+	Offset float64 `json:"offset,omitempty"`
+
+	// Noise adds uniformly distributed noise in [-Noise, Noise].
+	Noise float64 `json:"noise,omitempty"`
+
+	// Min and Max clamp the value. A ramp wraps from Max back to Min.
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+}
+
+type simulationConfig struct {
+	Tick    duration     `json:"tick"`
+	Signals []signalSpec `json:"signals"`
+}
+
+func ptr(f float64) *float64 {
+	return &f
+}
+
+// defaultSimulation drives telemetry for the demo device. TransmitPower
+// is a setpoint, so changing it with a SetConfigMessage visibly changes
+// the derived AmplifierTemp.
+var defaultSimulation = simulationConfig{
+	Tick: duration{time.Second},
+	Signals: []signalSpec{
+		{Name: "SignalLevel", Type: "double", Model: sineModel, Value: -62, Amplitude: 3, Period: duration{time.Minute}, Noise: 0.2},
+		{Name: "TransmitPower", Type: "double", Model: constantModel, Value: 20, Min: ptr(0), Max: ptr(50)},
+		{Name: "AmplifierTemp", Type: "double", Model: derivedModel, Source: "TransmitPower", Scale: 1.5, Offset: 25, Noise: 0.1},
+		{Name: "BitRate", Type: "int", Model: randomWalkModel, Value: 2000000, Step: 5000, Min: ptr(1000000), Max: ptr(4000000)},
+		{Name: "FrameCount", Type: "long", Model: rampModel, Rate: 50, Min: ptr(0), Max: ptr(math.MaxInt32)},
+		{Name: "AntennaElevation", Type: "double", Model: stepModel, Directive: "stepAntenna", Levels: []float64{5, 45, 90}},
+	},
+}
+
+func loadSimulationConfig(path string) (simulationConfig, error) {
+	var cfg simulationConfig
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid simulation config: %w", err)
+	}
+	return cfg, nil
+}
+
+type simSignal struct {
+	spec  signalSpec
+	value float64
+	base  float64
+	level int
+	since time.Time
+}
+
+// simulation updates numeric parameters at a fixed tick rate and reports
+// every parameter whose value changed.
+type simulation struct {
+	tick    time.Duration
+	signals []*simSignal
+	byName  map[string]*simSignal
+	rand    *rand.Rand
+	mu      sync.Mutex
+	// now is the time of the latest update.
+	now time.Time
+}
+
+func newSimulation(cfg simulationConfig) (*simulation, error) {
+	return startSimulation(cfg, rand.NewSource(time.Now().UnixNano()), time.Now())
+}
+
+// startSimulation builds a simulation whose signals start at now and whose
+// noise and random walks are drawn from src.
+func startSimulation(cfg simulationConfig, src rand.Source, now time.Time) (*simulation, error) {
+	sim := &simulation{
+		tick:   cfg.Tick.Duration,
+		byName: make(map[string]*simSignal),
+		rand:   rand.New(src),
+	}
+	if sim.tick <= 0 {
+		sim.tick = time.Second
+	}
+
+	for _, spec := range cfg.Signals {
+		if _, err := buildSignalParameter(spec.Name, spec.Type, spec.Value); err != nil {
+			return nil, fmt.Errorf("signal '%s': %w", spec.Name, err)
+		}
+		if _, found := sim.byName[spec.Name]; found {
+			return nil, fmt.Errorf("signal '%s' defined more than once", spec.Name)
+		}
+
+		switch spec.Model {
+		case constantModel, rampModel, sineModel, randomWalkModel:
+		case stepModel:
+			if len(spec.Levels) == 0 {
+				spec.Levels = []float64{spec.Value}
+			}
+			spec.Value = spec.Levels[0]
+		case derivedModel:
+			if _, found := sim.byName[spec.Source]; !found {
+				return nil, fmt.Errorf("signal '%s' derived from undefined signal '%s'", spec.Name, spec.Source)
+			}
+		default:
+			return nil, fmt.Errorf("signal '%s' has unknown model '%s'", spec.Name, spec.Model)
+		}
+
+		sig := &simSignal{spec: spec, value: spec.Value, base: spec.Value, since: now}
+		sim.signals = append(sim.signals, sig)
+		sim.byName[spec.Name] = sig
+	}
+
+	sim.update(now)
+	return sim, nil
+}
+
+// Parameters returns the current value of every simulated parameter.
+func (sim *simulation) Parameters() []gems.Parameter {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+
+	params := make([]gems.Parameter, 0, len(sim.signals))
+	for _, sig := range sim.signals {
+		params = append(params, sig.parameter())
+	}
+	return params
+}
+
+// Directives returns a DirectiveFunction for each step signal.
+func (sim *simulation) Directives() map[string]gems.DirectiveFunction {
+	directives := make(map[string]gems.DirectiveFunction)
+	for _, sig := range sim.signals {
+		if sig.spec.Model != stepModel || sig.spec.Directive == "" {
+			continue
+		}
+
+		sig := sig
+		directives[sig.spec.Directive] = func([]gems.Parameter) ([]gems.Parameter, gems.Result) {
+			sim.mu.Lock()
+			defer sim.mu.Unlock()
+
+			sig.level = (sig.level + 1) % len(sig.spec.Levels)
+			sig.base = sig.spec.Levels[sig.level]
+			return []gems.Parameter{}, gems.Result{Code: gems.ResultCodeSuccess}
+		}
+	}
+	return directives
+}
+
+// Validate checks that every simulated parameter in params has a single
+// numeric value, without changing the simulation. Callers that override
+// several parameters validate them first so that a bad value leaves none
+// of them changed.
+func (sim *simulation) Validate(params []gems.Parameter) error {
+	for _, p := range params {
+		if _, found := sim.byName[p.Name()]; !found {
+			continue
+		}
+		if _, err := numericValue(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Override sets the value of a simulated parameter, as when a client
+// writes it with a SetConfigMessage. The signal continues to evolve from
+// the new value. Override reports whether p is a simulated parameter.
+func (sim *simulation) Override(p gems.Parameter) (bool, error) {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+
+	sig, found := sim.byName[p.Name()]
+	if !found {
+		return false, nil
+	}
+
+	value, err := numericValue(p)
+	if err != nil {
+		return true, err
+	}
+
+	sig.base = value
+	sig.value = value
+	sig.since = sim.now
+	return true, nil
+}
+
+func numericValue(p gems.Parameter) (float64, error) {
+	values, err := p.Float64s()
+	if (err != nil) || (len(values) != 1) {
+		return 0, fmt.Errorf("'%s' requires a numeric value", p.Name())
+	}
+	return values[0], nil
+}
+
+// Run advances the simulation every tick until ctx is canceled, passing
+// the changed parameters to publish.
+func (sim *simulation) Run(ctx context.Context, publish func([]gems.Parameter)) {
+	ticker := time.NewTicker(sim.tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			sim.mu.Lock()
+			changed := sim.update(now)
+			sim.mu.Unlock()
+
+			if len(changed) > 0 {
+				publish(changed)
+			}
+		}
+	}
+}
+
+func (sim *simulation) update(now time.Time) []gems.Parameter {
+	sim.now = now
+
+	var changed []gems.Parameter
+	for _, sig := range sim.signals {
+		prev := sig.parameter().String()
+
+		elapsed := now.Sub(sig.since).Seconds()
+		switch sig.spec.Model {
+		case constantModel, stepModel:
+			sig.value = sig.base
+		case rampModel:
+			sig.value = sig.base + sig.spec.Rate*elapsed
+			if sig.spec.Max != nil && sig.value > *sig.spec.Max {
+				sig.base = sig.min()
+				sig.since = now
+				sig.value = sig.base
+			}
+		case sineModel:
+			if sig.spec.Period.Duration > 0 {
+				phase := 2 * math.Pi * elapsed / sig.spec.Period.Seconds()
+				sig.value = sig.base + sig.spec.Amplitude*math.Sin(phase)
+			}
+		case randomWalkModel:
+			sig.base += sig.spec.Step * (2*sim.rand.Float64() - 1)
+			sig.base = sig.clamp(sig.base)
+			sig.value = sig.base
+		case derivedModel:
+			src := sim.byName[sig.spec.Source]
+			sig.value = sig.spec.Scale*src.value + sig.spec.Offset
+		}
+
+		if sig.spec.Noise != 0 {
+			sig.value += sig.spec.Noise * (2*sim.rand.Float64() - 1)
+		}
+		sig.value = sig.clamp(sig.value)
+
+		p := sig.parameter()
+		if p.String() != prev {
+			changed = append(changed, p)
+		}
+	}
+	return changed
+}
+
+func (sig *simSignal) min() float64 {
+	if sig.spec.Min == nil {
+		return 0
+	}
+	return *sig.spec.Min
+}
+
+func (sig *simSignal) clamp(v float64) float64 {
+	if sig.spec.Min != nil && v < *sig.spec.Min {
+		v = *sig.spec.Min
+	}
+	if sig.spec.Max != nil && v > *sig.spec.Max {
+		v = *sig.spec.Max
+	}
+	return v
+}
+
+func (sig *simSignal) parameter() gems.Parameter {
+	p, _ := buildSignalParameter(sig.spec.Name, sig.spec.Type, saturate(sig.spec.Type, sig.value))
+	return p
+}
+
+// largestInt and largestUint are the largest float64 values that convert
+// to an int and a uint64. An int has 32 bits on 386 and arm.
+var (
+	largestInt  = min(math.Nextafter(math.MaxInt64, 0), math.MaxInt)
+	largestUint = math.Nextafter(math.MaxUint64, 0)
+)
+
+// signalRanges holds the limits of the integer signal types.
+var signalRanges = map[gems.Datatype][2]float64{
+	gems.ByteType:   {math.MinInt8, math.MaxInt8},
+	gems.UbyteType:  {0, math.MaxUint8},
+	gems.ShortType:  {math.MinInt16, math.MaxInt16},
+	gems.UshortType: {0, math.MaxUint16},
+	gems.IntType:    {math.MinInt32, math.MaxInt32},
+	gems.UintType:   {0, math.MaxUint32},
+	gems.LongType:   {-largestInt, largestInt},
+	gems.UlongType:  {0, largestUint},
+}
+
+// saturate limits a simulated value to the range of its integer type, as a
+// sensor reading saturates at the limits of its register.
+func saturate(typ string, value float64) float64 {
+	limits, found := signalRanges[gems.DatatypeFromASCII(typ)]
+	if !found {
+		return value
+	}
+	return min(max(value, limits[0]), limits[1])
+}
+
+// buildSignalParameter builds the parameter of a signal. Values of the
+// integer types are rounded and must be in the range of the type.
+func buildSignalParameter(name string, typ string, value float64) (gems.Parameter, error) {
+	pb := gemsV14.NewParameterBuilder().Name(name)
+	datatype := gems.DatatypeFromASCII(typ)
+	if datatype == gems.DoubleType {
+		return pb.Double(math.Round(value*1000) / 1000).Build()
+	}
+
+	limits, found := signalRanges[datatype]
+	if !found {
+		return nil, fmt.Errorf("unsupported simulation type '%s'", typ)
+	}
+	rounded := math.Round(value)
+	if !(rounded >= limits[0] && rounded <= limits[1]) {
+		return nil, fmt.Errorf("value %v is out of range for type '%s'", value, typ)
+	}
+
+	switch datatype {
+	case gems.ByteType:
+		pb = pb.Byte(int(rounded))
+	case gems.UbyteType:
+		pb = pb.Ubyte(int(rounded))
+	case gems.ShortType:
+		pb = pb.Short(int(rounded))
+	case gems.UshortType:
+		pb = pb.Ushort(int(rounded))
+	case gems.IntType:
+		pb = pb.Int(int(rounded))
+	case gems.UintType:
+		pb = pb.Uint(uint64(rounded))
+	case gems.LongType:
+		pb = pb.Long(int(rounded))
+	case gems.UlongType:
+		pb = pb.Ulong(uint64(rounded))
+	}
+	return pb.Build()
+}
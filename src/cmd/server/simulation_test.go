@@ -0,0 +1,377 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	gems "github.com/mitre/gems/src"
+	"github.com/mitre/gems/src/gemsV14"
+)
+
+var simulationStart = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// simulationValue returns the current value of the named signal.
+func simulationValue(t *testing.T, sim *simulation, name string) float64 {
+	t.Helper()
+
+	for _, p := range sim.Parameters() {
+		if p.Name() != name {
+			continue
+		}
+		values, err := p.Float64s()
+		if err != nil || len(values) != 1 {
+			t.Fatalf("'%s' is not numeric: %v", name, err)
+		}
+		return values[0]
+	}
+	t.Fatalf("no signal '%s'", name)
+	return 0
+}
+
+func buildParameter(t *testing.T, pb gems.ParameterBuilder) gems.Parameter {
+	t.Helper()
+
+	p, err := pb.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+type simulationStep struct {
+	After   time.Duration
+	Expect  map[string]float64
+	Changed []string
+}
+
+var simulationUpdateTests = []struct {
+	Name    string
+	Signals []signalSpec
+	Steps   []simulationStep
+}{
+	{
+		Name:    "constant",
+		Signals: []signalSpec{{Name: "Power", Type: "double", Model: constantModel, Value: 20}},
+		Steps: []simulationStep{
+			{After: time.Second, Expect: map[string]float64{"Power": 20}},
+			{After: time.Minute, Expect: map[string]float64{"Power": 20}},
+		},
+	},
+	{
+		Name:    "ramp wraps at max",
+		Signals: []signalSpec{{Name: "Frames", Type: "long", Model: rampModel, Rate: 50, Min: ptr(0), Max: ptr(120)}},
+		Steps: []simulationStep{
+			{After: time.Second, Expect: map[string]float64{"Frames": 50}, Changed: []string{"Frames"}},
+			{After: 2 * time.Second, Expect: map[string]float64{"Frames": 100}, Changed: []string{"Frames"}},
+			{After: 3 * time.Second, Expect: map[string]float64{"Frames": 0}, Changed: []string{"Frames"}},
+			{After: 4 * time.Second, Expect: map[string]float64{"Frames": 50}, Changed: []string{"Frames"}},
+		},
+	},
+	{
+		Name:    "sine",
+		Signals: []signalSpec{{Name: "Level", Type: "double", Model: sineModel, Value: -62, Amplitude: 3, Period: duration{4 * time.Second}}},
+		Steps: []simulationStep{
+			{After: time.Second, Expect: map[string]float64{"Level": -59}, Changed: []string{"Level"}},
+			{After: 2 * time.Second, Expect: map[string]float64{"Level": -62}, Changed: []string{"Level"}},
+			{After: 3 * time.Second, Expect: map[string]float64{"Level": -65}, Changed: []string{"Level"}},
+			{After: 4 * time.Second, Expect: map[string]float64{"Level": -62}, Changed: []string{"Level"}},
+		},
+	},
+	{
+		Name: "derived",
+		Signals: []signalSpec{
+			{Name: "Power", Type: "double", Model: rampModel, Value: 20, Rate: 2},
+			{Name: "Temp", Type: "double", Model: derivedModel, Source: "Power", Scale: 1.5, Offset: 25},
+		},
+		Steps: []simulationStep{
+			{After: 0, Expect: map[string]float64{"Power": 20, "Temp": 55}},
+			{After: 5 * time.Second, Expect: map[string]float64{"Power": 30, "Temp": 70}, Changed: []string{"Power", "Temp"}},
+		},
+	},
+	{
+		Name: "clamp and saturate",
+		Signals: []signalSpec{
+			{Name: "Power", Type: "double", Model: constantModel, Value: 100, Min: ptr(0), Max: ptr(50)},
+			{Name: "Gain", Type: "byte", Model: rampModel, Value: 120, Rate: 10},
+			{Name: "Count", Type: "ubyte", Model: rampModel, Value: 0, Rate: -5},
+		},
+		Steps: []simulationStep{
+			{After: time.Second, Expect: map[string]float64{"Power": 50, "Gain": 127, "Count": 0}, Changed: []string{"Gain"}},
+		},
+	},
+}
+
+func TestSimulationUpdate(t *testing.T) {
+	for _, test := range simulationUpdateTests {
+		t.Run(test.Name, func(t *testing.T) {
+			sim, err := startSimulation(simulationConfig{Signals: test.Signals}, rand.NewSource(1), simulationStart)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, step := range test.Steps {
+				var changed []string
+				for _, p := range sim.update(simulationStart.Add(step.After)) {
+					changed = append(changed, p.Name())
+				}
+				if !reflect.DeepEqual(changed, step.Changed) {
+					t.Errorf("%v: incorrect changed parameters: have %v, want %v", step.After, changed, step.Changed)
+				}
+
+				for name, want := range step.Expect {
+					if have := simulationValue(t, sim, name); have != want {
+						t.Errorf("%v: incorrect value of '%s': have %v, want %v", step.After, name, have, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSimulationRandomWalk(t *testing.T) {
+	cfg := simulationConfig{Signals: []signalSpec{
+		{Name: "BitRate", Type: "int", Model: randomWalkModel, Value: 2000, Step: 50, Min: ptr(1950), Max: ptr(2100)},
+		{Name: "Level", Type: "double", Model: constantModel, Value: -62, Noise: 0.5},
+	}}
+
+	first, err := startSimulation(cfg, rand.NewSource(7), simulationStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := startSimulation(cfg, rand.NewSource(7), simulationStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prev := simulationValue(t, first, "BitRate")
+	for i := 1; i <= 100; i++ {
+		now := simulationStart.Add(time.Duration(i) * time.Second)
+		first.update(now)
+		second.update(now)
+
+		if !reflect.DeepEqual(first.Parameters(), second.Parameters()) {
+			t.Fatalf("tick %d: simulations with the same seed diverged", i)
+		}
+
+		rate := simulationValue(t, first, "BitRate")
+		if rate < 1950 || rate > 2100 {
+			t.Errorf("tick %d: BitRate %v outside [1950, 2100]", i, rate)
+		}
+		// The integer value is rounded, so it can move by one more than
+		// the step.
+		if rate-prev > 51 || prev-rate > 51 {
+			t.Errorf("tick %d: BitRate moved from %v to %v", i, prev, rate)
+		}
+		prev = rate
+
+		if level := simulationValue(t, first, "Level"); level < -62.5 || level > -61.5 {
+			t.Errorf("tick %d: Level %v outside noise range", i, level)
+		}
+	}
+}
+
+func TestSimulationStepDirective(t *testing.T) {
+	cfg := simulationConfig{Signals: []signalSpec{
+		{Name: "Elevation", Type: "double", Model: stepModel, Directive: "stepAntenna", Levels: []float64{5, 45, 90}},
+	}}
+	sim, err := startSimulation(cfg, rand.NewSource(1), simulationStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step := sim.Directives()["stepAntenna"]
+	if step == nil {
+		t.Fatal("no directive 'stepAntenna'")
+	}
+
+	for i, want := range []float64{5, 45, 90, 5} {
+		if i > 0 {
+			if _, result := step(nil); result.Code != gems.ResultCodeSuccess {
+				t.Fatalf("incorrect result code: %s", result.Code)
+			}
+		}
+		sim.update(simulationStart.Add(time.Duration(i) * time.Second))
+		if have := simulationValue(t, sim, "Elevation"); have != want {
+			t.Errorf("level %d: have %v, want %v", i, have, want)
+		}
+	}
+}
+
+var simulationOverrideTests = []struct {
+	Name      string
+	Parameter gems.ParameterBuilder
+	Simulated bool
+	Err       string
+	Expect    float64
+}{
+	{
+		Name:      "double",
+		Parameter: gemsV14.NewParameterBuilder().Name("Power").Double(35.5),
+		Simulated: true,
+		Expect:    35.5,
+	},
+	{
+		Name:      "integer",
+		Parameter: gemsV14.NewParameterBuilder().Name("Power").Int(42),
+		Simulated: true,
+		Expect:    42,
+	},
+	{
+		Name:      "clamped",
+		Parameter: gemsV14.NewParameterBuilder().Name("Power").Double(80),
+		Simulated: true,
+		Expect:    50,
+	},
+	{
+		Name:      "string",
+		Parameter: gemsV14.NewParameterBuilder().Name("Power").String("high"),
+		Simulated: true,
+		Err:       "'Power' requires a numeric value",
+		Expect:    20,
+	},
+	{
+		Name:      "array",
+		Parameter: gemsV14.NewParameterBuilder().Name("Power").Multiplicity(2).Double(30, 40),
+		Simulated: true,
+		Err:       "'Power' requires a numeric value",
+		Expect:    20,
+	},
+	{
+		Name:      "not simulated",
+		Parameter: gemsV14.NewParameterBuilder().Name("Channel0").String("on"),
+		Expect:    20,
+	},
+}
+
+func TestSimulationOverride(t *testing.T) {
+	cfg := simulationConfig{Signals: []signalSpec{
+		{Name: "Power", Type: "double", Model: constantModel, Value: 20, Min: ptr(0), Max: ptr(50)},
+	}}
+
+	for _, test := range simulationOverrideTests {
+		t.Run(test.Name, func(t *testing.T) {
+			sim, err := startSimulation(cfg, rand.NewSource(1), simulationStart)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			simulated, err := sim.Override(buildParameter(t, test.Parameter))
+			if simulated != test.Simulated {
+				t.Errorf("incorrect simulated: have %t, want %t", simulated, test.Simulated)
+			}
+			switch {
+			case test.Err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case test.Err != "" && (err == nil || err.Error() != test.Err):
+				t.Errorf("incorrect error: have %v, want %s", err, test.Err)
+			}
+
+			// The signal evolves from the overridden value.
+			sim.update(simulationStart.Add(time.Second))
+			if have := simulationValue(t, sim, "Power"); have != test.Expect {
+				t.Errorf("incorrect value: have %v, want %v", have, test.Expect)
+			}
+		})
+	}
+}
+
+func TestSimulationOverrideRamp(t *testing.T) {
+	cfg := simulationConfig{Signals: []signalSpec{
+		{Name: "Uptime", Type: "long", Model: rampModel, Rate: 1},
+	}}
+	sim, err := startSimulation(cfg, rand.NewSource(1), simulationStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The ramp restarts from the overridden value at the time of the
+	// latest update, not at the wall-clock time.
+	sim.update(simulationStart.Add(5 * time.Second))
+	if _, err := sim.Override(buildParameter(t, gemsV14.NewParameterBuilder().Name("Uptime").Long(100))); err != nil {
+		t.Fatal(err)
+	}
+	sim.update(simulationStart.Add(7 * time.Second))
+	if have := simulationValue(t, sim, "Uptime"); have != 102 {
+		t.Errorf("incorrect value: have %v, want 102", have)
+	}
+}
+
+var signalParameterTests = []struct {
+	Type   string
+	Value  float64
+	Expect string
+	Err    string
+}{
+	{Type: "double", Value: 1.23456, Expect: "Value:double=1.235"},
+	{Type: "byte", Value: 126.6, Expect: "Value:byte=127"},
+	{Type: "byte", Value: 128, Err: "value 128 is out of range for type 'byte'"},
+	{Type: "ubyte", Value: -0.4, Expect: "Value:ubyte=0"},
+	{Type: "uint", Value: math.MaxUint32, Expect: "Value:uint=4294967295"},
+	{Type: "uint", Value: -1, Err: "value -1 is out of range for type 'uint'"},
+	{Type: "long", Value: -2000000, Expect: "Value:long=-2000000"},
+	{Type: "long", Value: 1e19, Err: "value 1e+19 is out of range for type 'long'"},
+	{Type: "ulong", Value: 1e19, Expect: "Value:ulong=10000000000000000000"},
+	{Type: "ulong", Value: -1, Err: "value -1 is out of range for type 'ulong'"},
+	{Type: "ulong", Value: math.NaN(), Err: "value NaN is out of range for type 'ulong'"},
+	{Type: "string", Value: 1, Err: "unsupported simulation type 'string'"},
+}
+
+func TestBuildSignalParameter(t *testing.T) {
+	for _, test := range signalParameterTests {
+		t.Run(fmt.Sprintf("%s %v", test.Type, test.Value), func(t *testing.T) {
+			p, err := buildSignalParameter("Value", test.Type, test.Value)
+			switch {
+			case test.Err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case test.Err != "":
+				if err == nil || err.Error() != test.Err {
+					t.Errorf("incorrect error: have %v, want %s", err, test.Err)
+				}
+				return
+			}
+			if p.String() != test.Expect {
+				t.Errorf("incorrect parameter: have %s, want %s", p, test.Expect)
+			}
+		})
+	}
+}
+
+func TestSetConfigValidatesBeforeOverriding(t *testing.T) {
+	cfg := simulationConfig{Signals: []signalSpec{
+		{Name: "Power", Type: "double", Model: constantModel, Value: 20},
+		{Name: "BitRate", Type: "int", Model: constantModel, Value: 2000},
+	}}
+	sim, err := startSimulation(cfg, rand.NewSource(1), simulationStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	device := newDemoDevice("")
+	device.Simulate(sim)
+
+	params := []gems.Parameter{
+		buildParameter(t, gemsV14.NewParameterBuilder().Name("Power").Double(30)),
+		buildParameter(t, gemsV14.NewParameterBuilder().Name("BitRate").String("fast")),
+	}
+
+	set, result := device.SetConfig(params)
+	if set != 0 || result.Code != gems.ResultCodeInvalidRange {
+		t.Fatalf("incorrect result: have %d %s, want 0 %s", set, result.Code, gems.ResultCodeInvalidRange)
+	}
+	if err := device.WriteParameters(params); err == nil {
+		t.Fatal("expected an error writing a non-numeric value")
+	}
+
+	sim.update(simulationStart.Add(time.Second))
+	if have := simulationValue(t, sim, "Power"); have != 20 {
+		t.Errorf("simulation was overridden: have %v, want 20", have)
+	}
+	for _, p := range device.Parameters() {
+		if values, _ := p.Float64s(); p.Name() == "Power" && (len(values) != 1 || values[0] != 20) {
+			t.Errorf("device parameter was set: %s", p)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package gems
+
+import (
+	"bufio"
+	"bytes"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// sniffTimeout limits how long a server waits for the first bytes of a
+// connection to identify its protocol.
+const sniffTimeout = 30 * time.Second
+
+var asciiPrefix = []byte("|GEMS")
+
+var httpMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace,
+}
+
+// isHTTPMethod reports whether prefix is the start of an HTTP request line.
+func isHTTPMethod(prefix []byte) bool {
+	for _, method := range httpMethods {
+		line := []byte(method + " ")
+		n := min(len(line), len(prefix))
+		if bytes.Equal(prefix[:n], line[:n]) {
+			return true
+		}
+	}
+	return false
+}
+
+// peekedConn is a connection whose first bytes have been read into r to
+// identify its protocol.
+type peekedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *peekedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// NetConn returns the underlying connection.
+func (c *peekedConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// connListener is a net.Listener for connections accepted elsewhere and
+// handed over with push.
+type connListener struct {
+	addr  net.Addr
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newConnListener(addr net.Addr) *connListener {
+	return &connListener{addr: addr, conns: make(chan net.Conn), done: make(chan struct{})}
+}
+
+func (l *connListener) push(conn net.Conn) bool {
+	select {
+	case l.conns <- conn:
+		return true
+	case <-l.done:
+		return false
+	}
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *connListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.addr
+}
+
+type combinedServer struct {
+	ascii    *streamServer
+	xml      *xmlServer
+	listener net.Listener
+	http     *connListener
+	logger   *slog.Logger
+	address  string
+
+	wg       sync.WaitGroup
+	shutdown chan struct{}
+}
+
+// NewCombinedServer serves the GEMS-ASCII and GEMS-XML PSMs on a single
+// port. The PSM of each connection is chosen from its first bytes: "|GEMS"
+// starts a GEMS-ASCII connection and an HTTP method a GEMS-XML one. Both
+// PSMs share the handler and the sessions of the server.
+func NewCombinedServer(addr string, handler MessageHandler, f MessageFormatter, v Version, authToken string, opts ...ServerOption) Server {
+	o := newServerOptions(opts)
+	l, err := listen(addr)
+	if err != nil {
+		fatal(o.logger, "failed to start listener", err)
+	}
+
+	asciiCore := newServerCore("ascii", handler, f, v, authToken, o)
+	xmlCore := newServerCore("xml", handler, f, v, authToken, o)
+	xmlCore.sessions = asciiCore.sessions
+
+	httpConns := newConnListener(l.Addr())
+	return &combinedServer{
+		ascii:    newStreamServer(l, asciiCore, asciiFraming),
+		xml:      newXMLServer(httpConns, xmlCore),
+		listener: l,
+		http:     httpConns,
+		logger:   o.logger.With(slog.String("psm", "combined")),
+		shutdown: make(chan struct{}),
+	}
+}
+
+func (s *combinedServer) Addr() string {
+	return s.address
+}
+
+func (s *combinedServer) Start() {
+	if s.address != "" {
+		return
+	}
+
+	s.address = s.listener.Addr().String()
+	s.xml.Start()
+	s.wg.Add(1)
+	go s.acceptConnections()
+}
+
+func (s *combinedServer) acceptConnections() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.shutdown:
+				return
+			default:
+				s.logger.Warn("accept failed", slog.Any("error", err))
+				continue
+			}
+		}
+		go s.route(conn)
+	}
+}
+
+// route passes conn to the server for the PSM identified by its first
+// bytes.
+func (s *combinedServer) route(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(sniffTimeout))
+	prefix, err := r.Peek(len(asciiPrefix))
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		s.logger.Debug("connection closed before identifying its psm", slog.String(LogKeyRemoteAddr, conn.RemoteAddr().String()),
+			slog.Any("error", err))
+		conn.Close()
+		return
+	}
+
+	peeked := &peekedConn{Conn: conn, r: r}
+	switch {
+	case bytes.Equal(prefix, asciiPrefix):
+		s.ascii.handlerWrapper(peeked)
+	case isHTTPMethod(prefix):
+		if !s.http.push(peeked) {
+			conn.Close()
+		}
+	default:
+		s.logger.Warn("unrecognized protocol", slog.String(LogKeyRemoteAddr, conn.RemoteAddr().String()),
+			slog.String("prefix", string(prefix)))
+		conn.Close()
+	}
+}
+
+func (s *combinedServer) ServeConn(conn net.Conn) {
+	go s.route(conn)
+}
+
+func (s *combinedServer) Sessions() []SessionInfo {
+	return s.ascii.Sessions()
+}
+
+func (s *combinedServer) CloseSession(id string) error {
+	return s.ascii.CloseSession(id)
+}
+
+// Publish sends an unsolicited message to the GEMS-ASCII clients connected
+// to the target of the message. GEMS-XML clients cannot receive unsolicited
+// messages.
+func (s *combinedServer) Publish(msg Message) error {
+	return s.ascii.Publish(msg)
+}
+
+func (s *combinedServer) Close() {
+	close(s.shutdown)
+	s.listener.Close()
+	s.xml.Close()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return
+	case <-time.After(time.Second):
+		s.logger.Warn("shutdown timed out")
+		return
+	}
+}
@@ -0,0 +1,85 @@
+package gems
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors for the result codes of failed responses. A *ResponseError
+// matches the error for its result code, so that callers can test for a
+// result with errors.Is:
+//
+//	if errors.Is(err, gems.ErrInvalidParameter) { ... }
+var (
+	ErrInvalidRange         = errors.New("gems: invalid range")
+	ErrInvalidParameter     = errors.New("gems: invalid parameter")
+	ErrInvalidState         = errors.New("gems: invalid state")
+	ErrInvalidVersion       = errors.New("gems: invalid version")
+	ErrInvalidTarget        = errors.New("gems: invalid target")
+	ErrConflictingParameter = errors.New("gems: conflicting parameter")
+	ErrConflictingValues    = errors.New("gems: conflicting values")
+	ErrUnsupportedMessage   = errors.New("gems: unsupported message")
+	ErrMalformedMessage     = errors.New("gems: malformed message")
+	ErrCommunicationError   = errors.New("gems: communication error")
+	ErrInternalError        = errors.New("gems: internal error")
+	ErrAccessDenied         = errors.New("gems: access denied")
+	ErrOther                = errors.New("gems: other error")
+)
+
+// ErrMessageTooLarge is returned when a GEMS-XML message received over
+// HTTP is longer than the limit set with WithMaxMessageSize or
+// WithClientMaxMessageSize.
+var ErrMessageTooLarge = errors.New("gems: message too large")
+
+var resultCodeErrors = map[ResultCode]error{
+	ResultCodeInvalidRange:         ErrInvalidRange,
+	ResultCodeInvalidParameter:     ErrInvalidParameter,
+	ResultCodeInvalidState:         ErrInvalidState,
+	ResultCodeInvalidVersion:       ErrInvalidVersion,
+	ResultCodeInvalidTarget:        ErrInvalidTarget,
+	ResultCodeConflictingParameter: ErrConflictingParameter,
+	ResultCodeConflictingValues:    ErrConflictingValues,
+	ResultCodeUnsupportedMessage:   ErrUnsupportedMessage,
+	ResultCodeMalformedMessage:     ErrMalformedMessage,
+	ResultCodeCommunicationError:   ErrCommunicationError,
+	ResultCodeInternalError:        ErrInternalError,
+	ResultCodeAccessDenied:         ErrAccessDenied,
+	ResultCodeOther:                ErrOther,
+}
+
+// Err returns the error for a result code, or nil for SUCCESS. Codes not
+// defined by GEMS are reported as ErrOther.
+func (c ResultCode) Err() error {
+	if c == ResultCodeSuccess {
+		return nil
+	}
+	if err, ok := resultCodeErrors[c]; ok {
+		return err
+	}
+	return ErrOther
+}
+
+// ResponseError is returned by a Client when a device answers a request
+// with a result other than SUCCESS. The response is returned along with
+// the error.
+type ResponseError struct {
+	Result   Result
+	Response Response
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("gems response: %s", e.Result)
+}
+
+// Unwrap returns the error for the result code.
+func (e *ResponseError) Unwrap() error {
+	return e.Result.Code.Err()
+}
+
+// checkResponse returns a *ResponseError for a response that failed.
+func checkResponse(resp Response) error {
+	if (resp == nil) || (resp.Result().Code == ResultCodeSuccess) {
+		return nil
+	}
+	return &ResponseError{Result: resp.Result(), Response: resp}
+}
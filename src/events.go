@@ -0,0 +1,150 @@
+package gems
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// EventType identifies an action observed by a GEMS server.
+type EventType string
+
+const (
+	EventConnectionOpened EventType = "connection_opened"
+	EventConnectionClosed EventType = "connection_closed"
+	EventConnect          EventType = "connect"
+	EventDisconnect       EventType = "disconnect"
+	EventParameterRead    EventType = "parameter_read"
+	EventParameterWrite   EventType = "parameter_write"
+	EventDirective        EventType = "directive"
+	EventConfiguration    EventType = "configuration"
+	EventMessage          EventType = "message"
+	EventMalformed        EventType = "malformed_message"
+)
+
+// Event describes a connection or message observed by a GEMS server.
+type Event struct {
+	Time       time.Time
+	Type       EventType
+	PSM        string
+	RemoteAddr string
+	SessionID  string
+
+	// Message is the decoded request and Response the reply sent to
+	// the client, if any.
+	Message  Message
+	Response Response
+
+	// Data holds the raw bytes of a malformed message.
+	Data []byte
+	Err  error
+}
+
+// EventHandler receives the events observed by a server. It is called
+// from the goroutine serving the client and must be safe for concurrent use.
+type EventHandler func(Event)
+
+// WithEventHandler passes every connection and message event observed
+// by the server to h.
+func WithEventHandler(h EventHandler) ServerOption {
+	return func(o *serverOptions) {
+		o.events = h
+	}
+}
+
+func messageEventType(t MessageType) EventType {
+	switch t {
+	case ConnectMessageType:
+		return EventConnect
+	case DisconnectMessageType:
+		return EventDisconnect
+	case GetConfigMessageType:
+		return EventParameterRead
+	case SetConfigMessageType:
+		return EventParameterWrite
+	case DirectiveMessageType:
+		return EventDirective
+	case GetConfigListMessageType, LoadConfigMessageType, SaveConfigMessageType:
+		return EventConfiguration
+	default:
+		return EventMessage
+	}
+}
+
+// JSONEventWriter writes server events as JSON lines, one object per event.
+type JSONEventWriter struct {
+	enc *json.Encoder
+	mu  sync.Mutex
+}
+
+func NewJSONEventWriter(w io.Writer) *JSONEventWriter {
+	return &JSONEventWriter{enc: json.NewEncoder(w)}
+}
+
+type jsonEvent struct {
+	Time       time.Time    `json:"time"`
+	Event      EventType    `json:"event"`
+	PSM        string       `json:"psm"`
+	RemoteAddr string       `json:"remote_addr"`
+	SessionID  string       `json:"session_id"`
+	Token      *string      `json:"token,omitempty"`
+	Message    *jsonMessage `json:"message,omitempty"`
+	Response   *jsonMessage `json:"response,omitempty"`
+	Data       string       `json:"data,omitempty"`
+	Error      string       `json:"error,omitempty"`
+}
+
+type jsonMessage struct {
+	Type          string         `json:"type"`
+	Version       string         `json:"gems_version"`
+	TransactionID *int64         `json:"transaction_id,omitempty"`
+	Token         string         `json:"token"`
+	Target        string         `json:"target"`
+	Body          map[string]any `json:"body,omitempty"`
+}
+
+func newJSONMessage(m Message) *jsonMessage {
+	if m == nil {
+		return nil
+	}
+
+	jm := &jsonMessage{
+		Type:    m.Type().String(),
+		Version: m.Version(),
+		Token:   m.Token(),
+		Target:  m.Target(),
+		Body:    m.Body(),
+	}
+	if id := m.TransactionID(); id.Valid {
+		jm.TransactionID = &id.Int64
+	}
+	return jm
+}
+
+// Handle writes e to the underlying writer. It is an EventHandler.
+func (w *JSONEventWriter) Handle(e Event) {
+	je := jsonEvent{
+		Time:       e.Time,
+		Event:      e.Type,
+		PSM:        e.PSM,
+		RemoteAddr: e.RemoteAddr,
+		SessionID:  e.SessionID,
+		Message:    newJSONMessage(e.Message),
+		Data:       string(e.Data),
+	}
+	if e.Message != nil {
+		token := e.Message.Token()
+		je.Token = &token
+	}
+	if e.Response != nil {
+		je.Response = newJSONMessage(e.Response)
+	}
+	if e.Err != nil {
+		je.Error = e.Err.Error()
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.enc.Encode(je)
+}
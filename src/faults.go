@@ -0,0 +1,424 @@
+package gems
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// FaultKind identifies a way in which a server misbehaves.
+type FaultKind string
+
+const (
+	// FaultDelay holds the response for a random time between Delay and
+	// MaxDelay.
+	FaultDelay FaultKind = "delay"
+	// FaultDrop sends no response. GEMS-XML responds with an empty body.
+	FaultDrop FaultKind = "drop"
+	// FaultWrongTransactionID changes the transaction ID of the response.
+	FaultWrongTransactionID FaultKind = "wrong_transaction_id"
+	// FaultTruncate cuts the |END trailer of a GEMS-ASCII response.
+	FaultTruncate FaultKind = "truncate"
+	// FaultBadLength sends a GEMS-ASCII response with an incorrect length field.
+	FaultBadLength FaultKind = "bad_length"
+	// FaultInvalidXML sends a GEMS-XML response that is not well-formed.
+	FaultInvalidXML FaultKind = "invalid_xml"
+	// FaultUnknownResponse replaces the response with an UnknownResponse.
+	FaultUnknownResponse FaultKind = "unknown_response"
+	// FaultReset closes the connection abruptly instead of responding.
+	FaultReset FaultKind = "reset"
+)
+
+// FaultKinds lists every supported fault.
+var FaultKinds = []FaultKind{
+	FaultDelay, FaultDrop, FaultWrongTransactionID, FaultTruncate,
+	FaultBadLength, FaultInvalidXML, FaultUnknownResponse, FaultReset,
+}
+
+// FaultRule injects a fault into the responses to matching messages.
+type FaultRule struct {
+	// Name identifies the rule so it can be switched on and off.
+	Name string
+	Kind FaultKind
+	// MessageTypes limits the rule to requests of these types, given by
+	// name or ASCII type, e.g. "GetConfigMessage" or "GET". An empty list
+	// matches every request.
+	MessageTypes []string
+	// Probability of the fault occurring for a matching request, from
+	// 0 to 1.
+	Probability float64
+	// Delay and MaxDelay bound the hold time of a FaultDelay.
+	Delay    time.Duration
+	MaxDelay time.Duration
+	Disabled bool
+}
+
+type jsonFaultRule struct {
+	Name         string    `json:"name"`
+	Kind         FaultKind `json:"fault"`
+	MessageTypes []string  `json:"message_types,omitempty"`
+	Probability  float64   `json:"probability"`
+	Delay        string    `json:"delay,omitempty"`
+	MaxDelay     string    `json:"max_delay,omitempty"`
+	Disabled     bool      `json:"disabled,omitempty"`
+}
+
+// MarshalJSON encodes delays as Go duration strings, e.g. "1.5s".
+func (r FaultRule) MarshalJSON() ([]byte, error) {
+	jr := jsonFaultRule{
+		Name:         r.Name,
+		Kind:         r.Kind,
+		MessageTypes: r.MessageTypes,
+		Probability:  r.Probability,
+		Disabled:     r.Disabled,
+	}
+	if r.Delay != 0 {
+		jr.Delay = r.Delay.String()
+	}
+	if r.MaxDelay != 0 {
+		jr.MaxDelay = r.MaxDelay.String()
+	}
+	return json.Marshal(jr)
+}
+
+func (r *FaultRule) UnmarshalJSON(data []byte) error {
+	var jr jsonFaultRule
+	if err := json.Unmarshal(data, &jr); err != nil {
+		return err
+	}
+
+	*r = FaultRule{
+		Name:         jr.Name,
+		Kind:         jr.Kind,
+		MessageTypes: jr.MessageTypes,
+		Probability:  jr.Probability,
+		Disabled:     jr.Disabled,
+	}
+	var err error
+	if jr.Delay != "" {
+		if r.Delay, err = time.ParseDuration(jr.Delay); err != nil {
+			return fmt.Errorf("fault '%s': %w", r.Name, err)
+		}
+	}
+	if jr.MaxDelay != "" {
+		if r.MaxDelay, err = time.ParseDuration(jr.MaxDelay); err != nil {
+			return fmt.Errorf("fault '%s': %w", r.Name, err)
+		}
+	}
+	return nil
+}
+
+// Validate reports whether the rule is complete.
+func (r FaultRule) Validate() error {
+	known := false
+	for _, kind := range FaultKinds {
+		known = known || (r.Kind == kind)
+	}
+	if !known {
+		return fmt.Errorf("fault '%s' has unknown kind '%s'", r.Name, r.Kind)
+	}
+	if (r.Probability < 0) || (r.Probability > 1) {
+		return fmt.Errorf("fault '%s' probability must be between 0 and 1", r.Name)
+	}
+	if (r.Kind == FaultDelay) && (r.Delay <= 0) && (r.MaxDelay <= 0) {
+		return fmt.Errorf("fault '%s' requires a delay", r.Name)
+	}
+	for _, name := range r.MessageTypes {
+		if (MessageTypeFromASCII(name) == UndefinedMessageType) && (MessageTypeFromXMLName(xml.Name{Local: name}) == UndefinedMessageType) {
+			return fmt.Errorf("fault '%s' has unknown message type '%s'", r.Name, name)
+		}
+	}
+	return nil
+}
+
+func (r FaultRule) matches(t MessageType) bool {
+	if len(r.MessageTypes) == 0 {
+		return true
+	}
+	for _, name := range r.MessageTypes {
+		if (name == t.String()) || (name == t.ASCII()) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseFaultRules decodes a JSON list of fault rules.
+func ParseFaultRules(data []byte) ([]FaultRule, error) {
+	var rules []FaultRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid fault rules: %w", err)
+	}
+	for i := range rules {
+		if rules[i].Name == "" {
+			rules[i].Name = fmt.Sprintf("%s-%d", rules[i].Kind, i)
+		}
+		if err := rules[i].Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// FaultInjector makes a server misbehave according to a set of rules. The
+// rules and the switches that enable them may be changed while the server
+// is running.
+type FaultInjector struct {
+	mu      sync.Mutex
+	rules   []FaultRule
+	enabled bool
+	rand    *rand.Rand
+}
+
+// NewFaultInjector returns an enabled FaultInjector applying rules.
+func NewFaultInjector(rules ...FaultRule) *FaultInjector {
+	return &FaultInjector{
+		rules:   rules,
+		enabled: true,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// WithFaultInjector injects the faults chosen by f into the responses
+// sent by the server.
+func WithFaultInjector(f *FaultInjector) ServerOption {
+	return func(o *serverOptions) {
+		o.faults = f
+	}
+}
+
+// Rules returns a copy of the current rules.
+func (f *FaultInjector) Rules() []FaultRule {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]FaultRule(nil), f.rules...)
+}
+
+// SetRule adds a rule, replacing any rule with the same name.
+func (f *FaultInjector) SetRule(rule FaultRule) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := range f.rules {
+		if f.rules[i].Name == rule.Name {
+			f.rules[i] = rule
+			return nil
+		}
+	}
+	f.rules = append(f.rules, rule)
+	return nil
+}
+
+// RemoveRule deletes the named rule.
+func (f *FaultInjector) RemoveRule(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := range f.rules {
+		if f.rules[i].Name == name {
+			f.rules = append(f.rules[:i], f.rules[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown fault '%s'", name)
+}
+
+// EnableRule switches the named rule on or off.
+func (f *FaultInjector) EnableRule(name string, enabled bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := range f.rules {
+		if f.rules[i].Name == name {
+			f.rules[i].Disabled = !enabled
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown fault '%s'", name)
+}
+
+// Enabled reports whether faults are injected at all.
+func (f *FaultInjector) Enabled() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.enabled
+}
+
+// SetEnabled switches all fault injection on or off without changing the
+// rules.
+func (f *FaultInjector) SetEnabled(enabled bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.enabled = enabled
+}
+
+// faultPlan describes how a server mangles a single response.
+type faultPlan struct {
+	faults  []FaultKind
+	delay   time.Duration
+	drop    bool
+	reset   bool
+	resp    Response
+	corrupt []func([]byte) []byte
+}
+
+// apply returns the encoded response after the corrupting faults.
+func (p faultPlan) apply(out []byte) []byte {
+	for _, corrupt := range p.corrupt {
+		out = corrupt(out)
+	}
+	return out
+}
+
+// plan chooses the faults for the response to req. Faults that do not
+// apply to the PSM of the server are ignored.
+func (f *FaultInjector) plan(psm string, req Message, resp Response, v Version) faultPlan {
+	p := faultPlan{resp: resp}
+	if f == nil {
+		return p
+	}
+
+	f.mu.Lock()
+	var triggered []FaultRule
+	if f.enabled {
+		for _, rule := range f.rules {
+			if !rule.Disabled && rule.matches(req.Type()) && (f.rand.Float64() < rule.Probability) {
+				triggered = append(triggered, rule)
+			}
+		}
+	}
+	jitter := f.rand.Float64()
+	f.mu.Unlock()
+
+	for _, rule := range triggered {
+		switch rule.Kind {
+		case FaultDelay:
+			maxDelay := max(rule.Delay, rule.MaxDelay)
+			p.delay += rule.Delay + time.Duration(jitter*float64(maxDelay-rule.Delay))
+		case FaultDrop:
+			p.drop = true
+		case FaultReset:
+			p.reset = true
+		case FaultUnknownResponse:
+			p.resp = unknownResponse(req, v)
+		case FaultWrongTransactionID:
+			if isXMLPSM(psm) {
+				p.corrupt = append(p.corrupt, wrongXMLTransactionID)
+			} else {
+				p.corrupt = append(p.corrupt, wrongASCIITransactionID)
+			}
+		case FaultTruncate:
+			if psm != "ascii" {
+				continue
+			}
+			p.corrupt = append(p.corrupt, truncateASCII)
+		case FaultBadLength:
+			if psm != "ascii" {
+				continue
+			}
+			p.corrupt = append(p.corrupt, badASCIILength)
+		case FaultInvalidXML:
+			if !isXMLPSM(psm) {
+				continue
+			}
+			p.corrupt = append(p.corrupt, invalidXML)
+		}
+		p.faults = append(p.faults, rule.Kind)
+	}
+	return p
+}
+
+func unknownResponse(req Message, v Version) Response {
+	mb := v.NewMessageBuilder().Type(UnknownResponseType).Token(req.Token())
+	if req.TransactionID().Valid {
+		mb.TransactionID(req.TransactionID().Int64)
+	}
+	msg, _ := mb.ResultCode(ResultCodeUnsupportedMessage).Build()
+	resp, _ := msg.(Response)
+	return resp
+}
+
+// asciiHeaderLength is the length of "|GEMS|14|0000000000|".
+const asciiHeaderLength = 20
+
+func setASCIILength(out []byte, length int) []byte {
+	if len(out) < asciiHeaderLength {
+		return out
+	}
+	copy(out[9:19], fmt.Sprintf("%010d", length))
+	return out
+}
+
+// replaceASCIITransactionID passes the transaction ID of a GEMS-ASCII
+// message through f and corrects the length field.
+func replaceASCIITransactionID(out []byte, f func(int64) int64) []byte {
+	if len(out) < asciiHeaderLength {
+		return out
+	}
+	end := bytes.IndexByte(out[asciiHeaderLength:], '|')
+	if end < 0 {
+		return out
+	}
+
+	id, _ := strconv.ParseInt(string(out[asciiHeaderLength:asciiHeaderLength+end]), 10, 64)
+	replaced := append([]byte{}, out[:asciiHeaderLength]...)
+	replaced = strconv.AppendInt(replaced, f(id), 10)
+	replaced = append(replaced, out[asciiHeaderLength+end:]...)
+	return setASCIILength(replaced, len(replaced))
+}
+
+func wrongTransactionID(id int64) int64 {
+	return id + 1000
+}
+
+func wrongASCIITransactionID(out []byte) []byte {
+	return replaceASCIITransactionID(out, wrongTransactionID)
+}
+
+func truncateASCII(out []byte) []byte {
+	return bytes.TrimSuffix(out, []byte("ND"))
+}
+
+func badASCIILength(out []byte) []byte {
+	return setASCIILength(out, len(out)+17)
+}
+
+func wrongXMLTransactionID(out []byte) []byte {
+	return replaceXMLTransactionID(out, wrongTransactionID)
+}
+
+func invalidXML(out []byte) []byte {
+	if i := bytes.LastIndex(out, []byte("</")); i > 0 {
+		return append(out[:i:i], "<"...)
+	}
+	return append(out, '<')
+}
+
+// resetConn closes conn so that the peer sees a connection reset rather
+// than an orderly shutdown.
+func resetConn(conn net.Conn) {
+	for {
+		wrapped, ok := conn.(interface{ NetConn() net.Conn })
+		if !ok {
+			break
+		}
+		conn = wrapped.NetConn()
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+	conn.Close()
+}
@@ -1,36 +1,58 @@
 package gems
 
 import (
+	"bytes"
+	"encoding/csv"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"reflect"
 	"strings"
+
+	"github.com/mitre/gems/src/ascii"
 )
 
+// MessageFormatter formats messages for display. FormatMessage returns the
+// error of a message that cannot be formatted, for which Format returns as
+// much of the output as it can, often an empty string.
 type MessageFormatter interface {
 	Format(Message) string
+	FormatMessage(Message) (string, error)
 }
 
 type DefaultFormatter struct{}
 
 func (p DefaultFormatter) Format(msg Message) string {
+	out, _ := p.FormatMessage(msg)
+	return out
+}
+
+// FormatMessage formats msg, or only its header if the body cannot be
+// formatted.
+func (p DefaultFormatter) FormatMessage(msg Message) (string, error) {
 	var b strings.Builder
 
 	fmt.Fprintf(&b, "%s | %s | '%s' | %s |", msg.Type(), msg.TransactionID(), msg.Token(), msg.Target())
 
 	out, err := json.MarshalIndent(msg.Body(), "", "  ")
 	if (err != nil) || (len(msg.Body()) == 0) {
-		return b.String()
+		return b.String(), err
 	}
 
 	b.WriteRune('\n')
 	b.Write(out)
-	return b.String()
+	return b.String(), nil
 }
 
 type ResponseContentFormatter struct{}
 
 func (p ResponseContentFormatter) Format(msg Message) string {
+	out, _ := p.FormatMessage(msg)
+	return out
+}
+
+// FormatMessage formats msg. It does not fail.
+func (p ResponseContentFormatter) FormatMessage(msg Message) (string, error) {
 	var b strings.Builder
 	b.WriteString(msg.Type().String())
 
@@ -58,15 +80,389 @@ func (p ResponseContentFormatter) Format(msg Message) string {
 
 	s := b.String()
 	s = strings.TrimSuffix(s, "\n")
-	return s
+	return s, nil
 }
 
 type BodyFormatter struct{}
 
 func (b BodyFormatter) Format(msg Message) string {
+	out, _ := b.FormatMessage(msg)
+	return out
+}
+
+func (b BodyFormatter) FormatMessage(msg Message) (string, error) {
 	out, err := json.MarshalIndent(msg.Body(), "", "  ")
 	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// JSONFormatter formats a message as its JSON representation, on a single
+// line.
+type JSONFormatter struct{}
+
+func (f JSONFormatter) Format(msg Message) string {
+	out, _ := f.FormatMessage(msg)
+	return out
+}
+
+func (f JSONFormatter) FormatMessage(msg Message) (string, error) {
+	out, err := json.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// YAMLFormatter formats a message as its JSON representation, written as a
+// YAML document with the fields in the same order.
+type YAMLFormatter struct{}
+
+func (f YAMLFormatter) Format(msg Message) string {
+	out, _ := f.FormatMessage(msg)
+	return out
+}
+
+func (f YAMLFormatter) FormatMessage(msg Message) (string, error) {
+	root, err := messageTree(msg)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	writeYAML(&b, root, 0)
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// CSVFormatter formats a message as CSV records with the columns
+// field,name,datatype,multiplicity,value. The header fields and scalar
+// content of the message are records with only a field and a value, e.g.
+// "result_code,,,,SUCCESS". Lists such as configurations have a record per
+// item, and parameters have a record per value, named by their path:
+// "parameters,Channel0.BitRates[1],int,2,2000". An array of multiplicity 0
+// has a single record without a value.
+type CSVFormatter struct{}
+
+func (f CSVFormatter) Format(msg Message) string {
+	out, _ := f.FormatMessage(msg)
+	return out
+}
+
+func (f CSVFormatter) FormatMessage(msg Message) (string, error) {
+	root, err := messageTree(msg)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	w.Write([]string{"field", "name", "datatype", "multiplicity", "value"})
+	for i, key := range root.keys {
+		node := root.values[i]
+		switch {
+		case node.kind == '[' && isParameterList(key):
+			for _, p := range node.values {
+				writeParameterCSV(w, key, parameterName(p), p)
+			}
+		case node.kind == '[':
+			for _, item := range node.values {
+				w.Write([]string{key, "", "", "", item.text()})
+			}
+		default:
+			w.Write([]string{key, "", "", "", node.text()})
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// ASCIIFormatter formats a message in GEMS-ASCII.
+type ASCIIFormatter struct{}
+
+func (f ASCIIFormatter) Format(msg Message) string {
+	out, _ := f.FormatMessage(msg)
+	return out
+}
+
+func (f ASCIIFormatter) FormatMessage(msg Message) (string, error) {
+	out, err := ascii.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// XMLFormatter formats a message in GEMS-XML.
+type XMLFormatter struct{}
+
+func (f XMLFormatter) Format(msg Message) string {
+	out, _ := f.FormatMessage(msg)
+	return out
+}
+
+func (f XMLFormatter) FormatMessage(msg Message) (string, error) {
+	out, err := xml.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// jsonNode is a JSON value that keeps the order of the keys of objects.
+type jsonNode struct {
+	// kind is '{' for an object, '[' for an array and 0 for a scalar.
+	kind   byte
+	keys   []string
+	values []jsonNode
+	// raw is the JSON text of a scalar.
+	raw string
+}
+
+// messageTree returns the JSON representation of msg.
+func messageTree(msg Message) (jsonNode, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return jsonNode{}, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return decodeJSONNode(dec)
+}
+
+func decodeJSONNode(dec *json.Decoder) (jsonNode, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return jsonNode{}, err
+	}
+
+	switch t := tok.(type) {
+	case json.Delim:
+		node := jsonNode{kind: byte(t)}
+		for dec.More() {
+			if node.kind == '{' {
+				key, err := dec.Token()
+				if err != nil {
+					return node, err
+				}
+				node.keys = append(node.keys, key.(string))
+			}
+			value, err := decodeJSONNode(dec)
+			if err != nil {
+				return node, err
+			}
+			node.values = append(node.values, value)
+		}
+		_, err := dec.Token()
+		return node, err
+	case string:
+		raw, err := json.Marshal(t)
+		return jsonNode{raw: string(raw)}, err
+	case nil:
+		return jsonNode{raw: "null"}, nil
+	default:
+		return jsonNode{raw: fmt.Sprint(t)}, nil
+	}
+}
+
+// get returns the value of key in an object.
+func (n jsonNode) get(key string) (jsonNode, bool) {
+	for i, k := range n.keys {
+		if k == key {
+			return n.values[i], true
+		}
+	}
+	return jsonNode{}, false
+}
+
+// text returns the content of a scalar, with strings unquoted and null as
+// an empty string. A hex value is written as in GEMS-ASCII, "FAF320/24".
+func (n jsonNode) text() string {
+	if n.kind == '{' {
+		data, _ := n.get("data")
+		bits, _ := n.get("bit_length")
+		return data.text() + "/" + bits.text()
+	}
+	if n.raw == "null" {
 		return ""
 	}
-	return string(out)
+	var s string
+	if json.Unmarshal([]byte(n.raw), &s) == nil {
+		return s
+	}
+	return n.raw
+}
+
+func writeYAML(b *strings.Builder, n jsonNode, indent int) {
+	pad := strings.Repeat(" ", indent)
+	for i, key := range n.keys {
+		value := n.values[i]
+		if (value.kind == 0) || (len(value.values) == 0) {
+			fmt.Fprintf(b, "%s%s: %s\n", pad, key, value.yamlScalar())
+			continue
+		}
+
+		fmt.Fprintf(b, "%s%s:\n", pad, key)
+		if value.kind == '{' {
+			writeYAML(b, value, indent+2)
+		} else {
+			writeYAMLList(b, value, indent+2)
+		}
+	}
+}
+
+func writeYAMLList(b *strings.Builder, n jsonNode, indent int) {
+	pad := strings.Repeat(" ", indent)
+	for _, item := range n.values {
+		switch {
+		case (item.kind == 0) || (len(item.values) == 0):
+			fmt.Fprintf(b, "%s- %s\n", pad, item.yamlScalar())
+		case item.kind == '{':
+			// The first field of the object follows the dash.
+			var obj strings.Builder
+			writeYAML(&obj, item, indent+2)
+			fmt.Fprintf(b, "%s- %s", pad, strings.TrimPrefix(obj.String(), pad+"  "))
+		default:
+			fmt.Fprintf(b, "%s-\n", pad)
+			writeYAMLList(b, item, indent+2)
+		}
+	}
+}
+
+// yamlScalar returns a scalar or empty collection in YAML. The JSON text of
+// a scalar is valid YAML, since strings are double-quoted.
+func (n jsonNode) yamlScalar() string {
+	switch n.kind {
+	case '{':
+		return "{}"
+	case '[':
+		return "[]"
+	default:
+		return n.raw
+	}
+}
+
+// isParameterList reports whether a field of the JSON representation of a
+// message holds parameters.
+func isParameterList(key string) bool {
+	return (key == "parameters") || (key == "arguments") || (key == "return_values")
+}
+
+// writeParameterCSV writes the records of the JSON representation of a
+// parameter. path is the name of the parameter, qualified by the names of
+// the enclosing ParameterSets.
+func writeParameterCSV(w *csv.Writer, field string, path string, p jsonNode) {
+	datatype, _ := p.get("datatype")
+	multiplicity, isArray := p.get("multiplicity")
+	values, _ := p.get("values")
+
+	if isArray && (multiplicity.text() == "0") {
+		w.Write([]string{field, path, datatype.text(), "0", ""})
+		return
+	}
+	for i, v := range values.values {
+		valuePath := path
+		if isArray {
+			valuePath = fmt.Sprintf("%s[%d]", path, i)
+		}
+
+		switch {
+		case datatype.text() != "set_type":
+			w.Write([]string{field, valuePath, datatype.text(), multiplicity.text(), v.text()})
+		case isArray:
+			// The elements of an array are ParameterSets named by their index.
+			elements, _ := v.get("values")
+			for _, child := range elements.values {
+				writeParameterCSV(w, field, valuePath+"."+parameterName(child), child)
+			}
+		default:
+			writeParameterCSV(w, field, valuePath+"."+parameterName(v), v)
+		}
+	}
+}
+
+func parameterName(p jsonNode) string {
+	name, _ := p.get("name")
+	return name.text()
+}
+
+// Traits of the facts reported by FactFormatter. They match the traits used
+// by the abilities of the Caldera plugin.
+const (
+	TraitParameterValue = "gems.parameter.value"
+	TraitParameterNames = "gems.parameter.names"
+	TraitConfigName     = "gems.config.name"
+	TraitDirectiveName  = "gems.directive.name"
+)
+
+// Fact is a Caldera fact, the value of a trait.
+type Fact struct {
+	Trait string `json:"trait"`
+	Value string `json:"value"`
+}
+
+// Facts returns the facts reported by a message:
+//
+//   - a gems.parameter.value fact for each parameter, argument and return
+//     value, in the GEMS-ASCII form accepted by SetConfig, e.g.
+//     "PacketLength:int=1024";
+//   - a gems.parameter.names fact with the comma separated names of those
+//     parameters, or of the desired parameters of a GetConfigMessage;
+//   - a gems.config.name fact for each configuration name;
+//   - a gems.directive.name fact for the name of a directive.
+func Facts(msg Message) []Fact {
+	facts := []Fact{}
+	body := msg.Body()
+
+	if name, ok := body["directive_name"].(string); ok {
+		facts = append(facts, Fact{TraitDirectiveName, name})
+	}
+	if name, ok := body["config_name"].(string); ok {
+		facts = append(facts, Fact{TraitConfigName, name})
+	}
+	if configs, ok := body["configurations"].([]string); ok {
+		for _, name := range configs {
+			facts = append(facts, Fact{TraitConfigName, name})
+		}
+	}
+	if names, ok := body["desired_parameters"].([]string); ok && (len(names) > 0) {
+		facts = append(facts, Fact{TraitParameterNames, strings.Join(names, ",")})
+	}
+
+	for _, key := range []string{"parameters", "arguments", "return_values"} {
+		params, ok := body[key].([]string)
+		if !ok || (len(params) == 0) {
+			continue
+		}
+
+		names := make([]string, len(params))
+		for i, p := range params {
+			facts = append(facts, Fact{TraitParameterValue, p})
+			names[i], _, _ = strings.Cut(p, ":")
+		}
+		facts = append(facts, Fact{TraitParameterNames, strings.Join(names, ",")})
+	}
+	return facts
+}
+
+// FactFormatter formats the facts reported by a message as a JSON array of
+// Caldera facts, e.g.
+//
+//	[{"trait":"gems.parameter.value","value":"PacketLength:int=1024"}]
+type FactFormatter struct{}
+
+func (f FactFormatter) Format(msg Message) string {
+	out, _ := f.FormatMessage(msg)
+	return out
+}
+
+func (f FactFormatter) FormatMessage(msg Message) (string, error) {
+	out, err := json.Marshal(Facts(msg))
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
 }
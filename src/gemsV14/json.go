@@ -0,0 +1,802 @@
+package gemsV14
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	gems "github.com/mitre/gems/src"
+)
+
+// The JSON representation of a message is an object holding the header
+// fields and the content of the message, using the keys of Message.Body:
+//
+//	{"gems_version": "1.4", "type": "GetConfigResponse", "transaction_id": 1,
+//	 "token": "abc", "timestamp": "1410804178.490230000", "target": "Modem1",
+//	 "result_code": "SUCCESS", "parameters": [...]}
+//
+// A parameter is an object holding its name, its datatype by GEMS-ASCII
+// type name, its multiplicity if it is an array, and its values:
+//
+//	{"name": "BitRates", "datatype": "int", "multiplicity": 2, "values": [200, 2000]}
+//
+// The values of a ParameterSet are parameters, or unnamed ParameterSets for
+// an array ParameterSet. Empty values are null. Numbers are JSON numbers,
+// except for non-finite doubles, which are the strings "NaN", "+Inf" and
+// "-Inf". Hex values are objects holding the hex encoded data and its bit
+// length, {"data": "FAF320", "bit_length": 24}, and times are strings in
+// their GEMS-ASCII format.
+
+var jsonNull = []byte("null")
+
+func isJSONNull(data []byte) bool {
+	return bytes.Equal(bytes.TrimSpace(data), jsonNull)
+}
+
+func (v String) MarshalJSON() ([]byte, error) {
+	if v.Empty {
+		return jsonNull, nil
+	}
+	return json.Marshal(v.Data)
+}
+
+func (v *String) UnmarshalJSON(data []byte) error {
+	*v = String{Empty: isJSONNull(data)}
+	if v.Empty {
+		return nil
+	}
+	return json.Unmarshal(data, &v.Data)
+}
+
+func (v Boolean) MarshalJSON() ([]byte, error) {
+	if v.Empty {
+		return jsonNull, nil
+	}
+	return json.Marshal(v.Data)
+}
+
+func (v *Boolean) UnmarshalJSON(data []byte) error {
+	*v = Boolean{Empty: isJSONNull(data)}
+	if v.Empty {
+		return nil
+	}
+	return json.Unmarshal(data, &v.Data)
+}
+
+func (v Byte) MarshalJSON() ([]byte, error) {
+	if v.Empty {
+		return jsonNull, nil
+	}
+	return json.Marshal(v.Data)
+}
+
+func (v *Byte) UnmarshalJSON(data []byte) error {
+	*v = Byte{Empty: isJSONNull(data)}
+	if v.Empty {
+		return nil
+	}
+	return json.Unmarshal(data, &v.Data)
+}
+
+func (v Ubyte) MarshalJSON() ([]byte, error) {
+	if v.Empty {
+		return jsonNull, nil
+	}
+	return json.Marshal(v.Data)
+}
+
+func (v *Ubyte) UnmarshalJSON(data []byte) error {
+	*v = Ubyte{Empty: isJSONNull(data)}
+	if v.Empty {
+		return nil
+	}
+	return json.Unmarshal(data, &v.Data)
+}
+
+func (v Short) MarshalJSON() ([]byte, error) {
+	if v.Empty {
+		return jsonNull, nil
+	}
+	return json.Marshal(v.Data)
+}
+
+func (v *Short) UnmarshalJSON(data []byte) error {
+	*v = Short{Empty: isJSONNull(data)}
+	if v.Empty {
+		return nil
+	}
+	return json.Unmarshal(data, &v.Data)
+}
+
+func (v Ushort) MarshalJSON() ([]byte, error) {
+	if v.Empty {
+		return jsonNull, nil
+	}
+	return json.Marshal(v.Data)
+}
+
+func (v *Ushort) UnmarshalJSON(data []byte) error {
+	*v = Ushort{Empty: isJSONNull(data)}
+	if v.Empty {
+		return nil
+	}
+	return json.Unmarshal(data, &v.Data)
+}
+
+func (v Int) MarshalJSON() ([]byte, error) {
+	if v.Empty {
+		return jsonNull, nil
+	}
+	return json.Marshal(v.Data)
+}
+
+func (v *Int) UnmarshalJSON(data []byte) error {
+	*v = Int{Empty: isJSONNull(data)}
+	if v.Empty {
+		return nil
+	}
+	return json.Unmarshal(data, &v.Data)
+}
+
+func (v Uint) MarshalJSON() ([]byte, error) {
+	if v.Empty {
+		return jsonNull, nil
+	}
+	return json.Marshal(v.Data)
+}
+
+func (v *Uint) UnmarshalJSON(data []byte) error {
+	*v = Uint{Empty: isJSONNull(data)}
+	if v.Empty {
+		return nil
+	}
+	return json.Unmarshal(data, &v.Data)
+}
+
+func (v Long) MarshalJSON() ([]byte, error) {
+	if v.Empty {
+		return jsonNull, nil
+	}
+	return json.Marshal(v.Data)
+}
+
+func (v *Long) UnmarshalJSON(data []byte) error {
+	*v = Long{Empty: isJSONNull(data)}
+	if v.Empty {
+		return nil
+	}
+	return json.Unmarshal(data, &v.Data)
+}
+
+func (v Ulong) MarshalJSON() ([]byte, error) {
+	if v.Empty {
+		return jsonNull, nil
+	}
+	return json.Marshal(v.Data)
+}
+
+func (v *Ulong) UnmarshalJSON(data []byte) error {
+	*v = Ulong{Empty: isJSONNull(data)}
+	if v.Empty {
+		return nil
+	}
+	return json.Unmarshal(data, &v.Data)
+}
+
+func (v Double) MarshalJSON() ([]byte, error) {
+	switch {
+	case v.Empty:
+		return jsonNull, nil
+	case math.IsNaN(v.Data) || math.IsInf(v.Data, 0):
+		return json.Marshal(strconv.FormatFloat(v.Data, 'f', -1, 64))
+	default:
+		return json.Marshal(v.Data)
+	}
+}
+
+func (v *Double) UnmarshalJSON(data []byte) error {
+	*v = Double{Empty: isJSONNull(data)}
+	if v.Empty {
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return json.Unmarshal(data, &v.Data)
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if (err != nil) || !(math.IsNaN(f) || math.IsInf(f, 0)) {
+		return fmt.Errorf("invalid double value %s", data)
+	}
+	v.Data = f
+	return nil
+}
+
+type hexValueJSON struct {
+	Data      string `json:"data"`
+	BitLength int    `json:"bit_length"`
+}
+
+func (v HexValue) MarshalJSON() ([]byte, error) {
+	if v.Empty {
+		return jsonNull, nil
+	}
+	return json.Marshal(hexValueJSON{Data: strings.ToUpper(hex.EncodeToString(v.Data)), BitLength: v.BitLength})
+}
+
+func (v *HexValue) UnmarshalJSON(data []byte) error {
+	*v = HexValue{Empty: isJSONNull(data)}
+	if v.Empty {
+		return nil
+	}
+
+	var hj hexValueJSON
+	if err := json.Unmarshal(data, &hj); err != nil {
+		return err
+	}
+	decoded, err := hex.DecodeString(hj.Data)
+	if err != nil {
+		return fmt.Errorf("invalid hex_value data '%s': %w", hj.Data, err)
+	}
+	if (hj.BitLength < 0) || (hj.BitLength > 8*len(decoded)) {
+		return fmt.Errorf("invalid hex_value bit length %d for %d bytes", hj.BitLength, len(decoded))
+	}
+	v.Data = decoded
+	v.BitLength = hj.BitLength
+	return nil
+}
+
+func (v Time) MarshalJSON() ([]byte, error) {
+	if v.Empty {
+		return jsonNull, nil
+	}
+	return json.Marshal(v.Data.FormatTime())
+}
+
+func (v *Time) UnmarshalJSON(data []byte) error {
+	*v = Time{Empty: isJSONNull(data)}
+	if v.Empty {
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	var err error
+	v.Data, err = gems.TimeFromString(s)
+	return err
+}
+
+func (v Utime) MarshalJSON() ([]byte, error) {
+	if v.Empty {
+		return jsonNull, nil
+	}
+	return json.Marshal(v.Data.FormatUtime())
+}
+
+func (v *Utime) UnmarshalJSON(data []byte) error {
+	*v = Utime{Empty: isJSONNull(data)}
+	if v.Empty {
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	var err error
+	v.Data, err = gems.TimeFromUtime(s)
+	return err
+}
+
+type parameterJSON struct {
+	Name         string            `json:"name,omitempty"`
+	Datatype     string            `json:"datatype,omitempty"`
+	Multiplicity *int32            `json:"multiplicity,omitempty"`
+	Values       []json.RawMessage `json:"values"`
+}
+
+func marshalParameterJSON(name string, typ gems.Datatype, multiplicity gems.NullInt32, values ValueSlice) ([]byte, error) {
+	pj := parameterJSON{Name: name, Values: make([]json.RawMessage, len(values))}
+	if typ != gems.UndefinedType {
+		pj.Datatype = typ.ASCIIName()
+	}
+	if multiplicity.Valid {
+		pj.Multiplicity = &multiplicity.Int32
+	}
+
+	for i, v := range values {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		pj.Values[i] = data
+	}
+	return json.Marshal(pj)
+}
+
+func (p Parameter) MarshalJSON() ([]byte, error) {
+	typ := p.ValueType()
+	if (typ == gems.UndefinedType) && (len(p.Values) > 0) {
+		return nil, fmt.Errorf("Parameter '%s' contains inconsistent or undefined value types", p.name)
+	}
+	return marshalParameterJSON(p.name, typ, p.Multiplicity, p.Values)
+}
+
+func (p *Parameter) UnmarshalJSON(data []byte) error {
+	xp, err := UnmarshalParameterJSON(data)
+	if err != nil {
+		return err
+	}
+	parsed, ok := xp.(*Parameter)
+	if !ok {
+		return fmt.Errorf("cannot unmarshal ParameterSet '%s' into a Parameter", xp.Name())
+	}
+	*p = *parsed
+	return nil
+}
+
+func (ps ParameterSet) MarshalJSON() ([]byte, error) {
+	return marshalParameterJSON(ps.name, gems.ParameterSetType, ps.Multiplicity, ps.Values)
+}
+
+func (ps *ParameterSet) UnmarshalJSON(data []byte) error {
+	xp, err := UnmarshalParameterJSON(data)
+	if err != nil {
+		return err
+	}
+	parsed, ok := xp.(*ParameterSet)
+	if !ok {
+		return fmt.Errorf("cannot unmarshal Parameter '%s' into a ParameterSet", xp.Name())
+	}
+	*ps = *parsed
+	return nil
+}
+
+// UnmarshalParameterJSON returns the Parameter, or the ParameterSet, of
+// its JSON representation.
+func UnmarshalParameterJSON(data []byte) (gems.XMLParameter, error) {
+	var pj parameterJSON
+	if err := json.Unmarshal(data, &pj); err != nil {
+		return nil, err
+	}
+
+	typ := gems.UndefinedType
+	if pj.Datatype != "" {
+		typ = gems.DatatypeFromASCII(pj.Datatype)
+		if typ == gems.UndefinedType {
+			return nil, fmt.Errorf("parameter '%s' has invalid datatype '%s'", pj.Name, pj.Datatype)
+		}
+	} else if len(pj.Values) > 0 {
+		return nil, fmt.Errorf("parameter '%s' has values but no datatype", pj.Name)
+	}
+
+	var multiplicity gems.NullInt32
+	if pj.Multiplicity != nil {
+		multiplicity = gems.NewNullInt32(int(*pj.Multiplicity))
+	}
+
+	values := make(ValueSlice, 0, len(pj.Values))
+	for _, raw := range pj.Values {
+		var (
+			v   gems.XMLValue
+			err error
+		)
+		if typ == gems.ParameterSetType {
+			v, err = UnmarshalParameterJSON(raw)
+		} else {
+			v, err = newValue(typ)
+			if err == nil {
+				err = v.(json.Unmarshaler).UnmarshalJSON(raw)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parameter '%s': %w", pj.Name, err)
+		}
+		values = append(values, v)
+	}
+
+	if typ == gems.ParameterSetType {
+		return &ParameterSet{name: pj.Name, Multiplicity: multiplicity, Values: values}, nil
+	}
+	return &Parameter{name: pj.Name, Multiplicity: multiplicity, Values: values}, nil
+}
+
+func marshalParametersJSON(params []gems.XMLParameter) ([]json.RawMessage, error) {
+	raw := make([]json.RawMessage, len(params))
+	for i, p := range params {
+		data, err := json.Marshal(p)
+		if err != nil {
+			return nil, err
+		}
+		raw[i] = data
+	}
+	return raw, nil
+}
+
+func unmarshalParametersJSON(raw []json.RawMessage) ([]gems.XMLParameter, error) {
+	params := make([]gems.XMLParameter, 0, len(raw))
+	for _, data := range raw {
+		p, err := UnmarshalParameterJSON(data)
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, p)
+	}
+	return params, nil
+}
+
+type messageJSON struct {
+	Version           string                `json:"gems_version"`
+	Type              string                `json:"type"`
+	TransactionID     *int64                `json:"transaction_id,omitempty"`
+	Token             string                `json:"token,omitempty"`
+	Timestamp         string                `json:"timestamp,omitempty"`
+	Target            string                `json:"target,omitempty"`
+	ResultCode        gems.ResultCode       `json:"result_code,omitempty"`
+	ResultDescription string                `json:"result_description,omitempty"`
+	ConnectionType    gems.ConnectionType   `json:"connection_type,omitempty"`
+	DisconnectReason  gems.DisconnectReason `json:"disconnect_reason,omitempty"`
+	ConfigName        string                `json:"config_name,omitempty"`
+	Configurations    []string              `json:"configurations,omitempty"`
+	DesiredParameters []string              `json:"desired_parameters,omitempty"`
+	DirectiveName     string                `json:"directive_name,omitempty"`
+	ParametersSet     *int                  `json:"parameters_set,omitempty"`
+	ParametersLoaded  *int                  `json:"parameters_loaded,omitempty"`
+	ParametersSaved   *int                  `json:"parameters_saved,omitempty"`
+	Parameters        []json.RawMessage     `json:"parameters,omitempty"`
+	Arguments         []json.RawMessage     `json:"arguments,omitempty"`
+	ReturnValues      []json.RawMessage     `json:"return_values,omitempty"`
+}
+
+func (h MessageHeader) messageJSON(typ gems.MessageType) messageJSON {
+	mj := messageJSON{Version: version, Type: typ.String(), Token: h.token, Target: h.target}
+	if h.transactionID.Valid {
+		mj.TransactionID = &h.transactionID.Int64
+	}
+	if !h.timestamp.IsZero() {
+		mj.Timestamp = h.timestamp.FormatTime()
+	}
+	return mj
+}
+
+func (mj *messageJSON) setResult(r gems.Result) {
+	mj.ResultCode = r.Code
+	mj.ResultDescription = r.Description
+}
+
+func (mj messageJSON) result() gems.Result {
+	return gems.Result{Code: mj.ResultCode, Description: mj.ResultDescription}
+}
+
+// unmarshalJSONMessage decodes the JSON representation of a message of
+// type typ, storing its header in h.
+func unmarshalJSONMessage(data []byte, h *MessageHeader, typ gems.MessageType) (messageJSON, error) {
+	var mj messageJSON
+	if err := json.Unmarshal(data, &mj); err != nil {
+		return mj, err
+	}
+	if mj.Version != version {
+		return mj, fmt.Errorf("incorrect gems version '%s'", mj.Version)
+	}
+	if gems.MessageTypeFromXMLName(xml.Name{Local: mj.Type}) != typ {
+		return mj, fmt.Errorf("cannot unmarshal '%s' into %s", mj.Type, typ)
+	}
+
+	*h = MessageHeader{token: mj.Token, target: mj.Target}
+	if mj.TransactionID != nil {
+		h.transactionID = gems.NewNullInt64(*mj.TransactionID)
+	}
+	if mj.Timestamp != "" {
+		t, err := gems.TimeFromString(mj.Timestamp)
+		if err != nil {
+			return mj, err
+		}
+		h.timestamp = t
+	}
+	return mj, nil
+}
+
+func (GemsV14) ReceiveJSONMessage(data []byte, typ gems.MessageType) (gems.Message, error) {
+	return receiveMessage(data, typ, json.Unmarshal)
+}
+
+func (m UnknownResponse) MarshalJSON() ([]byte, error) {
+	mj := m.messageJSON(m.Type())
+	mj.setResult(m.result)
+	return json.Marshal(mj)
+}
+
+func (m *UnknownResponse) UnmarshalJSON(data []byte) error {
+	mj, err := unmarshalJSONMessage(data, &m.MessageHeader, m.Type())
+	m.result = mj.result()
+	return err
+}
+
+func (m ConnectMessage) MarshalJSON() ([]byte, error) {
+	mj := m.messageJSON(m.Type())
+	mj.ConnectionType = m.ConnectionType
+	return json.Marshal(mj)
+}
+
+func (m *ConnectMessage) UnmarshalJSON(data []byte) error {
+	mj, err := unmarshalJSONMessage(data, &m.MessageHeader, m.Type())
+	m.ConnectionType = mj.ConnectionType
+	return err
+}
+
+func (m ConnectResponse) MarshalJSON() ([]byte, error) {
+	mj := m.messageJSON(m.Type())
+	mj.setResult(m.result)
+	return json.Marshal(mj)
+}
+
+func (m *ConnectResponse) UnmarshalJSON(data []byte) error {
+	mj, err := unmarshalJSONMessage(data, &m.MessageHeader, m.Type())
+	m.result = mj.result()
+	return err
+}
+
+func (m DisconnectMessage) MarshalJSON() ([]byte, error) {
+	mj := m.messageJSON(m.Type())
+	mj.DisconnectReason = m.DisconnectReason
+	return json.Marshal(mj)
+}
+
+func (m *DisconnectMessage) UnmarshalJSON(data []byte) error {
+	mj, err := unmarshalJSONMessage(data, &m.MessageHeader, m.Type())
+	m.DisconnectReason = mj.DisconnectReason
+	return err
+}
+
+func (m PingMessage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.messageJSON(m.Type()))
+}
+
+func (m *PingMessage) UnmarshalJSON(data []byte) error {
+	_, err := unmarshalJSONMessage(data, &m.MessageHeader, m.Type())
+	return err
+}
+
+func (m PingResponse) MarshalJSON() ([]byte, error) {
+	mj := m.messageJSON(m.Type())
+	mj.setResult(m.result)
+	return json.Marshal(mj)
+}
+
+func (m *PingResponse) UnmarshalJSON(data []byte) error {
+	mj, err := unmarshalJSONMessage(data, &m.MessageHeader, m.Type())
+	m.result = mj.result()
+	return err
+}
+
+func (m GetConfigMessage) MarshalJSON() ([]byte, error) {
+	mj := m.messageJSON(m.Type())
+	mj.DesiredParameters = m.DesiredParameters
+	return json.Marshal(mj)
+}
+
+func (m *GetConfigMessage) UnmarshalJSON(data []byte) error {
+	mj, err := unmarshalJSONMessage(data, &m.MessageHeader, m.Type())
+	m.DesiredParameters = mj.DesiredParameters
+	return err
+}
+
+func (m GetConfigResponse) MarshalJSON() ([]byte, error) {
+	mj := m.messageJSON(m.Type())
+	mj.setResult(m.result)
+
+	var err error
+	if mj.Parameters, err = marshalParametersJSON(m.Parameters); err != nil {
+		return nil, err
+	}
+	return json.Marshal(mj)
+}
+
+func (m *GetConfigResponse) UnmarshalJSON(data []byte) error {
+	mj, err := unmarshalJSONMessage(data, &m.MessageHeader, m.Type())
+	if err != nil {
+		return err
+	}
+	m.result = mj.result()
+	m.Parameters, err = unmarshalParametersJSON(mj.Parameters)
+	return err
+}
+
+func (m AsyncStatusMessage) MarshalJSON() ([]byte, error) {
+	mj := m.messageJSON(m.Type())
+	mj.setResult(m.result)
+
+	var err error
+	if mj.Parameters, err = marshalParametersJSON(m.Parameters); err != nil {
+		return nil, err
+	}
+	return json.Marshal(mj)
+}
+
+func (m *AsyncStatusMessage) UnmarshalJSON(data []byte) error {
+	mj, err := unmarshalJSONMessage(data, &m.MessageHeader, m.Type())
+	if err != nil {
+		return err
+	}
+	m.result = mj.result()
+	m.Parameters, err = unmarshalParametersJSON(mj.Parameters)
+	return err
+}
+
+func (m SetConfigMessage) MarshalJSON() ([]byte, error) {
+	mj := m.messageJSON(m.Type())
+
+	var err error
+	if mj.Parameters, err = marshalParametersJSON(m.Parameters); err != nil {
+		return nil, err
+	}
+	return json.Marshal(mj)
+}
+
+func (m *SetConfigMessage) UnmarshalJSON(data []byte) error {
+	mj, err := unmarshalJSONMessage(data, &m.MessageHeader, m.Type())
+	if err != nil {
+		return err
+	}
+	m.Parameters, err = unmarshalParametersJSON(mj.Parameters)
+	return err
+}
+
+func (m SetConfigResponse) MarshalJSON() ([]byte, error) {
+	mj := m.messageJSON(m.Type())
+	mj.setResult(m.result)
+	mj.ParametersSet = &m.ParametersSet
+	return json.Marshal(mj)
+}
+
+func (m *SetConfigResponse) UnmarshalJSON(data []byte) error {
+	mj, err := unmarshalJSONMessage(data, &m.MessageHeader, m.Type())
+	m.result = mj.result()
+	if mj.ParametersSet != nil {
+		m.ParametersSet = *mj.ParametersSet
+	}
+	return err
+}
+
+func (m GetConfigListMessage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.messageJSON(m.Type()))
+}
+
+func (m *GetConfigListMessage) UnmarshalJSON(data []byte) error {
+	_, err := unmarshalJSONMessage(data, &m.MessageHeader, m.Type())
+	return err
+}
+
+func (m GetConfigListResponse) MarshalJSON() ([]byte, error) {
+	mj := m.messageJSON(m.Type())
+	mj.setResult(m.result)
+	mj.Configurations = m.Configurations
+	return json.Marshal(mj)
+}
+
+func (m *GetConfigListResponse) UnmarshalJSON(data []byte) error {
+	mj, err := unmarshalJSONMessage(data, &m.MessageHeader, m.Type())
+	m.result = mj.result()
+	m.Configurations = mj.Configurations
+	return err
+}
+
+func (m LoadConfigMessage) MarshalJSON() ([]byte, error) {
+	mj := m.messageJSON(m.Type())
+	mj.ConfigName = m.ConfigName
+	return json.Marshal(mj)
+}
+
+func (m *LoadConfigMessage) UnmarshalJSON(data []byte) error {
+	mj, err := unmarshalJSONMessage(data, &m.MessageHeader, m.Type())
+	m.ConfigName = mj.ConfigName
+	return err
+}
+
+func (m LoadConfigResponse) MarshalJSON() ([]byte, error) {
+	mj := m.messageJSON(m.Type())
+	mj.setResult(m.result)
+	mj.ParametersLoaded = &m.ParametersLoaded
+	return json.Marshal(mj)
+}
+
+func (m *LoadConfigResponse) UnmarshalJSON(data []byte) error {
+	mj, err := unmarshalJSONMessage(data, &m.MessageHeader, m.Type())
+	m.result = mj.result()
+	if mj.ParametersLoaded != nil {
+		m.ParametersLoaded = *mj.ParametersLoaded
+	}
+	return err
+}
+
+func (m SaveConfigMessage) MarshalJSON() ([]byte, error) {
+	mj := m.messageJSON(m.Type())
+	mj.ConfigName = m.ConfigName
+	return json.Marshal(mj)
+}
+
+func (m *SaveConfigMessage) UnmarshalJSON(data []byte) error {
+	mj, err := unmarshalJSONMessage(data, &m.MessageHeader, m.Type())
+	m.ConfigName = mj.ConfigName
+	return err
+}
+
+func (m SaveConfigResponse) MarshalJSON() ([]byte, error) {
+	mj := m.messageJSON(m.Type())
+	mj.setResult(m.result)
+	mj.ParametersSaved = &m.ParametersSaved
+	return json.Marshal(mj)
+}
+
+func (m *SaveConfigResponse) UnmarshalJSON(data []byte) error {
+	mj, err := unmarshalJSONMessage(data, &m.MessageHeader, m.Type())
+	m.result = mj.result()
+	if mj.ParametersSaved != nil {
+		m.ParametersSaved = *mj.ParametersSaved
+	}
+	return err
+}
+
+// argumentsJSON returns the JSON representation of the parameters of a,
+// which may be nil.
+func argumentsJSON(a *Arguments) ([]json.RawMessage, error) {
+	if a == nil {
+		return nil, nil
+	}
+	return marshalParametersJSON(a.Parameters)
+}
+
+func (m DirectiveMessage) MarshalJSON() ([]byte, error) {
+	mj := m.messageJSON(m.Type())
+	mj.DirectiveName = m.DirectiveName
+
+	var err error
+	if mj.Arguments, err = argumentsJSON(m.Arguments); err != nil {
+		return nil, err
+	}
+	return json.Marshal(mj)
+}
+
+func (m *DirectiveMessage) UnmarshalJSON(data []byte) error {
+	mj, err := unmarshalJSONMessage(data, &m.MessageHeader, m.Type())
+	if err != nil {
+		return err
+	}
+	m.DirectiveName = mj.DirectiveName
+
+	params, err := unmarshalParametersJSON(mj.Arguments)
+	m.Arguments = newArguments(params)
+	return err
+}
+
+func (m DirectiveResponse) MarshalJSON() ([]byte, error) {
+	mj := m.messageJSON(m.Type())
+	mj.setResult(m.result)
+	mj.DirectiveName = m.DirectiveName
+
+	var err error
+	if mj.ReturnValues, err = argumentsJSON(m.ReturnValues); err != nil {
+		return nil, err
+	}
+	return json.Marshal(mj)
+}
+
+func (m *DirectiveResponse) UnmarshalJSON(data []byte) error {
+	mj, err := unmarshalJSONMessage(data, &m.MessageHeader, m.Type())
+	if err != nil {
+		return err
+	}
+	m.result = mj.result()
+	m.DirectiveName = mj.DirectiveName
+
+	params, err := unmarshalParametersJSON(mj.ReturnValues)
+	m.ReturnValues = newArguments(params)
+	return err
+}
@@ -0,0 +1,683 @@
+package gemsV14
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+
+	gems "github.com/mitre/gems/src"
+)
+
+var (
+	timeType     = reflect.TypeFor[time.Time]()
+	gemsTimeType = reflect.TypeFor[gems.Time]()
+	bytesType    = reflect.TypeFor[[]byte]()
+)
+
+// A ParameterError describes a struct field that cannot be marshaled to, or
+// unmarshaled from, a GEMS parameter.
+type ParameterError struct {
+	Parameter string
+	Field     string
+	Msg       string
+}
+
+func (e *ParameterError) Error() string {
+	return fmt.Sprintf("gems: parameter '%s' (field %s): %s", e.Parameter, e.Field, e.Msg)
+}
+
+// MarshalParameters returns the GEMS parameters of the exported fields of
+// the struct v, in the order of the fields.
+//
+// The parameter of each field is configured by its "gems" struct tag,
+// which holds the parameter name followed by optional comma separated
+// options:
+//
+//	BitRates []int32   `gems:"BitRates,int"`
+//	Start    time.Time `gems:"StartTime,utime,omitempty"`
+//	Internal string    `gems:"-"`
+//
+// The name defaults to the field name. The datatype option is one of the
+// GEMS-ASCII type names, such as "int", "ulong" or "hex_value". Without it
+// the datatype follows from the Go type: string, bool, int8 (byte), uint8
+// (ubyte), int16 (short), uint16 (ushort), int32 (int), uint32 (uint), int
+// and int64 (long), uint and uint64 (ulong), float32 and float64 (double),
+// []byte (hex_value) and time.Time (time). Integers that do not fit the
+// datatype are reported with a ParameterError.
+//
+// Struct fields become ParameterSets and slices become array parameters
+// with a multiplicity. Fields of embedded structs without a tag are
+// marshaled as fields of the outer struct. The "omitempty" option skips
+// fields with a zero value, and nil pointers are always skipped.
+func MarshalParameters(v any) ([]gems.Parameter, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("gems: cannot marshal parameters from a nil pointer")
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("gems: cannot marshal parameters from %s", rv.Type())
+	}
+
+	values, err := marshalStruct(rv)
+	if err != nil {
+		return nil, err
+	}
+	params := make([]gems.Parameter, len(values))
+	for i, p := range values {
+		params[i] = p.(gems.Parameter)
+	}
+	return params, nil
+}
+
+// UnmarshalParameters stores the values of params in the fields of the
+// struct pointed to by v, using the struct tags described for
+// MarshalParameters. Parameters are matched to fields by name, preferring
+// an exact match but otherwise accepting a case-insensitive one.
+// Parameters without a matching field are ignored.
+//
+// Values are converted to the type of the field when they fit, so an int
+// parameter can be stored in any integer or float field. Any value can be
+// stored in a string field as its text. A mismatched value, or one that
+// overflows the field, is reported with a ParameterError.
+func UnmarshalParameters(params []gems.Parameter, v any) error {
+	rv := reflect.ValueOf(v)
+	if (rv.Kind() != reflect.Pointer) || rv.IsNil() || (rv.Elem().Kind() != reflect.Struct) {
+		return fmt.Errorf("gems: cannot unmarshal parameters into %T", v)
+	}
+	return unmarshalStruct(params, rv.Elem())
+}
+
+// structField is an exported field of a struct with its "gems" tag.
+type structField struct {
+	index     []int
+	field     string
+	name      string
+	datatype  gems.Datatype
+	omitEmpty bool
+}
+
+func structFields(t reflect.Type) ([]structField, error) {
+	var fields []structField
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag, tagged := f.Tag.Lookup("gems")
+		if tag == "-" {
+			continue
+		}
+		if f.Anonymous && !tagged && (f.Type.Kind() == reflect.Struct) {
+			embedded, err := structFields(f.Type)
+			if err != nil {
+				return nil, err
+			}
+			for _, e := range embedded {
+				e.index = append([]int{i}, e.index...)
+				fields = append(fields, e)
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+
+		sf := structField{index: []int{i}, field: t.Name() + "." + f.Name, name: f.Name}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name != "" {
+			sf.name = name
+		}
+		for _, opt := range strings.Split(opts, ",") {
+			switch opt {
+			case "":
+			case "omitempty":
+				sf.omitEmpty = true
+			default:
+				sf.datatype = gems.DatatypeFromASCII(opt)
+				if sf.datatype == gems.UndefinedType {
+					return nil, &ParameterError{Parameter: sf.name, Field: sf.field, Msg: fmt.Sprintf("unknown option '%s'", opt)}
+				}
+			}
+		}
+		fields = append(fields, sf)
+	}
+	return fields, nil
+}
+
+// datatypeOf returns the datatype a Go type marshals to by default.
+func datatypeOf(t reflect.Type) gems.Datatype {
+	switch t {
+	case timeType, gemsTimeType:
+		return gems.TimeType
+	case bytesType:
+		return gems.HexValueType
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return gems.StringType
+	case reflect.Bool:
+		return gems.BooleanType
+	case reflect.Int8:
+		return gems.ByteType
+	case reflect.Uint8:
+		return gems.UbyteType
+	case reflect.Int16:
+		return gems.ShortType
+	case reflect.Uint16:
+		return gems.UshortType
+	case reflect.Int32:
+		return gems.IntType
+	case reflect.Uint32:
+		return gems.UintType
+	case reflect.Int, reflect.Int64:
+		return gems.LongType
+	case reflect.Uint, reflect.Uint64:
+		return gems.UlongType
+	case reflect.Float32, reflect.Float64:
+		return gems.DoubleType
+	case reflect.Struct:
+		return gems.ParameterSetType
+	case reflect.Pointer:
+		return datatypeOf(t.Elem())
+	default:
+		return gems.UndefinedType
+	}
+}
+
+// isArray reports whether values of t marshal to an array parameter.
+func isArray(t reflect.Type) bool {
+	return ((t.Kind() == reflect.Slice) || (t.Kind() == reflect.Array)) && (t != bytesType)
+}
+
+func marshalStruct(sv reflect.Value) (ValueSlice, error) {
+	fields, err := structFields(sv.Type())
+	if err != nil {
+		return nil, err
+	}
+
+	values := ValueSlice{}
+	for _, f := range fields {
+		fv := sv.FieldByIndex(f.index)
+		if f.omitEmpty && fv.IsZero() {
+			continue
+		}
+		for fv.Kind() == reflect.Pointer {
+			if fv.IsNil() {
+				break
+			}
+			fv = fv.Elem()
+		}
+		if fv.Kind() == reflect.Pointer {
+			continue
+		}
+
+		p, err := marshalField(f, fv)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, p)
+	}
+	return values, nil
+}
+
+func marshalField(f structField, fv reflect.Value) (gems.XMLValue, error) {
+	if !isArray(fv.Type()) {
+		typ := f.datatype
+		if typ == gems.UndefinedType {
+			typ = datatypeOf(fv.Type())
+		}
+		if typ == gems.ParameterSetType {
+			children, err := marshalSet(f, fv)
+			if err != nil {
+				return nil, err
+			}
+			return &ParameterSet{name: f.name, Values: children}, nil
+		}
+
+		v, err := marshalValue(f, typ, fv)
+		if err != nil {
+			return nil, err
+		}
+		return &Parameter{name: f.name, Values: ValueSlice{v}}, nil
+	}
+
+	n := fv.Len()
+	typ := f.datatype
+	if typ == gems.UndefinedType {
+		typ = datatypeOf(fv.Type().Elem())
+	}
+
+	if typ == gems.ParameterSetType {
+		ps := &ParameterSet{name: f.name, Multiplicity: gems.NewNullInt32(n), Values: ValueSlice{}}
+		for i := range n {
+			children, err := marshalSet(f, fv.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			ps.Values = append(ps.Values, &ParameterSet{Values: children})
+		}
+		return ps, nil
+	}
+
+	p := &Parameter{name: f.name, Multiplicity: gems.NewNullInt32(n), Values: ValueSlice{}}
+	for i := range n {
+		v, err := marshalValue(f, typ, fv.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		p.Values = append(p.Values, v)
+	}
+	if n == 0 {
+		// An empty array carries a single empty value naming its datatype.
+		v, err := newValue(typ)
+		if err != nil {
+			return nil, &ParameterError{Parameter: f.name, Field: f.field, Msg: fmt.Sprintf("cannot marshal %s", fv.Type())}
+		}
+		p.Values = append(p.Values, v)
+	}
+	return p, nil
+}
+
+func marshalSet(f structField, v reflect.Value) (ValueSlice, error) {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return ValueSlice{}, nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, &ParameterError{Parameter: f.name, Field: f.field, Msg: fmt.Sprintf("cannot marshal %s as a ParameterSet", v.Type())}
+	}
+	return marshalStruct(v)
+}
+
+// integerRanges holds the limits of the integer datatypes.
+var integerRanges = map[gems.Datatype]struct {
+	min int64
+	max uint64
+}{
+	gems.ByteType:   {math.MinInt8, math.MaxInt8},
+	gems.UbyteType:  {0, math.MaxUint8},
+	gems.ShortType:  {math.MinInt16, math.MaxInt16},
+	gems.UshortType: {0, math.MaxUint16},
+	gems.IntType:    {math.MinInt32, math.MaxInt32},
+	gems.UintType:   {0, math.MaxUint32},
+	gems.LongType:   {math.MinInt64, math.MaxInt64},
+	gems.UlongType:  {0, math.MaxUint64},
+}
+
+func marshalValue(f structField, typ gems.Datatype, v reflect.Value) (gems.XMLValue, error) {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return newValue(typ)
+		}
+		v = v.Elem()
+	}
+	mismatch := &ParameterError{Parameter: f.name, Field: f.field, Msg: fmt.Sprintf("cannot marshal %s as %s", v.Type(), typ)}
+
+	switch typ {
+	case gems.StringType:
+		if v.Kind() != reflect.String {
+			return nil, mismatch
+		}
+		return newString(v.String()), nil
+	case gems.BooleanType:
+		if v.Kind() != reflect.Bool {
+			return nil, mismatch
+		}
+		return newBoolean(v.Bool()), nil
+	case gems.DoubleType:
+		if !v.CanFloat() {
+			return nil, mismatch
+		}
+		return newDouble(v.Float()), nil
+	case gems.HexValueType:
+		if v.Type() != bytesType {
+			return nil, mismatch
+		}
+		return &HexValue{Data: bytes.Clone(v.Bytes()), BitLength: 8 * v.Len()}, nil
+	case gems.TimeType, gems.UtimeType:
+		var t time.Time
+		switch v.Type() {
+		case timeType:
+			t = v.Interface().(time.Time)
+		case gemsTimeType:
+			t = v.Interface().(gems.Time).Time
+		default:
+			return nil, mismatch
+		}
+		if typ == gems.UtimeType {
+			return newUtime(t), nil
+		}
+		return newTimeValue(t), nil
+	}
+
+	limits, ok := integerRanges[typ]
+	if !ok {
+		return nil, mismatch
+	}
+
+	var (
+		i        int64
+		u        uint64
+		negative bool
+	)
+	switch {
+	case v.CanInt():
+		i = v.Int()
+		u, negative = uint64(i), i < 0
+	case v.CanUint():
+		u = v.Uint()
+		i = int64(u)
+	default:
+		return nil, mismatch
+	}
+	if (negative && (i < limits.min)) || (!negative && (u > limits.max)) {
+		var value any = u
+		if negative {
+			value = i
+		}
+		return nil, &ParameterError{Parameter: f.name, Field: f.field, Msg: fmt.Sprintf("value %d overflows %s", value, typ)}
+	}
+
+	switch typ {
+	case gems.ByteType:
+		return &Byte{Data: int8(i)}, nil
+	case gems.UbyteType:
+		return &Ubyte{Data: uint8(u)}, nil
+	case gems.ShortType:
+		return &Short{Data: int16(i)}, nil
+	case gems.UshortType:
+		return &Ushort{Data: uint16(u)}, nil
+	case gems.IntType:
+		return &Int{Data: int32(i)}, nil
+	case gems.UintType:
+		return &Uint{Data: uint32(u)}, nil
+	case gems.LongType:
+		return &Long{Data: i}, nil
+	default:
+		return &Ulong{Data: u}, nil
+	}
+}
+
+func unmarshalStruct(params []gems.Parameter, sv reflect.Value) error {
+	fields, err := structFields(sv.Type())
+	if err != nil {
+		return err
+	}
+
+	for _, p := range params {
+		f, ok := findField(fields, p.Name())
+		if !ok {
+			continue
+		}
+		fv, err := fieldByIndex(sv, f.index)
+		if err != nil {
+			return &ParameterError{Parameter: p.Name(), Field: f.field, Msg: err.Error()}
+		}
+		if err := unmarshalField(f, p, fv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func findField(fields []structField, name string) (structField, bool) {
+	for _, f := range fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.name, name) {
+			return f, true
+		}
+	}
+	return structField{}, false
+}
+
+// fieldByIndex returns the field of v at index, allocating the embedded
+// structs on its path.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 {
+			v = indirect(v)
+		}
+		v = v.Field(x)
+	}
+	if !v.CanSet() {
+		return v, fmt.Errorf("cannot set field")
+	}
+	return v, nil
+}
+
+// indirect follows the pointers from v, allocating any nil pointers.
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func unmarshalField(f structField, p gems.Parameter, fv reflect.Value) error {
+	fv = indirect(fv)
+	array := isArray(fv.Type())
+
+	switch p := p.(type) {
+	case *ParameterSet:
+		if !array {
+			if fv.Kind() != reflect.Struct {
+				return &ParameterError{Parameter: p.name, Field: f.field, Msg: fmt.Sprintf("cannot unmarshal ParameterSet into %s", fv.Type())}
+			}
+			return unmarshalStruct(setParameters(p.Values), fv)
+		}
+
+		values := p.Values
+		if p.Multiplicity.Valid && (p.Multiplicity.Int32 == 0) {
+			values = nil
+		}
+		s, err := makeArray(fv, len(values))
+		if err != nil {
+			return &ParameterError{Parameter: p.name, Field: f.field, Msg: err.Error()}
+		}
+		for i, v := range values {
+			child, ok := v.(*ParameterSet)
+			elem := indirect(s.Index(i))
+			if !ok || (elem.Kind() != reflect.Struct) {
+				return &ParameterError{Parameter: p.name, Field: f.field, Msg: fmt.Sprintf("cannot unmarshal ParameterSet into %s", fv.Type())}
+			}
+			if err := unmarshalStruct(setParameters(child.Values), elem); err != nil {
+				return err
+			}
+		}
+		fv.Set(s)
+		return nil
+	case *Parameter:
+		if (f.datatype != gems.UndefinedType) && (len(p.Values) > 0) && (p.ValueType() != f.datatype) {
+			return &ParameterError{Parameter: p.name, Field: f.field, Msg: fmt.Sprintf("parameter has type %s, want %s", p.ValueType(), f.datatype)}
+		}
+
+		values := p.Values
+		if p.Multiplicity.Valid && (p.Multiplicity.Int32 == 0) {
+			values = nil
+		}
+		if !array {
+			if len(values) > 1 {
+				return &ParameterError{Parameter: p.name, Field: f.field, Msg: fmt.Sprintf("cannot unmarshal %d values into %s", len(values), fv.Type())}
+			}
+			fv.SetZero()
+			if len(values) == 0 {
+				return nil
+			}
+			return unmarshalValue(f, p.name, values[0], fv)
+		}
+
+		s, err := makeArray(fv, len(values))
+		if err != nil {
+			return &ParameterError{Parameter: p.name, Field: f.field, Msg: err.Error()}
+		}
+		for i, v := range values {
+			if err := unmarshalValue(f, p.name, v, indirect(s.Index(i))); err != nil {
+				return err
+			}
+		}
+		fv.Set(s)
+		return nil
+	default:
+		return &ParameterError{Parameter: p.Name(), Field: f.field, Msg: fmt.Sprintf("unsupported parameter %T", p)}
+	}
+}
+
+// setParameters returns the parameters held by a ParameterSet.
+func setParameters(values ValueSlice) []gems.Parameter {
+	var params []gems.Parameter
+	for _, v := range values {
+		if p, ok := v.(gems.Parameter); ok {
+			params = append(params, p)
+		}
+	}
+	return params
+}
+
+// makeArray returns a new slice or array of the type of v to hold n
+// elements.
+func makeArray(v reflect.Value, n int) (reflect.Value, error) {
+	if v.Kind() == reflect.Array {
+		if n > v.Len() {
+			return v, fmt.Errorf("cannot unmarshal %d values into %s", n, v.Type())
+		}
+		return reflect.New(v.Type()).Elem(), nil
+	}
+	return reflect.MakeSlice(v.Type(), n, n), nil
+}
+
+func unmarshalValue(f structField, name string, v gems.XMLValue, dst reflect.Value) error {
+	mismatch := &ParameterError{Parameter: name, Field: f.field, Msg: fmt.Sprintf("cannot unmarshal %s into %s", v.Type(), dst.Type())}
+	overflow := &ParameterError{Parameter: name, Field: f.field, Msg: fmt.Sprintf("value %s overflows %s", v, dst.Type())}
+
+	var (
+		i        int64
+		u        uint64
+		negative bool
+	)
+	switch x := v.(type) {
+	case *String:
+		if dst.Kind() != reflect.String {
+			return mismatch
+		}
+		dst.SetString(x.Data)
+		return nil
+	case *Boolean:
+		switch dst.Kind() {
+		case reflect.Bool:
+			dst.SetBool(x.Data)
+		case reflect.String:
+			dst.SetString(x.String())
+		default:
+			return mismatch
+		}
+		return nil
+	case *Double:
+		switch {
+		case dst.CanFloat():
+			if dst.OverflowFloat(x.Data) {
+				return overflow
+			}
+			dst.SetFloat(x.Data)
+		case dst.Kind() == reflect.String:
+			dst.SetString(x.String())
+		default:
+			return mismatch
+		}
+		return nil
+	case *HexValue:
+		switch {
+		case dst.Type() == bytesType:
+			dst.SetBytes(bytes.Clone(x.Data))
+		case dst.Kind() == reflect.String:
+			dst.SetString(x.String())
+		default:
+			return mismatch
+		}
+		return nil
+	case *Time:
+		return unmarshalTime(x.Data, x.Empty, x.String(), dst, mismatch)
+	case *Utime:
+		return unmarshalTime(x.Data, x.Empty, x.String(), dst, mismatch)
+	case *Byte:
+		i = int64(x.Data)
+	case *Short:
+		i = int64(x.Data)
+	case *Int:
+		i = int64(x.Data)
+	case *Long:
+		i = x.Data
+	case *Ubyte:
+		u = uint64(x.Data)
+	case *Ushort:
+		u = uint64(x.Data)
+	case *Uint:
+		u = uint64(x.Data)
+	case *Ulong:
+		u = x.Data
+	default:
+		return mismatch
+	}
+
+	switch v.(type) {
+	case *Byte, *Short, *Int, *Long:
+		u, negative = uint64(i), i < 0
+	default:
+		i = int64(u)
+	}
+
+	switch {
+	case dst.CanInt():
+		if (!negative && (u > math.MaxInt64)) || dst.OverflowInt(i) {
+			return overflow
+		}
+		dst.SetInt(i)
+	case dst.CanUint():
+		if negative || dst.OverflowUint(u) {
+			return overflow
+		}
+		dst.SetUint(u)
+	case dst.CanFloat():
+		if negative {
+			dst.SetFloat(float64(i))
+		} else {
+			dst.SetFloat(float64(u))
+		}
+	case dst.Kind() == reflect.String:
+		dst.SetString(v.String())
+	default:
+		return mismatch
+	}
+	return nil
+}
+
+func unmarshalTime(t gems.Time, empty bool, text string, dst reflect.Value, mismatch error) error {
+	switch dst.Type() {
+	case timeType:
+		if !empty {
+			dst.Set(reflect.ValueOf(t.Time))
+		}
+	case gemsTimeType:
+		if !empty {
+			dst.Set(reflect.ValueOf(t))
+		}
+	default:
+		if dst.Kind() != reflect.String {
+			return mismatch
+		}
+		dst.SetString(text)
+	}
+	return nil
+}
@@ -26,6 +26,28 @@ func (GemsV14) ReceiveXMLMessage(data []byte, typ gems.MessageType) (gems.Messag
 	return receiveMessage(data, typ, xml.Unmarshal)
 }
 
+// DecodeXMLMessage decodes the message with the root element start from d.
+// If fn is not nil, the parameters of a GetConfigResponse or
+// AsyncStatusMessage are passed to fn as they are decoded instead of being
+// kept in the message, and decoding stops at the first error returned by
+// fn.
+func (GemsV14) DecodeXMLMessage(d *xml.Decoder, start xml.StartElement, fn func(gems.Parameter) error) (gems.Message, error) {
+	msg, err := newMessage(gems.MessageTypeFromXMLName(start.Name))
+	if err != nil {
+		return nil, err
+	}
+
+	if fn != nil {
+		switch m := msg.(type) {
+		case *GetConfigResponse:
+			return m, decodeXMLParameters(d, start, &m.MessageHeader, &m.result, fn)
+		case *AsyncStatusMessage:
+			return m, decodeXMLParameters(d, start, &m.MessageHeader, &m.result, fn)
+		}
+	}
+	return msg, d.DecodeElement(msg, &start)
+}
+
 func newMessage(typ gems.MessageType) (gems.Message, error) {
 	switch typ {
 	case gems.UnknownResponseType:
@@ -80,6 +102,57 @@ func receiveMessage(data []byte, typ gems.MessageType, unmarshalFunc func([]byte
 	return msg, err
 }
 
+// decodeXMLParameters decodes the header, result and parameters of a
+// GetConfigResponse or AsyncStatusMessage, passing each parameter to fn.
+func decodeXMLParameters(d *xml.Decoder, start xml.StartElement, h *MessageHeader, r *gems.Result, fn func(gems.Parameter) error) error {
+	if err := h.ExtractXMLAttrs(start); err != nil {
+		return err
+	}
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch se := t.(type) {
+		case xml.StartElement:
+			var p gems.XMLParameter
+
+			switch se.Name.Local {
+			case "Result":
+				if err := d.DecodeElement(&r.Code, &se); err != nil {
+					return err
+				}
+				continue
+			case "description":
+				if err := d.DecodeElement(&r.Description, &se); err != nil {
+					return err
+				}
+				continue
+			case "Parameter":
+				p = newEmptyParameter()
+			case "ParameterSet":
+				p = newEmptyParameterSet()
+			default:
+				if err := d.Skip(); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := d.DecodeElement(&p, &se); err != nil {
+				return err
+			}
+			if err := fn(p); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			if se == start.End() {
+				return nil
+			}
+		}
+	}
+}
+
 type MessageHeader struct {
 	target        string
 	timestamp     gems.Time
@@ -541,9 +614,10 @@ func (m PingMessage) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 }
 
 func (m *PingMessage) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
-	err := m.ExtractXMLAttrs(start)
-	d.Skip()
-	return err
+	if err := m.ExtractXMLAttrs(start); err != nil {
+		return err
+	}
+	return d.Skip()
 }
 
 func (m PingMessage) MarshalASCII(b *ascii.Buffer) error {
@@ -772,6 +846,10 @@ func (m GetConfigResponse) Result() gems.Result {
 	return m.result
 }
 
+func (m GetConfigResponse) ParameterList() []gems.Parameter {
+	return parameterList(m.Parameters)
+}
+
 func (m GetConfigResponse) Body() map[string]any {
 	body := m.result.Body()
 	parameters := make([]string, len(m.Parameters))
@@ -883,6 +961,10 @@ func (m AsyncStatusMessage) Result() gems.Result {
 	return m.result
 }
 
+func (m AsyncStatusMessage) ParameterList() []gems.Parameter {
+	return parameterList(m.Parameters)
+}
+
 func (m AsyncStatusMessage) Body() map[string]any {
 	body := m.result.Body()
 	parameters := make([]string, len(m.Parameters))
@@ -988,6 +1070,10 @@ func (m SetConfigMessage) Type() gems.MessageType {
 	return gems.SetConfigMessageType
 }
 
+func (m SetConfigMessage) ParameterList() []gems.Parameter {
+	return parameterList(m.Parameters)
+}
+
 func (m SetConfigMessage) Body() map[string]any {
 	body := make(map[string]any, 1)
 	parameters := make([]string, len(m.Parameters))
@@ -1185,9 +1271,10 @@ func (m GetConfigListMessage) MarshalXML(e *xml.Encoder, start xml.StartElement)
 }
 
 func (m *GetConfigListMessage) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
-	err := m.ExtractXMLAttrs(start)
-	d.Skip()
-	return err
+	if err := m.ExtractXMLAttrs(start); err != nil {
+		return err
+	}
+	return d.Skip()
 }
 
 func (m GetConfigListMessage) MarshalASCII(b *ascii.Buffer) error {
@@ -1639,6 +1726,14 @@ func newArguments(params []gems.XMLParameter) *Arguments {
 	}
 }
 
+// parameterList returns the parameters of the arguments, which may be nil.
+func (a *Arguments) parameterList() []gems.Parameter {
+	if a == nil {
+		return []gems.Parameter{}
+	}
+	return parameterList(a.Parameters)
+}
+
 func (a Arguments) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 	e.EncodeToken(start)
 	for _, p := range a.Parameters {
@@ -1710,6 +1805,10 @@ func (m DirectiveMessage) Type() gems.MessageType {
 	return gems.DirectiveMessageType
 }
 
+func (m DirectiveMessage) ParameterList() []gems.Parameter {
+	return m.Arguments.parameterList()
+}
+
 func (m DirectiveMessage) Body() map[string]any {
 	body := make(map[string]any, 2)
 	body["directive_name"] = m.DirectiveName
@@ -1825,6 +1924,10 @@ func (m DirectiveResponse) Result() gems.Result {
 	return m.result
 }
 
+func (m DirectiveResponse) ParameterList() []gems.Parameter {
+	return m.ReturnValues.parameterList()
+}
+
 func (m DirectiveResponse) Body() map[string]any {
 	body := m.result.Body()
 	body["directive_name"] = m.DirectiveName
@@ -1867,6 +1970,10 @@ func (m *DirectiveResponse) UnmarshalXML(d *xml.Decoder, start xml.StartElement)
 		switch se := t.(type) {
 		case xml.StartElement:
 			switch se.Name.Local {
+			case "Result":
+				d.DecodeElement(&m.result.Code, &se)
+			case "description":
+				d.DecodeElement(&m.result.Description, &se)
 			case "directive_name":
 				d.DecodeElement(&m.DirectiveName, &se)
 			case "return_values":
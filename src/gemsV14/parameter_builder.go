@@ -2,31 +2,68 @@ package gemsV14
 
 import (
 	"fmt"
+	"math"
 
 	gems "github.com/mitre/gems/src"
+	"github.com/mitre/gems/src/ascii"
 )
 
+// ParameterBuilder builds GEMS Parameters and ParameterSets. A value that
+// does not fit its datatype, or cannot be parsed, fails the Build.
 type ParameterBuilder struct {
 	name         string
 	multiplicity gems.NullInt32
 	values       ValueSlice
+	err          error
 }
 
 func NewParameterBuilder() *ParameterBuilder {
 	return &ParameterBuilder{}
 }
 
-func (pb *ParameterBuilder) Name(name string) *ParameterBuilder {
+func (GemsV14) NewParameterBuilder() gems.ParameterBuilder {
+	return NewParameterBuilder()
+}
+
+// checkRange records an error for the first of values outside the range
+// of typ, and reports whether all of them are in range.
+func (pb *ParameterBuilder) checkRange(typ gems.Datatype, values []int, lo int64, hi uint64) bool {
+	for _, v := range values {
+		if (int64(v) < lo) || ((v > 0) && (uint64(v) > hi)) {
+			if pb.err == nil {
+				pb.err = fmt.Errorf("build failed: %s value %d out of range [%d, %d]", typ, v, lo, hi)
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// checkUnsignedRange records an error for the first of values above the
+// largest value of typ, and reports whether all of them are in range.
+func (pb *ParameterBuilder) checkUnsignedRange(typ gems.Datatype, values []uint64, hi uint64) bool {
+	for _, v := range values {
+		if v > hi {
+			if pb.err == nil {
+				pb.err = fmt.Errorf("build failed: %s value %d out of range [0, %d]", typ, v, hi)
+			}
+			return false
+		}
+	}
+	return true
+}
+
+func (pb *ParameterBuilder) Name(name string) gems.ParameterBuilder {
 	pb.name = name
 	return pb
 }
 
-func (pb *ParameterBuilder) Multiplicity(i int) *ParameterBuilder {
+func (pb *ParameterBuilder) Multiplicity(i int) gems.ParameterBuilder {
 	pb.multiplicity = gems.NewNullInt32(i)
 	return pb
 }
 
-func (pb *ParameterBuilder) Parameters(values ...gems.Parameter) *ParameterBuilder {
+func (pb *ParameterBuilder) Parameters(values ...gems.Parameter) gems.ParameterBuilder {
 	nVals := len(values)
 	if nVals == 0 {
 		pb.values = append(pb.values, newEmptyParameter())
@@ -45,7 +82,7 @@ func (pb *ParameterBuilder) Parameters(values ...gems.Parameter) *ParameterBuild
 	return pb
 }
 
-func (pb *ParameterBuilder) String(values ...string) *ParameterBuilder {
+func (pb *ParameterBuilder) String(values ...string) gems.ParameterBuilder {
 	nVals := len(values)
 	if nVals == 0 {
 		pb.values = append(pb.values, newEmptyString())
@@ -60,7 +97,7 @@ func (pb *ParameterBuilder) String(values ...string) *ParameterBuilder {
 	return pb
 }
 
-func (pb *ParameterBuilder) Boolean(values ...bool) *ParameterBuilder {
+func (pb *ParameterBuilder) Boolean(values ...bool) gems.ParameterBuilder {
 	nVals := len(values)
 	if nVals == 0 {
 		pb.values = append(pb.values, newEmptyBoolean())
@@ -75,7 +112,11 @@ func (pb *ParameterBuilder) Boolean(values ...bool) *ParameterBuilder {
 	return pb
 }
 
-func (pb *ParameterBuilder) Byte(values ...int) *ParameterBuilder {
+func (pb *ParameterBuilder) Byte(values ...int) gems.ParameterBuilder {
+	if !pb.checkRange(gems.ByteType, values, math.MinInt8, math.MaxInt8) {
+		return pb
+	}
+
 	nVals := len(values)
 	if nVals == 0 {
 		pb.values = append(pb.values, newEmptyByte())
@@ -90,7 +131,11 @@ func (pb *ParameterBuilder) Byte(values ...int) *ParameterBuilder {
 	return pb
 }
 
-func (pb *ParameterBuilder) Ubyte(values ...int) *ParameterBuilder {
+func (pb *ParameterBuilder) Ubyte(values ...int) gems.ParameterBuilder {
+	if !pb.checkRange(gems.UbyteType, values, 0, math.MaxUint8) {
+		return pb
+	}
+
 	nVals := len(values)
 	if nVals == 0 {
 		pb.values = append(pb.values, newEmptyUbyte())
@@ -105,7 +150,11 @@ func (pb *ParameterBuilder) Ubyte(values ...int) *ParameterBuilder {
 	return pb
 }
 
-func (pb *ParameterBuilder) Short(values ...int) *ParameterBuilder {
+func (pb *ParameterBuilder) Short(values ...int) gems.ParameterBuilder {
+	if !pb.checkRange(gems.ShortType, values, math.MinInt16, math.MaxInt16) {
+		return pb
+	}
+
 	nVals := len(values)
 	if nVals == 0 {
 		pb.values = append(pb.values, newEmptyShort())
@@ -120,7 +169,11 @@ func (pb *ParameterBuilder) Short(values ...int) *ParameterBuilder {
 	return pb
 }
 
-func (pb *ParameterBuilder) Ushort(values ...int) *ParameterBuilder {
+func (pb *ParameterBuilder) Ushort(values ...int) gems.ParameterBuilder {
+	if !pb.checkRange(gems.UshortType, values, 0, math.MaxUint16) {
+		return pb
+	}
+
 	nVals := len(values)
 	if nVals == 0 {
 		pb.values = append(pb.values, newEmptyUshort())
@@ -135,7 +188,11 @@ func (pb *ParameterBuilder) Ushort(values ...int) *ParameterBuilder {
 	return pb
 }
 
-func (pb *ParameterBuilder) Int(values ...int) *ParameterBuilder {
+func (pb *ParameterBuilder) Int(values ...int) gems.ParameterBuilder {
+	if !pb.checkRange(gems.IntType, values, math.MinInt32, math.MaxInt32) {
+		return pb
+	}
+
 	nVals := len(values)
 	if nVals == 0 {
 		pb.values = append(pb.values, newEmptyInt())
@@ -150,7 +207,11 @@ func (pb *ParameterBuilder) Int(values ...int) *ParameterBuilder {
 	return pb
 }
 
-func (pb *ParameterBuilder) Uint(values ...int) *ParameterBuilder {
+func (pb *ParameterBuilder) Uint(values ...uint64) gems.ParameterBuilder {
+	if !pb.checkUnsignedRange(gems.UintType, values, math.MaxUint32) {
+		return pb
+	}
+
 	nVals := len(values)
 	if nVals == 0 {
 		pb.values = append(pb.values, newEmptyUint())
@@ -165,7 +226,11 @@ func (pb *ParameterBuilder) Uint(values ...int) *ParameterBuilder {
 	return pb
 }
 
-func (pb *ParameterBuilder) Long(values ...int) *ParameterBuilder {
+func (pb *ParameterBuilder) Long(values ...int) gems.ParameterBuilder {
+	if !pb.checkRange(gems.LongType, values, math.MinInt64, math.MaxInt64) {
+		return pb
+	}
+
 	nVals := len(values)
 	if nVals == 0 {
 		pb.values = append(pb.values, newEmptyLong())
@@ -180,7 +245,7 @@ func (pb *ParameterBuilder) Long(values ...int) *ParameterBuilder {
 	return pb
 }
 
-func (pb *ParameterBuilder) Ulong(values ...int) *ParameterBuilder {
+func (pb *ParameterBuilder) Ulong(values ...uint64) gems.ParameterBuilder {
 	nVals := len(values)
 	if nVals == 0 {
 		pb.values = append(pb.values, newEmptyUlong())
@@ -195,7 +260,7 @@ func (pb *ParameterBuilder) Ulong(values ...int) *ParameterBuilder {
 	return pb
 }
 
-func (pb *ParameterBuilder) Double(values ...float64) *ParameterBuilder {
+func (pb *ParameterBuilder) Double(values ...float64) gems.ParameterBuilder {
 	nVals := len(values)
 	if nVals == 0 {
 		pb.values = append(pb.values, newEmptyDouble())
@@ -210,7 +275,7 @@ func (pb *ParameterBuilder) Double(values ...float64) *ParameterBuilder {
 	return pb
 }
 
-func (pb *ParameterBuilder) HexValue(values ...string) *ParameterBuilder {
+func (pb *ParameterBuilder) HexValue(values ...string) gems.ParameterBuilder {
 	nVals := len(values)
 	if nVals == 0 {
 		pb.values = append(pb.values, newEmptyHexValue())
@@ -219,13 +284,23 @@ func (pb *ParameterBuilder) HexValue(values ...string) *ParameterBuilder {
 
 	vs := make(ValueSlice, nVals)
 	for i := range nVals {
-		vs[i] = newHexValueFromASCII(values[i])
+		v, err := newValue(gems.HexValueType)
+		if err == nil {
+			err = ascii.Unmarshal([]byte(values[i]), v)
+		}
+		if err != nil {
+			if pb.err == nil {
+				pb.err = fmt.Errorf("build failed: invalid %s value '%s': %w", gems.HexValueType, values[i], err)
+			}
+			return pb
+		}
+		vs[i] = v
 	}
 	pb.values = vs
 	return pb
 }
 
-func (pb *ParameterBuilder) Time(values ...string) *ParameterBuilder {
+func (pb *ParameterBuilder) Time(values ...string) gems.ParameterBuilder {
 	nVals := len(values)
 	if nVals == 0 {
 		pb.values = append(pb.values, newEmptyTimeValue())
@@ -234,13 +309,23 @@ func (pb *ParameterBuilder) Time(values ...string) *ParameterBuilder {
 
 	vs := make(ValueSlice, nVals)
 	for i := range nVals {
-		vs[i] = newTimeValueFromString(values[i])
+		v, err := newValue(gems.TimeType)
+		if err == nil {
+			err = ascii.Unmarshal([]byte(values[i]), v)
+		}
+		if err != nil {
+			if pb.err == nil {
+				pb.err = fmt.Errorf("build failed: invalid %s value '%s': %w", gems.TimeType, values[i], err)
+			}
+			return pb
+		}
+		vs[i] = v
 	}
 	pb.values = vs
 	return pb
 }
 
-func (pb *ParameterBuilder) Utime(values ...string) *ParameterBuilder {
+func (pb *ParameterBuilder) Utime(values ...string) gems.ParameterBuilder {
 	nVals := len(values)
 	if nVals == 0 {
 		pb.values = append(pb.values, newEmptyUtime())
@@ -249,13 +334,27 @@ func (pb *ParameterBuilder) Utime(values ...string) *ParameterBuilder {
 
 	vs := make(ValueSlice, nVals)
 	for i := range nVals {
-		vs[i] = newUtimeFromString(values[i])
+		v, err := newValue(gems.UtimeType)
+		if err == nil {
+			err = ascii.Unmarshal([]byte(values[i]), v)
+		}
+		if err != nil {
+			if pb.err == nil {
+				pb.err = fmt.Errorf("build failed: invalid %s value '%s': %w", gems.UtimeType, values[i], err)
+			}
+			return pb
+		}
+		vs[i] = v
 	}
 	pb.values = vs
 	return pb
 }
 
 func (pb *ParameterBuilder) Build() (gems.Parameter, error) {
+	if pb.err != nil {
+		return &Parameter{}, pb.err
+	}
+
 	nValues := len(pb.values)
 	vs := make(ValueSlice, nValues)
 
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	gems "github.com/mitre/gems/src"
 	"github.com/mitre/gems/src/ascii"
@@ -67,6 +68,14 @@ func unmarshalParameterSliceASCII(fields [][]byte) ([]gems.XMLParameter, error)
 	return params, nil
 }
 
+func parameterList(params []gems.XMLParameter) []gems.Parameter {
+	list := make([]gems.Parameter, len(params))
+	for i, p := range params {
+		list[i] = p
+	}
+	return list
+}
+
 // Parameter is a representation of a GEMS Parameter
 // as defined by Version 1.4 of the GEMS specification.
 type Parameter struct {
@@ -289,6 +298,45 @@ func (p Parameter) Validate() error {
 	return nil
 }
 
+// values returns the values of the parameter, which are none for an array
+// of multiplicity 0 despite the empty value naming its datatype.
+func (p Parameter) values() ValueSlice {
+	if p.Multiplicity.Valid && (p.Multiplicity.Int32 == 0) {
+		return ValueSlice{}
+	}
+	return p.Values
+}
+
+func (p Parameter) Int64s() ([]int64, error) {
+	return p.values().int64s(p.name)
+}
+
+func (p Parameter) Float64s() ([]float64, error) {
+	return p.values().float64s(p.name)
+}
+
+func (p Parameter) Strings() ([]string, error) {
+	return p.values().strings(p.name)
+}
+
+func (p Parameter) Bools() ([]bool, error) {
+	return p.values().bools(p.name)
+}
+
+func (p Parameter) Bytes() ([][]byte, error) {
+	return p.values().bytes(p.name)
+}
+
+func (p Parameter) Times() ([]time.Time, error) {
+	return p.values().times(p.name)
+}
+
+// Children returns a *gems.ConversionError, since a Parameter holds values
+// rather than parameters.
+func (p Parameter) Children() ([]gems.Parameter, error) {
+	return nil, &gems.ConversionError{Parameter: p.name, Datatype: p.ValueType(), GoType: "[]gems.Parameter"}
+}
+
 func (a Parameter) String() string {
 	var b ascii.Buffer
 	a.MarshalASCII(&b)
@@ -501,8 +549,10 @@ func (ps ParameterSet) Validate() error {
 		return fmt.Errorf("ParameterSet name cannot contain spaces")
 	}
 
+	// The values of a scalar ParameterSet are its member Parameters; only
+	// an array ParameterSet holds several ParameterSets.
 	nValues := len(ps.Values)
-	if !ps.Multiplicity.Valid && (nValues > 1) {
+	if !ps.Multiplicity.Valid && (nValues > 1) && (ps.ValueType() == gems.ParameterSetType) {
 		return fmt.Errorf("scalar ParameterSet contains multiple values")
 	}
 
@@ -528,6 +578,52 @@ func (ps ParameterSet) Validate() error {
 	return nil
 }
 
+func (ps ParameterSet) values() ValueSlice {
+	if ps.Multiplicity.Valid && (ps.Multiplicity.Int32 == 0) {
+		return ValueSlice{}
+	}
+	return ps.Values
+}
+
+func (ps ParameterSet) Int64s() ([]int64, error) {
+	return ps.values().int64s(ps.name)
+}
+
+func (ps ParameterSet) Float64s() ([]float64, error) {
+	return ps.values().float64s(ps.name)
+}
+
+func (ps ParameterSet) Strings() ([]string, error) {
+	return ps.values().strings(ps.name)
+}
+
+func (ps ParameterSet) Bools() ([]bool, error) {
+	return ps.values().bools(ps.name)
+}
+
+func (ps ParameterSet) Bytes() ([][]byte, error) {
+	return ps.values().bytes(ps.name)
+}
+
+func (ps ParameterSet) Times() ([]time.Time, error) {
+	return ps.values().times(ps.name)
+}
+
+// Children returns the parameters of a scalar ParameterSet, or the unnamed
+// ParameterSets making up the elements of an array ParameterSet.
+func (ps ParameterSet) Children() ([]gems.Parameter, error) {
+	values := ps.values()
+	children := make([]gems.Parameter, 0, len(values))
+	for _, v := range values {
+		p, ok := v.(gems.Parameter)
+		if !ok {
+			return nil, &gems.ConversionError{Parameter: ps.name, Datatype: v.Type(), GoType: "gems.Parameter"}
+		}
+		children = append(children, p)
+	}
+	return children, nil
+}
+
 func (ps ParameterSet) String() string {
 	var b ascii.Buffer
 	ps.MarshalASCII(&b)
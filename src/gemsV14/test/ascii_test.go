@@ -1,11 +1,15 @@
 package gemsV14_test
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"reflect"
 	"strings"
 	"testing"
+	"testing/iotest"
 
+	gems "github.com/mitre/gems/src"
 	"github.com/mitre/gems/src/ascii"
 	"github.com/mitre/gems/src/gemsV14"
 )
@@ -126,3 +130,125 @@ func TestASCIIUnmarshal(t *testing.T) {
 		})
 	}
 }
+
+// frame returns a GEMS-ASCII message with the given body and a valid
+// length field.
+func frame(body string) string {
+	return fmt.Sprintf("|GEMS|14|%010d|%sEND", 20+len(body)+len("END"), body)
+}
+
+var (
+	pingFrame = frame("1|token|1410819035.26|Target|PING|")
+	bigFrame  = frame("1|token|1410819035.26|Target|" + strings.Repeat("X", 100*1024) + "|")
+)
+
+var decoderTests = []struct {
+	Stream  string
+	MaxSize int
+	Expect  []string // messages, or "error: " followed by a part of the error
+}{
+	{Stream: "", Expect: nil},
+	{Stream: pingFrame + pingFrame, Expect: []string{pingFrame, pingFrame}},
+	{Stream: "\r\n" + pingFrame + "\n " + pingFrame + "\n", Expect: []string{pingFrame, pingFrame}},
+	{Stream: bigFrame + pingFrame, Expect: []string{bigFrame, pingFrame}},
+	{Stream: bigFrame + pingFrame, MaxSize: 1024, Expect: []string{"error: exceeds maximum 1024", pingFrame}},
+	{Stream: "garbage" + pingFrame, Expect: []string{"error: offset 0, invalid start", pingFrame}},
+	{Stream: pingFrame + "|GEMS|14|00000000X9|junk|END" + pingFrame, Expect: []string{pingFrame, "error: invalid message header", pingFrame}},
+	{Stream: "|GEMS|14|0000000010|" + pingFrame, Expect: []string{"error: invalid message length 10", pingFrame}},
+	{Stream: strings.Replace(pingFrame, "|END", "|EN", 1) + pingFrame, Expect: []string{"error: missing message trailer", pingFrame}},
+	{Stream: "|GEMS|14|0000009999|1|token|END" + pingFrame, Expect: []string{"error: interrupted by the start of another", pingFrame}},
+	{Stream: "|GEMS|14|0000009999|1|token|END", Expect: []string{"error: unexpected EOF"}},
+	{Stream: pingFrame[:30], Expect: []string{"error: partial GEMS-ASCII message"}},
+	{Stream: pingFrame + pingFrame[:10], Expect: []string{pingFrame, "error: partial GEMS-ASCII message"}},
+}
+
+func TestASCIIDecoder(t *testing.T) {
+	for i, test := range decoderTests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			// Deliver the stream a few bytes at a time to exercise buffering.
+			d := ascii.NewDecoder(iotest.OneByteReader(strings.NewReader(test.Stream)))
+			if test.MaxSize > 0 {
+				d.SetMaxMessageSize(test.MaxSize)
+			}
+
+			var got []string
+			for len(got) <= len(test.Expect) {
+				msg, err := d.Decode()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					got = append(got, "error: "+err.Error())
+					var syncErr *ascii.SyncError
+					if !errors.As(err, &syncErr) {
+						break
+					}
+					continue
+				}
+				got = append(got, string(msg))
+			}
+
+			if len(got) != len(test.Expect) {
+				t.Fatalf("decode(%.60q): have %d results %.200q, want %d", test.Stream, len(got), got, len(test.Expect))
+			}
+			for j := range got {
+				want := test.Expect[j]
+				if strings.HasPrefix(want, "error: ") {
+					if !strings.HasPrefix(got[j], "error: ") || !strings.Contains(got[j], strings.TrimPrefix(want, "error: ")) {
+						t.Errorf("decode(%.60q)[%d]: have %.100q, want %q", test.Stream, j, got[j], want)
+					}
+					continue
+				}
+				if got[j] != want {
+					t.Errorf("decode(%.60q)[%d]: have %.100q, want %.100q", test.Stream, j, got[j], want)
+				}
+			}
+		})
+	}
+}
+
+func TestASCIIEncoder(t *testing.T) {
+	var b strings.Builder
+	e := ascii.NewEncoder(&b)
+	for _, m := range []ascii.Marshaler{connectMessage, directiveMessage} {
+		if err := e.Encode(m); err != nil {
+			t.Fatalf("encode(%#v): %s", m, err)
+		}
+	}
+
+	d := ascii.NewDecoder(strings.NewReader(b.String()))
+	for _, want := range []any{connectMessage, directiveMessage} {
+		data, err := d.Decode()
+		if err != nil {
+			t.Fatalf("decode: %s", err)
+		}
+		got, err := gems.ReceiveASCIIMessage(data, v)
+		if err != nil {
+			t.Fatalf("receive(%q): %s", data, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("decode:\nhave: %#v\nwant: %#v", got, want)
+		}
+	}
+}
+
+func TestASCIIEncoderMaxMessageSize(t *testing.T) {
+	var b strings.Builder
+	e := ascii.NewEncoder(&b)
+	e.SetMaxMessageSize(100)
+	// The ConnectionRequestMessage is 85 bytes and the DirectiveMessage 123.
+	if err := e.Encode(connectMessage); err != nil {
+		t.Fatalf("encode: %s", err)
+	}
+	err := e.Encode(directiveMessage)
+	if (err == nil) || !strings.Contains(err.Error(), "message length 123 exceeds maximum 100") {
+		t.Errorf("incorrect error: %v", err)
+	}
+	var marshalErr *ascii.MarshalError
+	if !errors.As(err, &marshalErr) {
+		t.Errorf("incorrect error type %T", err)
+	}
+	if data, _ := ascii.Marshal(connectMessage); b.String() != string(data) {
+		t.Errorf("incorrect stream: %q", b.String())
+	}
+}
@@ -0,0 +1,209 @@
+package gemsV14_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	gems "github.com/mitre/gems/src"
+	"github.com/mitre/gems/src/ascii"
+)
+
+func TestCombinedServer(t *testing.T) {
+	server := gems.NewCombinedServer("", namedHandler("device"), gems.BodyFormatter{}, v, "")
+	server.Start()
+	defer server.Close()
+
+	clients := map[string]*gems.Client{}
+	for _, psm := range []string{"ascii", "xml"} {
+		client, err := gems.NewClient(v, psm, gems.DefaultFormatter{})
+		if err != nil {
+			t.Fatalf("%s: client error: %s", psm, err)
+		}
+		if err := client.Connect(server.Addr(), gems.ConnectionTypeControlAndStatus, "", target); err != nil {
+			t.Fatalf("%s: connect error: %s", psm, err)
+		}
+		clients[psm] = client
+
+		resp, err := client.Ping()
+		if err != nil {
+			t.Fatalf("%s: ping error: %s", psm, err)
+		}
+		if (resp.Type() != gems.PingResponseType) || (resp.Result().Description != "device") {
+			t.Errorf("%s: incorrect response: %s", psm, client.Format(resp))
+		}
+	}
+
+	// The sessions of both PSMs are held in one registry.
+	sessions := server.Sessions()
+	var psms []string
+	for _, sess := range sessions {
+		psms = append(psms, sess.PSM)
+		if !sess.Connected || (sess.Target != target) {
+			t.Errorf("%s: incorrect session %+v", sess.PSM, sess)
+		}
+	}
+	sort.Strings(psms)
+	if strings.Join(psms, ",") != "ascii,xml" {
+		t.Fatalf("incorrect session PSMs: %v", psms)
+	}
+
+	for _, sess := range sessions {
+		if sess.PSM != "ascii" {
+			continue
+		}
+		if err := server.CloseSession(sess.ID); err != nil {
+			t.Fatalf("close session error: %s", err)
+		}
+	}
+	if _, err := clients["ascii"].Ping(); err == nil {
+		t.Error("expected ping on the closed session to fail")
+	}
+	if _, err := clients["xml"].Ping(); err != nil {
+		t.Errorf("xml: ping error after closing the ascii session: %s", err)
+	}
+}
+
+// writeSlowly writes data to conn in two parts, the first shorter than
+// the prefix that identifies the PSM.
+func writeSlowly(t *testing.T, conn net.Conn, data []byte) {
+	t.Helper()
+
+	for _, part := range [][]byte{data[:2], data[2:]} {
+		if _, err := conn.Write(part); err != nil {
+			t.Fatalf("write error: %s", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestCombinedServerSlowPrefix(t *testing.T) {
+	server := gems.NewCombinedServer("", namedHandler("device"), gems.BodyFormatter{}, v, "")
+	server.Start()
+	defer server.Close()
+
+	m, err := v.NewMessageBuilder().Type(gems.ConnectMessageType).ConnectionType(gems.ConnectionTypeControlAndStatus).
+		Target(target).TransactionID(1).Build()
+	if err != nil {
+		t.Fatalf("build error: %s", err)
+	}
+
+	t.Run("ascii", func(t *testing.T) {
+		conn, err := net.Dial("tcp", server.Addr())
+		if err != nil {
+			t.Fatalf("dial error: %s", err)
+		}
+		defer conn.Close()
+
+		data, err := ascii.Marshal(m)
+		if err != nil {
+			t.Fatalf("marshal error: %s", err)
+		}
+		writeSlowly(t, conn, data)
+
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		var resp []byte
+		buf := make([]byte, 1024)
+		for !bytes.HasSuffix(resp, []byte("|END")) {
+			n, err := conn.Read(buf)
+			if err != nil {
+				t.Fatalf("read error after %q: %s", resp, err)
+			}
+			resp = append(resp, buf[:n]...)
+		}
+		if !bytes.HasPrefix(resp, []byte("|GEMS|")) || !bytes.Contains(resp, []byte("|CON-R|SUCCESS|")) {
+			t.Errorf("incorrect response %q", resp)
+		}
+	})
+
+	t.Run("xml", func(t *testing.T) {
+		conn, err := net.Dial("tcp", server.Addr())
+		if err != nil {
+			t.Fatalf("dial error: %s", err)
+		}
+		defer conn.Close()
+
+		body, err := xml.Marshal(m)
+		if err != nil {
+			t.Fatalf("marshal error: %s", err)
+		}
+		req := fmt.Sprintf("POST / HTTP/1.1\r\nHost: device\r\nContent-Type: text/xml\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+		writeSlowly(t, conn, []byte(req))
+
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatalf("read error: %s", err)
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("read error: %s", err)
+		}
+		if (resp.StatusCode != http.StatusOK) || !bytes.Contains(data, []byte("SUCCESS")) {
+			t.Errorf("incorrect response %s %q", resp.Status, data)
+		}
+	})
+}
+
+var unknownPrefixTests = []struct {
+	Name string
+	Data string
+}{
+	{Name: "text", Data: "HELLO WORLD\r\n"},
+	{Name: "lower case ascii", Data: "|gems|14|"},
+	{Name: "method without space", Data: "GETX / HTTP/1.1\r\n"},
+	{Name: "binary", Data: "\x00\x00\x01\x00<GEMS>"},
+}
+
+func TestCombinedServerUnknownPrefix(t *testing.T) {
+	server := gems.NewCombinedServer("", namedHandler("device"), gems.BodyFormatter{}, v, "")
+	server.Start()
+	defer server.Close()
+
+	for _, test := range unknownPrefixTests {
+		t.Run(test.Name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", server.Addr())
+			if err != nil {
+				t.Fatalf("dial error: %s", err)
+			}
+			defer conn.Close()
+
+			conn.Write([]byte(test.Data))
+			conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			if data, err := io.ReadAll(conn); (err != nil) || (len(data) > 0) {
+				t.Errorf("connection was not closed: read %q, %v", data, err)
+			}
+		})
+	}
+
+	// A connection closed before sending a whole prefix is dropped too.
+	conn, err := net.Dial("tcp", server.Addr())
+	if err != nil {
+		t.Fatalf("dial error: %s", err)
+	}
+	conn.Write([]byte("|GE"))
+	conn.Close()
+
+	// None of the connections opened a session, and the server still
+	// accepts clients.
+	if sessions := server.Sessions(); len(sessions) != 0 {
+		t.Errorf("unexpected sessions: %+v", sessions)
+	}
+	client, err := gems.NewClient(v, "ascii", gems.DefaultFormatter{})
+	if err != nil {
+		t.Fatalf("client error: %s", err)
+	}
+	if err := client.Connect(server.Addr(), gems.ConnectionTypeControlAndStatus, "", target); err != nil {
+		t.Fatalf("connect error: %s", err)
+	}
+	client.Disconnect(gems.DisconnectReasonNormalTermination)
+}
@@ -0,0 +1,116 @@
+package gemsV14_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	gems "github.com/mitre/gems/src"
+)
+
+var resultCodeErrorTests = []struct {
+	Code   gems.ResultCode
+	Expect error
+}{
+	{Code: gems.ResultCodeSuccess, Expect: nil},
+	{Code: gems.ResultCodeInvalidRange, Expect: gems.ErrInvalidRange},
+	{Code: gems.ResultCodeInvalidParameter, Expect: gems.ErrInvalidParameter},
+	{Code: gems.ResultCodeInvalidState, Expect: gems.ErrInvalidState},
+	{Code: gems.ResultCodeInvalidVersion, Expect: gems.ErrInvalidVersion},
+	{Code: gems.ResultCodeInvalidTarget, Expect: gems.ErrInvalidTarget},
+	{Code: gems.ResultCodeConflictingParameter, Expect: gems.ErrConflictingParameter},
+	{Code: gems.ResultCodeConflictingValues, Expect: gems.ErrConflictingValues},
+	{Code: gems.ResultCodeUnsupportedMessage, Expect: gems.ErrUnsupportedMessage},
+	{Code: gems.ResultCodeMalformedMessage, Expect: gems.ErrMalformedMessage},
+	{Code: gems.ResultCodeCommunicationError, Expect: gems.ErrCommunicationError},
+	{Code: gems.ResultCodeInternalError, Expect: gems.ErrInternalError},
+	{Code: gems.ResultCodeAccessDenied, Expect: gems.ErrAccessDenied},
+	{Code: gems.ResultCodeOther, Expect: gems.ErrOther},
+	{Code: gems.ResultCode("VENDOR_SPECIFIC"), Expect: gems.ErrOther},
+}
+
+func TestResultCodeErr(t *testing.T) {
+	for _, test := range resultCodeErrorTests {
+		t.Run(string(test.Code), func(t *testing.T) {
+			if have := test.Code.Err(); have != test.Expect {
+				t.Errorf("incorrect error: have %v, want %v", have, test.Expect)
+			}
+		})
+	}
+}
+
+// pingHandler fails every PingMessage with INVALID_STATE.
+func pingHandler(m gems.Message, v gems.Version) (gems.Response, error) {
+	msg, err := v.NewMessageBuilder().Type(m.Type().ResponseType()).TransactionID(m.TransactionID().Int64).
+		ResultCode(gems.ResultCodeInvalidState).ResponseDescription("Device is busy").Build()
+	if err != nil {
+		return nil, err
+	}
+	resp, _ := msg.(gems.Response)
+	return resp, nil
+}
+
+var clientErrorServers = map[string]func(gems.MessageHandler, string) gems.Server{
+	"ascii": func(h gems.MessageHandler, token string) gems.Server {
+		return gems.NewASCIIServer("", h, gems.BodyFormatter{}, v, token)
+	},
+	"xml": func(h gems.MessageHandler, token string) gems.Server {
+		return gems.NewXMLServer("", h, gems.BodyFormatter{}, v, token)
+	},
+	"xml-tcp": func(h gems.MessageHandler, token string) gems.Server {
+		return gems.NewXMLTCPServer("", h, gems.BodyFormatter{}, v, token)
+	},
+}
+
+func newPipeClient(t *testing.T, psm string, token string) *gems.Client {
+	server := clientErrorServers[psm](pingHandler, token)
+	server.Start()
+	t.Cleanup(server.Close)
+	transport, err := gems.NewPipeTransport(psm, server)
+	if err != nil {
+		t.Fatalf("transport error: %s", err)
+	}
+	client, err := gems.NewClient(v, psm, gems.DefaultFormatter{}, gems.WithTransport(transport))
+	if err != nil {
+		t.Fatalf("client error: %s", err)
+	}
+	return client
+}
+
+func TestClientResponseError(t *testing.T) {
+	for psm := range clientErrorServers {
+		t.Run(psm, func(t *testing.T) {
+			client := newPipeClient(t, psm, "secret")
+			err := client.Connect("device", gems.ConnectionTypeControlAndStatus, "wrong", target)
+			if !errors.Is(err, gems.ErrAccessDenied) {
+				t.Errorf("incorrect connect error: have %v, want %v", err, gems.ErrAccessDenied)
+			}
+
+			client = newPipeClient(t, psm, "")
+			if err := client.Connect("device", gems.ConnectionTypeControlAndStatus, "", target); err != nil {
+				t.Fatalf("connect error: %s", err)
+			}
+			defer client.Disconnect(gems.DisconnectReasonNormalTermination)
+
+			resp, err := client.Ping()
+			if !errors.Is(err, gems.ErrInvalidState) {
+				t.Errorf("incorrect ping error: have %v, want %v", err, gems.ErrInvalidState)
+			}
+
+			var respErr *gems.ResponseError
+			if !errors.As(err, &respErr) {
+				t.Fatalf("ping error %v is not a *gems.ResponseError", err)
+			}
+			want := gems.Result{Code: gems.ResultCodeInvalidState, Description: "Device is busy"}
+			if respErr.Result != want {
+				t.Errorf("incorrect result: have %v, want %v", respErr.Result, want)
+			}
+			if (resp == nil) || (respErr.Response != resp) {
+				t.Errorf("incorrect response: have %v, want %v", respErr.Response, resp)
+			}
+			if have := fmt.Sprint(err); have != "gems response: INVALID_STATE, Device is busy" {
+				t.Errorf("incorrect message: %s", have)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package gemsV14_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gems "github.com/mitre/gems/src"
+)
+
+// eventLog collects the JSON lines written by a JSONEventWriter.
+type eventLog struct {
+	buf bytes.Buffer
+	mu  sync.Mutex
+}
+
+func (l *eventLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.Write(p)
+}
+
+// events decodes the logged events, waiting until n have been written.
+func (l *eventLog) events(t *testing.T, n int) []map[string]any {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		l.mu.Lock()
+		lines := strings.Split(strings.TrimSpace(l.buf.String()), "\n")
+		l.mu.Unlock()
+
+		if len(lines) >= n || time.Now().After(deadline) {
+			events := make([]map[string]any, 0, len(lines))
+			for _, line := range lines {
+				var e map[string]any
+				if err := json.Unmarshal([]byte(line), &e); err != nil {
+					t.Fatalf("invalid JSON line %q: %s", line, err)
+				}
+				events = append(events, e)
+			}
+			return events
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// eventField returns the value at a dotted path in a decoded event.
+func eventField(e map[string]any, path string) any {
+	var value any = e
+	for _, key := range strings.Split(path, ".") {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = m[key]
+	}
+	return value
+}
+
+var malformedFrame = func() string {
+	body := "|garbage|END"
+	return fmt.Sprintf("|GEMS|14|%010d%s", len("|GEMS|14|")+10+len(body), body)
+}()
+
+var jsonEventTests = []struct {
+	Event string
+	// Session names the connection the event belongs to.
+	Session string
+	Fields  map[string]any
+	// Present lists fields that must be set to a non-empty value.
+	Present []string
+	// Absent lists fields that must not be written.
+	Absent []string
+}{
+	{
+		Event:   "connection_opened",
+		Session: "denied",
+		Absent:  []string{"token", "message", "response", "data", "error"},
+	},
+	{
+		Event:   "connect",
+		Session: "denied",
+		Fields: map[string]any{
+			"token":                     "wrong",
+			"message.type":              "ConnectionRequestMessage",
+			"message.target":            target,
+			"response.body.result_code": "ACCESS_DENIED",
+			"error":                     "invalid access token",
+		},
+	},
+	{
+		Event:   "connect",
+		Session: "client",
+		Fields: map[string]any{
+			"token":                     "secret",
+			"message.body":              map[string]any{"connection_type": "CONTROL_AND_STATUS"},
+			"response.body.result_code": "SUCCESS",
+		},
+		Absent: []string{"error"},
+	},
+	{
+		Event:   "parameter_read",
+		Session: "client",
+		Fields: map[string]any{
+			"message.type":                    "GetConfigMessage",
+			"message.transaction_id":          float64(1),
+			"message.body.desired_parameters": []any{"Level"},
+			"response.type":                   "GetConfigResponse",
+		},
+		Present: []string{"token"},
+	},
+	{
+		Event:   "parameter_write",
+		Session: "client",
+		Fields: map[string]any{
+			"message.type":            "SetConfigMessage",
+			"message.body.parameters": []any{"Level:double=-60.5"},
+		},
+	},
+	{
+		Event:   "directive",
+		Session: "client",
+		Fields: map[string]any{
+			"message.body.directive_name": "Reboot",
+			"message.body.arguments":      []any{"Delay:int=5"},
+			"response.type":               "DirectiveResponse",
+		},
+	},
+	{
+		Event:   "configuration",
+		Session: "client",
+		Fields:  map[string]any{"message.type": "GetConfigListMessage"},
+	},
+	{
+		Event:   "message",
+		Session: "client",
+		Fields: map[string]any{
+			"message.type":              "PingMessage",
+			"response.body.result_code": "SUCCESS",
+		},
+	},
+	{
+		Event:   "disconnect",
+		Session: "client",
+		Fields:  map[string]any{"message.type": "DisconnectMessage"},
+		Absent:  []string{"response"},
+	},
+	{
+		Event:   "connection_closed",
+		Session: "client",
+		Absent:  []string{"message", "response"},
+	},
+	{
+		Event:   "malformed_message",
+		Session: "malformed",
+		Fields:  map[string]any{"data": malformedFrame},
+		Present: []string{"error"},
+		Absent:  []string{"message", "token"},
+	},
+}
+
+func TestJSONEventWriter(t *testing.T) {
+	var log eventLog
+	server := gems.NewASCIIServer("", namedHandler("device"), gems.BodyFormatter{}, v, "secret",
+		gems.WithEventHandler(gems.NewJSONEventWriter(&log).Handle))
+	server.Start()
+	defer server.Close()
+
+	// Each connection is made after the previous one has logged all of
+	// its events, so the sessions can be told apart by their order.
+	sessions := map[string]string{}
+	lastSession := func(name string, n int) {
+		events := log.events(t, n)
+		sessions[name], _ = events[len(events)-1]["session_id"].(string)
+	}
+
+	denied, err := gems.NewClient(v, "ascii", gems.DefaultFormatter{})
+	if err != nil {
+		t.Fatalf("client error: %s", err)
+	}
+	if err := denied.Connect(server.Addr(), gems.ConnectionTypeControlAndStatus, "wrong", target); err == nil {
+		t.Fatal("expected connect with the wrong token to fail")
+	}
+	lastSession("denied", 2)
+
+	client, err := gems.NewClient(v, "ascii", gems.DefaultFormatter{})
+	if err != nil {
+		t.Fatalf("client error: %s", err)
+	}
+	if err := client.Connect(server.Addr(), gems.ConnectionTypeControlAndStatus, "secret", target); err != nil {
+		t.Fatalf("connect error: %s", err)
+	}
+	client.GetConfig("Level")
+	client.SetConfig([]string{"Level:double=-60.5"})
+	client.Directive("Reboot", []string{"Delay:int=5"})
+	client.GetConfigList()
+	client.Ping()
+	client.Disconnect(gems.DisconnectReasonNormalTermination)
+	lastSession("client", 11)
+
+	conn, err := net.Dial("tcp", server.Addr())
+	if err != nil {
+		t.Fatalf("dial error: %s", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte(malformedFrame))
+	lastSession("malformed", 13)
+
+	events := log.events(t, 13)
+	for _, e := range events {
+		if addr, _ := e["remote_addr"].(string); !strings.HasPrefix(addr, "127.0.0.1:") {
+			t.Errorf("%s: incorrect remote_addr '%v'", e["event"], e["remote_addr"])
+		}
+		if e["psm"] != "ascii" {
+			t.Errorf("%s: incorrect psm '%v'", e["event"], e["psm"])
+		}
+		if ts, _ := e["time"].(string); ts == "" || strings.HasPrefix(ts, "0001") {
+			t.Errorf("%s: missing time", e["event"])
+		}
+	}
+
+	for _, test := range jsonEventTests {
+		t.Run(test.Event+"/"+test.Session, func(t *testing.T) {
+			var found map[string]any
+			for _, e := range events {
+				if (e["event"] == test.Event) && (e["session_id"] == sessions[test.Session]) {
+					found = e
+					break
+				}
+			}
+			if found == nil {
+				t.Fatalf("no %s event for session %s", test.Event, test.Session)
+			}
+
+			for path, want := range test.Fields {
+				if have := eventField(found, path); !reflect.DeepEqual(have, want) {
+					t.Errorf("incorrect %s: have %#v, want %#v", path, have, want)
+				}
+			}
+			for _, path := range test.Present {
+				if have := eventField(found, path); (have == nil) || (have == "") {
+					t.Errorf("missing %s", path)
+				}
+			}
+			for _, path := range test.Absent {
+				if have := eventField(found, path); have != nil {
+					t.Errorf("unexpected %s: %#v", path, have)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package gemsV14_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	gems "github.com/mitre/gems/src"
+)
+
+var faultServers = map[string]func(gems.MessageHandler, ...gems.ServerOption) gems.Server{
+	"ascii": func(h gems.MessageHandler, opts ...gems.ServerOption) gems.Server {
+		return gems.NewASCIIServer("", h, gems.BodyFormatter{}, v, "", opts...)
+	},
+	"xml": func(h gems.MessageHandler, opts ...gems.ServerOption) gems.Server {
+		return gems.NewXMLServer("", h, gems.BodyFormatter{}, v, "", opts...)
+	},
+	"xml-tcp": func(h gems.MessageHandler, opts ...gems.ServerOption) gems.Server {
+		return gems.NewXMLTCPServer("", h, gems.BodyFormatter{}, v, "", opts...)
+	},
+}
+
+const (
+	faultTimeout = "timeout waiting for response"
+	faultDelay   = 50 * time.Millisecond
+)
+
+// faultClientTimeout bounds the wait for responses hidden by a fault.
+var faultClientTimeout = gems.WithClientTimeout(500 * time.Millisecond)
+
+// faultTests describe what a client receives in reply to a PingMessage
+// when a fault fires. Faults that do not apply to a PSM leave the
+// response unchanged.
+var faultTests = []struct {
+	PSM  string
+	Kind gems.FaultKind
+	// Err is a substring of the error returned by the client.
+	Err           string
+	Type          gems.MessageType
+	TransactionID int64
+}{
+	{PSM: "ascii", Kind: gems.FaultTruncate, Err: faultTimeout},
+	{PSM: "ascii", Kind: gems.FaultBadLength, Err: faultTimeout},
+	{PSM: "ascii", Kind: gems.FaultInvalidXML, Type: gems.PingResponseType, TransactionID: 1},
+	{PSM: "ascii", Kind: gems.FaultWrongTransactionID, Err: faultTimeout},
+	{PSM: "ascii", Kind: gems.FaultUnknownResponse, Err: "UNSUPPORTED_MESSAGE", Type: gems.UnknownResponseType, TransactionID: 1},
+	{PSM: "ascii", Kind: gems.FaultReset, Err: "connection closed by the device"},
+	{PSM: "ascii", Kind: gems.FaultDrop, Err: faultTimeout},
+	{PSM: "ascii", Kind: gems.FaultDelay, Type: gems.PingResponseType, TransactionID: 1},
+
+	{PSM: "xml", Kind: gems.FaultTruncate, Type: gems.PingResponseType, TransactionID: 1},
+	{PSM: "xml", Kind: gems.FaultBadLength, Type: gems.PingResponseType, TransactionID: 1},
+	{PSM: "xml", Kind: gems.FaultInvalidXML, Err: "XML syntax error"},
+	// The GEMS-XML client relies on HTTP to pair requests and responses,
+	// so it returns the response with the wrong transaction ID.
+	{PSM: "xml", Kind: gems.FaultWrongTransactionID, Type: gems.PingResponseType, TransactionID: 1001},
+	{PSM: "xml", Kind: gems.FaultUnknownResponse, Err: "UNSUPPORTED_MESSAGE", Type: gems.UnknownResponseType, TransactionID: 1},
+	{PSM: "xml", Kind: gems.FaultReset, Err: "EOF"},
+	{PSM: "xml", Kind: gems.FaultDrop, Err: "did not receive a response type message"},
+	{PSM: "xml", Kind: gems.FaultDelay, Type: gems.PingResponseType, TransactionID: 1},
+
+	{PSM: "xml-tcp", Kind: gems.FaultTruncate, Type: gems.PingResponseType, TransactionID: 1},
+	{PSM: "xml-tcp", Kind: gems.FaultBadLength, Type: gems.PingResponseType, TransactionID: 1},
+	{PSM: "xml-tcp", Kind: gems.FaultInvalidXML, Err: faultTimeout},
+	{PSM: "xml-tcp", Kind: gems.FaultWrongTransactionID, Err: faultTimeout},
+	{PSM: "xml-tcp", Kind: gems.FaultUnknownResponse, Err: "UNSUPPORTED_MESSAGE", Type: gems.UnknownResponseType, TransactionID: 1},
+	{PSM: "xml-tcp", Kind: gems.FaultReset, Err: "connection closed by the device"},
+	{PSM: "xml-tcp", Kind: gems.FaultDrop, Err: faultTimeout},
+	{PSM: "xml-tcp", Kind: gems.FaultDelay, Type: gems.PingResponseType, TransactionID: 1},
+}
+
+func TestFaultInjector(t *testing.T) {
+	for _, test := range faultTests {
+		t.Run(test.PSM+"/"+string(test.Kind), func(t *testing.T) {
+			t.Parallel()
+
+			// The rule only matches PingMessages so the client can connect.
+			rule := gems.FaultRule{Name: string(test.Kind), Kind: test.Kind, MessageTypes: []string{"PING"}, Probability: 1, Delay: faultDelay}
+			server := faultServers[test.PSM](namedHandler("device"), gems.WithFaultInjector(gems.NewFaultInjector(rule)))
+			server.Start()
+			defer server.Close()
+
+			transport, err := gems.NewPipeTransport(test.PSM, server)
+			if err != nil {
+				t.Fatalf("transport error: %s", err)
+			}
+			client, err := gems.NewClient(v, test.PSM, gems.DefaultFormatter{}, gems.WithTransport(transport), faultClientTimeout)
+			if err != nil {
+				t.Fatalf("client error: %s", err)
+			}
+			if err := client.Connect("device", gems.ConnectionTypeControlAndStatus, "", target); err != nil {
+				t.Fatalf("connect error: %s", err)
+			}
+
+			start := time.Now()
+			resp, err := client.Ping()
+			elapsed := time.Since(start)
+
+			switch {
+			case test.Err == "" && err != nil:
+				t.Errorf("unexpected error: %s", err)
+			case test.Err != "" && (err == nil || !strings.Contains(err.Error(), test.Err)):
+				t.Errorf("incorrect error: have %v, want %s", err, test.Err)
+			}
+
+			if test.Type == gems.UndefinedMessageType {
+				if resp != nil {
+					t.Errorf("unexpected response: %s", client.Format(resp))
+				}
+				return
+			}
+			if resp == nil {
+				t.Fatal("no response")
+			}
+			if resp.Type() != test.Type {
+				t.Errorf("incorrect type: have %s, want %s", resp.Type(), test.Type)
+			}
+			if id := resp.TransactionID(); !id.Valid || id.Int64 != test.TransactionID {
+				t.Errorf("incorrect transaction ID: have %v, want %d", id, test.TransactionID)
+			}
+			if (test.Kind == gems.FaultDelay) && (elapsed < faultDelay) {
+				t.Errorf("response was not delayed: %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestFaultInjectorSwitches(t *testing.T) {
+	faults := gems.NewFaultInjector(gems.FaultRule{Name: "unknown", Kind: gems.FaultUnknownResponse, Probability: 1, MessageTypes: []string{"PingMessage"}})
+	server := gems.NewASCIIServer("", namedHandler("device"), gems.BodyFormatter{}, v, "", gems.WithFaultInjector(faults))
+	server.Start()
+	defer server.Close()
+
+	transport, err := gems.NewPipeTransport("ascii", server)
+	if err != nil {
+		t.Fatalf("transport error: %s", err)
+	}
+	client, err := gems.NewClient(v, "ascii", gems.DefaultFormatter{}, gems.WithTransport(transport))
+	if err != nil {
+		t.Fatalf("client error: %s", err)
+	}
+	if err := client.Connect("device", gems.ConnectionTypeControlAndStatus, "", target); err != nil {
+		t.Fatalf("connect error: %s", err)
+	}
+
+	steps := []struct {
+		Name   string
+		Switch func()
+		Expect gems.MessageType
+	}{
+		{Name: "enabled", Switch: func() {}, Expect: gems.UnknownResponseType},
+		{Name: "all disabled", Switch: func() { faults.SetEnabled(false) }, Expect: gems.PingResponseType},
+		{Name: "all enabled", Switch: func() { faults.SetEnabled(true) }, Expect: gems.UnknownResponseType},
+		{Name: "rule disabled", Switch: func() { faults.EnableRule("unknown", false) }, Expect: gems.PingResponseType},
+		{Name: "rule enabled", Switch: func() { faults.EnableRule("unknown", true) }, Expect: gems.UnknownResponseType},
+		{Name: "rule removed", Switch: func() { faults.RemoveRule("unknown") }, Expect: gems.PingResponseType},
+	}
+	for _, step := range steps {
+		step.Switch()
+		resp, _ := client.Ping()
+		if (resp == nil) || (resp.Type() != step.Expect) {
+			t.Errorf("%s: incorrect response: have %v, want %s", step.Name, resp, step.Expect)
+		}
+	}
+}
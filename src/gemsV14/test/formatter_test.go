@@ -0,0 +1,249 @@
+package gemsV14_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	gems "github.com/mitre/gems/src"
+)
+
+var (
+	hexResponse, _         = v.NewMessageBuilder().Type(gems.DirectiveResponseType).Target(target).Timestamp("1410819035.27").TransactionID(id).Directive("Read").Parameters(hexValue, emptyIntList).Build()
+	setResponse, _         = v.NewMessageBuilder().Type(gems.GetConfigResponseType).Target(target).Timestamp("1410819035.28").TransactionID(id).Parameters(singleParameterSet).Build()
+	channelListResponse, _ = v.NewMessageBuilder().Type(gems.GetConfigResponseType).Target(target).Timestamp("1410819035.28").TransactionID(id).Parameters(parameterSetList).Build()
+)
+
+var formatterTests = []struct {
+	Formatter gems.MessageFormatter
+	Message   gems.Message
+	Expect    string
+}{
+	{
+		Formatter: gems.JSONFormatter{},
+		Message:   pingResponse,
+		Expect:    `{"gems_version":"1.4","type":"PingResponse","transaction_id":1,"timestamp":"1410819035.280000000","target":"System/Device1","result_code":"SUCCESS"}`,
+	},
+	{
+		Formatter: gems.YAMLFormatter{},
+		Message:   getConfigListResponse,
+		Expect: "gems_version: \"1.4\"\ntype: \"GetConfigListResponse\"\ntransaction_id: 1\ntimestamp: \"1410819035.280000000\"\n" +
+			"target: \"System/Device1\"\nresult_code: \"SUCCESS\"\nconfigurations:\n  - \"ConfigA\"\n  - \"ConfigB\"\n  - \"ConfigC\"",
+	},
+	{
+		Formatter: gems.YAMLFormatter{},
+		Message:   setResponse,
+		Expect: `gems_version: "1.4"
+type: "GetConfigResponse"
+transaction_id: 1
+timestamp: "1410819035.280000000"
+target: "System/Device1"
+parameters:
+  - name: "SingleParameterSet"
+    datatype: "set_type"
+    values:
+      - name: "ChannelName"
+        datatype: "string"
+        values:
+          - "Channel0"
+      - name: "ChannelID"
+        datatype: "int"
+        values:
+          - 0
+      - name: "BitRates"
+        datatype: "int"
+        multiplicity: 2
+        values:
+          - 200
+          - 2000`,
+	},
+	{
+		Formatter: gems.YAMLFormatter{},
+		Message:   hexResponse,
+		Expect: `gems_version: "1.4"
+type: "DirectiveResponse"
+transaction_id: 1
+timestamp: "1410819035.270000000"
+target: "System/Device1"
+directive_name: "Read"
+return_values:
+  - name: "HexValue"
+    datatype: "hex_value"
+    values:
+      - data: "FAF320"
+        bit_length: 24
+  - name: "EmptyIntList"
+    datatype: "int"
+    multiplicity: 0
+    values:
+      - null`,
+	},
+	{
+		Formatter: gems.CSVFormatter{},
+		Message:   getConfigListResponse,
+		Expect: "field,name,datatype,multiplicity,value\ngems_version,,,,1.4\ntype,,,,GetConfigListResponse\ntransaction_id,,,,1\n" +
+			"timestamp,,,,1410819035.280000000\ntarget,,,,System/Device1\nresult_code,,,,SUCCESS\nconfigurations,,,,ConfigA\nconfigurations,,,,ConfigB\nconfigurations,,,,ConfigC",
+	},
+	{
+		Formatter: gems.CSVFormatter{},
+		Message:   hexResponse,
+		Expect: "field,name,datatype,multiplicity,value\ngems_version,,,,1.4\ntype,,,,DirectiveResponse\ntransaction_id,,,,1\n" +
+			"timestamp,,,,1410819035.270000000\ntarget,,,,System/Device1\ndirective_name,,,,Read\n" +
+			"return_values,HexValue,hex_value,,FAF320/24\nreturn_values,EmptyIntList,int,0,",
+	},
+	{
+		Formatter: gems.CSVFormatter{},
+		Message:   setResponse,
+		Expect: "field,name,datatype,multiplicity,value\ngems_version,,,,1.4\ntype,,,,GetConfigResponse\ntransaction_id,,,,1\n" +
+			"timestamp,,,,1410819035.280000000\ntarget,,,,System/Device1\n" +
+			"parameters,SingleParameterSet.ChannelName,string,,Channel0\nparameters,SingleParameterSet.ChannelID,int,,0\n" +
+			"parameters,SingleParameterSet.BitRates[0],int,2,200\nparameters,SingleParameterSet.BitRates[1],int,2,2000",
+	},
+	{
+		Formatter: gems.CSVFormatter{},
+		Message:   channelListResponse,
+		Expect: "field,name,datatype,multiplicity,value\ngems_version,,,,1.4\ntype,,,,GetConfigResponse\ntransaction_id,,,,1\n" +
+			"timestamp,,,,1410819035.280000000\ntarget,,,,System/Device1\n" +
+			"parameters,ParameterSetList[0].ChannelName,string,,Channel0\nparameters,ParameterSetList[0].ChannelID,int,,0\n" +
+			"parameters,ParameterSetList[0].BitRates[0],int,2,200\nparameters,ParameterSetList[0].BitRates[1],int,2,2000\n" +
+			"parameters,ParameterSetList[1].ChannelName,string,,Channel1\nparameters,ParameterSetList[1].ChannelID,int,,1\n" +
+			"parameters,ParameterSetList[1].BitRates[0],int,2,400\nparameters,ParameterSetList[1].BitRates[1],int,2,4000\n" +
+			"parameters,ParameterSetList[2].ChannelName,string,,Channel2\nparameters,ParameterSetList[2].ChannelID,int,,2\n" +
+			"parameters,ParameterSetList[2].BitRates[0],int,2,600\nparameters,ParameterSetList[2].BitRates[1],int,2,6000",
+	},
+	{
+		Formatter: gems.CSVFormatter{},
+		Message:   setConfigMessageEscape,
+		Expect: "field,name,datatype,multiplicity,value\ngems_version,,,,1.4\ntype,,,,SetConfigMessage\ntransaction_id,,,,1\n" +
+			"timestamp,,,,1410819035.270000000\ntarget,,,,System/Device1\n" +
+			"parameters,Ampersand,string,,Bob & Sally\nparameters,Pipe,string,,Bob | Sally\nparameters,Comma,string,,\"Bob, Sally\"\n" +
+			"parameters,Semicolon,string,,Bob; Sally\nparameters,LessThan,string,,Bob < Sally",
+	},
+	{
+		Formatter: gems.ASCIIFormatter{},
+		Message:   pingResponse,
+		Expect:    "|GEMS|14|0000000078|1||1410819035.280000000|System/Device1|PING-R|SUCCESS||END",
+	},
+	{
+		Formatter: gems.XMLFormatter{},
+		Message:   pingMessage,
+		Expect:    `<PingMessage xmlns="http://www.omg.org/spec/gems/20110323/basetypes" gems_version="1.4" target="System/Device1" transaction_id="1" timestamp="1410819035.28"></PingMessage>`,
+	},
+	{
+		Formatter: gems.FactFormatter{},
+		Message:   getConfigListResponse,
+		Expect:    `[{"trait":"gems.config.name","value":"ConfigA"},{"trait":"gems.config.name","value":"ConfigB"},{"trait":"gems.config.name","value":"ConfigC"}]`,
+	},
+	{
+		Formatter: gems.FactFormatter{},
+		Message:   directiveResponse,
+		Expect: `[{"trait":"gems.directive.name","value":"StartProcessing"},{"trait":"gems.parameter.value","value":"Results:int[3]=12,47,33"},` +
+			`{"trait":"gems.parameter.names","value":"Results"}]`,
+	},
+	{
+		Formatter: gems.FactFormatter{},
+		Message:   setResponse,
+		Expect: `[{"trait":"gems.parameter.value","value":"SingleParameterSet:set_type=ChannelName:string=Channel0;ChannelID:int=0;BitRates:int[2]=200,2000;"},` +
+			`{"trait":"gems.parameter.names","value":"SingleParameterSet"}]`,
+	},
+	{
+		Formatter: gems.FactFormatter{},
+		Message:   getConfigMessageParameterized,
+		Expect:    `[{"trait":"gems.parameter.names","value":"PacketLength,FillPacket,ChannelConfigList"}]`,
+	},
+	{
+		Formatter: gems.FactFormatter{},
+		Message:   loadConfigMessage,
+		Expect:    `[{"trait":"gems.config.name","value":"MySavedConfig"}]`,
+	},
+	{Formatter: gems.FactFormatter{}, Message: pingResponse, Expect: `[]`},
+}
+
+var templateFormatterTests = []struct {
+	Template string
+	Message  gems.Message
+	Expect   string
+	// Err is a substring of the parse or execution error.
+	Err string
+}{
+	{Template: `{{.Type}} {{.Target}} {{resultCode .}}`, Message: pingResponse, Expect: "PingResponse System/Device1 SUCCESS"},
+	{Template: `{{resultCode .}}: {{resultDescription .}}`, Message: directiveFailure, Expect: "INVALID_STATE: Processing already started"},
+	{Template: `[{{resultCode .}}]`, Message: pingMessage, Expect: "[]"},
+	{Template: `{{int64 (param . "PacketLength")}} {{bool (param . "FillPacket")}}`, Message: getConfigResponse, Expect: "1024 true"},
+	{Template: `{{join (int64s (param . "Results")) ","}}`, Message: directiveResponse, Expect: "12,47,33"},
+	{Template: `{{string (param . "Title")}} x{{int64 (param . "Iterations")}}`, Message: directiveMessage, Expect: "Run 1 x2000"},
+	{Template: `{{range params .}}{{.Name}};{{end}}`, Message: getConfigResponse, Expect: "PacketLength;FillPacket;EmptyStringList;EmptyIntList;ChannelConfigList;"},
+	{Template: `{{len (int64s (param . "EmptyIntList"))}}`, Message: getConfigResponse, Expect: "0"},
+	{Template: `{{range children (param . "ChannelConfigList")}}{{range children .}}{{if eq .Name "BitRate"}}{{int64 .}} {{end}}{{end}}{{end}}`, Message: getConfigResponse, Expect: "200000 400000 600000 "},
+	{Template: `{{float64 (param . "DoubleValue")}} {{(time (param . "TimeValue")).Unix}}`, Message: setConfigMessageTypes, Expect: "1.234 1410804178"},
+	{Template: `{{range bytes (param . "HexList")}}{{hex .}} {{end}}`, Message: setConfigMessageTypes, Expect: "FAF320 EB90 "},
+	{Template: `{{hex (index (bytes (param . "HexValue")) 0)}}`, Message: hexResponse, Expect: "FAF320"},
+	{Template: `{{bytes (param . "PacketLength")}}`, Message: getConfigResponse, Err: "cannot convert int value of parameter 'PacketLength' to []byte"},
+	{Template: `{{int64 (param . "Missing")}}`, Message: getConfigResponse, Err: "no parameter 'Missing' in GetConfigResponse"},
+	{Template: `{{int64 (param . "Results")}}`, Message: directiveResponse, Err: "parameter 'Results' has 3 values, want 1"},
+	{Template: `{{bool (param . "PacketLength")}}`, Message: getConfigResponse, Err: "cannot convert int value of parameter 'PacketLength' to bool"},
+	{Template: `{{.Type`, Message: pingMessage, Err: "unclosed action"},
+}
+
+var factRoundTripTests = []gems.Message{getConfigResponse, setConfigMessageTypes, setConfigMessageEscape}
+
+func TestFormatter(t *testing.T) {
+	for i, test := range formatterTests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			have := test.Formatter.Format(test.Message)
+			if have != test.Expect {
+				t.Errorf("incorrect output:\nhave:\n%s\nwant:\n%s", have, test.Expect)
+			}
+			if have, err := test.Formatter.FormatMessage(test.Message); (err != nil) || (have != test.Expect) {
+				t.Errorf("incorrect FormatMessage output:\nhave:\n%s\nwant:\n%s\nerror: %v", have, test.Expect, err)
+			}
+		})
+	}
+}
+
+func TestFactRoundTrip(t *testing.T) {
+	for i, msg := range factRoundTripTests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			var values []string
+			for _, fact := range gems.Facts(msg) {
+				if fact.Trait == gems.TraitParameterValue {
+					values = append(values, fact.Value)
+				}
+			}
+
+			have, err := v.NewMessageBuilder().Type(msg.Type()).Target(target).Timestamp("1410819035.27").TransactionID(id).ASCIIParameters(values...).Build()
+			if err != nil {
+				t.Fatalf("build error: %s", err)
+			}
+			if !reflect.DeepEqual(have.Body()["parameters"], msg.Body()["parameters"]) {
+				t.Errorf("incorrect parameters:\nhave: %v\nwant: %v", have.Body()["parameters"], msg.Body()["parameters"])
+			}
+		})
+	}
+}
+
+func TestTemplateFormatter(t *testing.T) {
+	for i, test := range templateFormatterTests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			f, err := gems.NewTemplateFormatter(test.Template)
+			if err == nil {
+				var have string
+				have, err = f.FormatMessage(test.Message)
+				if have != test.Expect {
+					t.Errorf("incorrect output:\nhave: %q\nwant: %q", have, test.Expect)
+				}
+				// Format drops the error of a failed template.
+				if have := f.Format(test.Message); have != test.Expect {
+					t.Errorf("incorrect Format output:\nhave: %q\nwant: %q", have, test.Expect)
+				}
+			}
+			switch {
+			case (test.Err == "") && (err != nil):
+				t.Errorf("unexpected error: %s", err)
+			case (test.Err != "") && ((err == nil) || !strings.Contains(err.Error(), test.Err)):
+				t.Errorf("incorrect error: have %v, want %s", err, test.Err)
+			}
+		})
+	}
+}
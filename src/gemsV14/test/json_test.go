@@ -0,0 +1,142 @@
+package gemsV14_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	gems "github.com/mitre/gems/src"
+	"github.com/mitre/gems/src/ascii"
+	"github.com/mitre/gems/src/gemsV14"
+)
+
+var parameterJSONTests = []struct {
+	Value          gems.Parameter
+	ExpectJSON     string
+	UnmarshalError string
+}{
+	{Value: empty, ExpectJSON: `{"values":[]}`},
+	{Value: stringValue, ExpectJSON: `{"name":"StringValue","datatype":"string","values":["My String"]}`},
+	{Value: hexValue, ExpectJSON: `{"name":"HexValue","datatype":"hex_value","values":[{"data":"FAF320","bit_length":24}]}`},
+	{Value: boolValue, ExpectJSON: `{"name":"BoolValue","datatype":"bool","values":[true]}`},
+	{Value: ubyteValue, ExpectJSON: `{"name":"UbyteValue","datatype":"ubyte","values":[255]}`},
+	{Value: doubleValue, ExpectJSON: `{"name":"DoubleValue","datatype":"double","values":[1.234]}`},
+	{Value: timeValue, ExpectJSON: `{"name":"TimeValue","datatype":"time","values":["1410804178.490230000"]}`},
+	{Value: utimeValue, ExpectJSON: `{"name":"UtimeValue","datatype":"utime","values":["2009-273T09:14:50.020000000Z"]}`},
+	{Value: emptyStringValue, ExpectJSON: `{"name":"EmptyStringValue","datatype":"string","values":[null]}`},
+	{Value: longList, ExpectJSON: `{"name":"LongList","datatype":"long","multiplicity":3,"values":[123456789,-1,234569999]}`},
+	{Value: emptyIntList, ExpectJSON: `{"name":"EmptyIntList","datatype":"int","multiplicity":0,"values":[null]}`},
+	{Value: xmlEscapeString, ExpectJSON: `{"name":"Escape\u003c\u003eMe","datatype":"string","values":["Escape\u0026This"]}`},
+	{Value: singleParameterSet, ExpectJSON: `{"name":"SingleParameterSet","datatype":"set_type","values":[` +
+		`{"name":"ChannelName","datatype":"string","values":["Channel0"]},` +
+		`{"name":"ChannelID","datatype":"int","values":[0]},` +
+		`{"name":"BitRates","datatype":"int","multiplicity":2,"values":[200,2000]}]}`},
+	{Value: parameterSetList, ExpectJSON: `{"name":"ParameterSetList","datatype":"set_type","multiplicity":3,"values":[` +
+		`{"datatype":"set_type","values":[{"name":"ChannelName","datatype":"string","values":["Channel0"]},{"name":"ChannelID","datatype":"int","values":[0]},{"name":"BitRates","datatype":"int","multiplicity":2,"values":[200,2000]}]},` +
+		`{"datatype":"set_type","values":[{"name":"ChannelName","datatype":"string","values":["Channel1"]},{"name":"ChannelID","datatype":"int","values":[1]},{"name":"BitRates","datatype":"int","multiplicity":2,"values":[400,4000]}]},` +
+		`{"datatype":"set_type","values":[{"name":"ChannelName","datatype":"string","values":["Channel2"]},{"name":"ChannelID","datatype":"int","values":[2]},{"name":"BitRates","datatype":"int","multiplicity":2,"values":[600,6000]}]}]}`},
+	{ExpectJSON: `{"name":"NaN","datatype":"double","values":["NaN","+Inf"]}`},
+	{ExpectJSON: `{"name":"Big","datatype":"ubyte","values":[256]}`, UnmarshalError: "cannot unmarshal number 256"},
+	{ExpectJSON: `{"name":"Bad","datatype":"integer","values":[1]}`, UnmarshalError: "invalid datatype 'integer'"},
+	{ExpectJSON: `{"name":"Untyped","values":[1]}`, UnmarshalError: "has values but no datatype"},
+	{ExpectJSON: `{"name":"Hex","datatype":"hex_value","values":[{"data":"FA","bit_length":12}]}`, UnmarshalError: "invalid hex_value bit length 12"},
+	{ExpectJSON: `{"name":"Time","datatype":"time","values":["noon"]}`, UnmarshalError: "invalid syntax"},
+}
+
+func TestParameterJSON(t *testing.T) {
+	for i, test := range parameterJSONTests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			if test.Value != nil {
+				data, err := json.Marshal(test.Value)
+				if err != nil {
+					t.Fatalf("marshal error: %s", err)
+				}
+				if have := string(data); have != test.ExpectJSON {
+					t.Errorf("incorrect JSON:\nhave: %s\nwant: %s", have, test.ExpectJSON)
+				}
+			}
+
+			p, err := gemsV14.UnmarshalParameterJSON([]byte(test.ExpectJSON))
+			if test.UnmarshalError != "" {
+				if err == nil {
+					t.Errorf("unmarshal succeeded (%s), want error %q", p, test.UnmarshalError)
+				} else if !strings.Contains(err.Error(), test.UnmarshalError) {
+					t.Errorf("incorrect error:\nhave: %s,\nwant: %q", err, test.UnmarshalError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unmarshal error: %s", err)
+			}
+
+			data, err := json.Marshal(p)
+			if err != nil {
+				t.Fatalf("marshal error: %s", err)
+			}
+			if have := string(data); have != test.ExpectJSON {
+				t.Errorf("incorrect round trip:\nhave: %s\nwant: %s", have, test.ExpectJSON)
+			}
+			if test.Value != nil && (p.String() != test.Value.String()) {
+				t.Errorf("incorrect parameter:\nhave: %s\nwant: %s", p, test.Value)
+			}
+		})
+	}
+}
+
+func TestMessageJSON(t *testing.T) {
+	for i, test := range messageMarshalTests {
+		if test.UnmarshalOnly {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			data, err := json.Marshal(test.Value)
+			if err != nil {
+				t.Fatalf("marshal error: %s", err)
+			}
+
+			m, err := gems.ReceiveJSONMessage(data, v)
+			if err != nil {
+				t.Fatalf("unmarshal error: %s\n%s", err, data)
+			}
+			if m.Type() != test.Value.Type() {
+				t.Fatalf("incorrect type: have %s, want %s", m.Type(), test.Value.Type())
+			}
+
+			have, err := ascii.Marshal(m)
+			if err != nil {
+				t.Fatalf("ASCII marshal error: %s", err)
+			}
+			want, _ := ascii.Marshal(test.Value)
+			if string(have) != string(want) {
+				t.Errorf("incorrect round trip:\nhave: %s\nwant: %s\nJSON: %s", have, want, data)
+			}
+			if !reflect.DeepEqual(m.Body(), test.Value.Body()) {
+				t.Errorf("incorrect body:\nhave: %v\nwant: %v", m.Body(), test.Value.Body())
+			}
+		})
+	}
+}
+
+func TestMessageJSONSchema(t *testing.T) {
+	data, err := json.Marshal(getConfigListResponse)
+	if err != nil {
+		t.Fatalf("marshal error: %s", err)
+	}
+	want := `{"gems_version":"1.4","type":"GetConfigListResponse","transaction_id":1,"timestamp":"1410819035.280000000",` +
+		`"target":"System/Device1","result_code":"SUCCESS","configurations":["ConfigA","ConfigB","ConfigC"]}`
+	if string(data) != want {
+		t.Errorf("incorrect JSON:\nhave: %s\nwant: %s", data, want)
+	}
+
+	for _, bad := range []struct{ JSON, Error string }{
+		{`{"gems_version":"1.3","type":"PingMessage"}`, "incorrect gems version '1.3'"},
+		{`{"gems_version":"1.4","type":"Hello"}`, "unexpected type"},
+		{`{"gems_version":"1.4","type":"PingMessage","timestamp":"soon"}`, "invalid syntax"},
+	} {
+		if _, err := gems.ReceiveJSONMessage([]byte(bad.JSON), v); (err == nil) || !strings.Contains(err.Error(), bad.Error) {
+			t.Errorf("ReceiveJSONMessage(%s): have error %v, want %q", bad.JSON, err, bad.Error)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package gemsV14_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	gems "github.com/mitre/gems/src"
+	"github.com/mitre/gems/src/ascii"
+	"github.com/mitre/gems/src/gemsV14"
+)
+
+type channel struct {
+	ChannelName string
+	ChannelID   int32
+	BitRates    []int32
+}
+
+type channels struct {
+	SingleParameterSet channel
+	ParameterSetList   []channel
+}
+
+type scalars struct {
+	StringValue string
+	HexValue    []byte
+	BoolValue   bool
+	ByteValue   int8
+	UbyteValue  uint8
+	ShortValue  int16
+	UshortValue uint16
+	IntValue    int32
+	UintValue   uint32
+	LongValue   int64
+	UlongValue  uint64
+	DoubleValue float64
+	TimeValue   time.Time
+	UtimeValue  time.Time `gems:",utime"`
+}
+
+type common struct {
+	Name string `gems:"DeviceName"`
+}
+
+type tagged struct {
+	common
+	Rate     int       `gems:"BitRate,int"`
+	Lists    []string  `gems:"EmptyStringList"`
+	Start    time.Time `gems:"Start,omitempty"`
+	Skipped  string    `gems:"-"`
+	internal string
+}
+
+type overflow struct {
+	Rate int `gems:"BitRate,short"`
+}
+
+type badOption struct {
+	Rate int `gems:"BitRate,integer"`
+}
+
+type narrow struct {
+	IntValue int8
+}
+
+var (
+	testTime  = time.Date(2014, time.September, 15, 18, 2, 58, 490230000, time.UTC)
+	testUtime = time.Date(2009, time.September, 30, 9, 14, 50, 20000000, time.UTC)
+)
+
+var structMarshalTests = []struct {
+	Value        any
+	ExpectASCII  string
+	MarshalOnly  bool
+	MarshalError string
+}{
+	{
+		Value: &channels{
+			SingleParameterSet: channel{ChannelName: "Channel0", ChannelID: 0, BitRates: []int32{200, 2000}},
+			ParameterSetList: []channel{
+				{ChannelName: "Channel0", ChannelID: 0, BitRates: []int32{200, 2000}},
+				{ChannelName: "Channel1", ChannelID: 1, BitRates: []int32{400, 4000}},
+			},
+		},
+		ExpectASCII: "SingleParameterSet:set_type=ChannelName:string=Channel0;ChannelID:int=0;BitRates:int[2]=200,2000;|" +
+			"ParameterSetList:set_type[2]=ChannelName:string=Channel0;ChannelID:int=0;BitRates:int[2]=200,2000;,ChannelName:string=Channel1;ChannelID:int=1;BitRates:int[2]=400,4000;",
+	},
+	{
+		Value: &channels{SingleParameterSet: channel{ChannelName: "Channel0", BitRates: []int32{}}, ParameterSetList: []channel{}},
+		ExpectASCII: "SingleParameterSet:set_type=ChannelName:string=Channel0;ChannelID:int=0;BitRates:int[0]=;|" +
+			"ParameterSetList:set_type[0]=",
+	},
+	{
+		Value: &scalars{
+			StringValue: "My String",
+			HexValue:    []byte{0xFA, 0xF3, 0x20},
+			BoolValue:   true,
+			ByteValue:   127,
+			UbyteValue:  255,
+			ShortValue:  12,
+			UshortValue: 12,
+			IntValue:    1024,
+			UintValue:   123,
+			LongValue:   123456789,
+			UlongValue:  123456789,
+			DoubleValue: 1.234,
+			TimeValue:   testTime,
+			UtimeValue:  testUtime,
+		},
+		ExpectASCII: "StringValue:string=My String|HexValue:hex_value=FAF320/24|BoolValue:bool=true|ByteValue:byte=127|" +
+			"UbyteValue:ubyte=255|ShortValue:short=12|UshortValue:ushort=12|IntValue:int=1024|UintValue:uint=123|" +
+			"LongValue:long=123456789|UlongValue:ulong=123456789|DoubleValue:double=1.234|" +
+			"TimeValue:time=1410804178.490230000|UtimeValue:utime=2009-273T09:14:50.020000000Z",
+	},
+	{
+		Value:       &tagged{common: common{Name: "Device0"}, Rate: 9600, Lists: []string{}, Skipped: "skip"},
+		ExpectASCII: "DeviceName:string=Device0|BitRate:int=9600|EmptyStringList:string[0]=",
+		MarshalOnly: true,
+	},
+	{Value: &overflow{Rate: 40000}, MarshalError: "value 40000 overflows short"},
+	{Value: &badOption{Rate: 1}, MarshalError: "unknown option 'integer'"},
+	{Value: channel{}, MarshalOnly: true, ExpectASCII: "ChannelName:string=|ChannelID:int=0|BitRates:int[0]="},
+	{Value: "not a struct", MarshalError: "cannot marshal parameters from string"},
+}
+
+var structUnmarshalTests = []struct {
+	Params []gems.Parameter
+	Value  any
+	Expect any
+	Error  string
+}{
+	{
+		Params: []gems.Parameter{stringValue, intValue, doubleValue, boolValue},
+		Value:  &struct{ StringValue, IntValue, DoubleValue, BoolValue string }{},
+		Expect: &struct{ StringValue, IntValue, DoubleValue, BoolValue string }{"My String", "1024", "1.234", "true"},
+	},
+	{
+		Params: []gems.Parameter{intValue, ubyteValue, longList},
+		Value: &struct {
+			IntValue   float32
+			UbyteValue int
+			LongList   []int64
+		}{},
+		Expect: &struct {
+			IntValue   float32
+			UbyteValue int
+			LongList   []int64
+		}{1024, 255, []int64{123456789, -1, 234569999}},
+	},
+	{
+		Params: []gems.Parameter{intList, emptyIntList},
+		Value:  &struct{ IntList, EmptyIntList []int32 }{},
+		Expect: &struct{ IntList, EmptyIntList []int32 }{[]int32{1024, 1, 2, 3}, []int32{}},
+	},
+	{
+		Params: []gems.Parameter{channel0BitRates},
+		Value:  &struct{ BitRates *[2]uint16 }{},
+		Expect: &struct{ BitRates *[2]uint16 }{&[2]uint16{200, 2000}},
+	},
+	{
+		Params: []gems.Parameter{parameterSetList},
+		Value:  &struct{ ParameterSetList []*channel }{},
+		Expect: &struct{ ParameterSetList []*channel }{[]*channel{
+			{ChannelName: "Channel0", ChannelID: 0, BitRates: []int32{200, 2000}},
+			{ChannelName: "Channel1", ChannelID: 1, BitRates: []int32{400, 4000}},
+			{ChannelName: "Channel2", ChannelID: 2, BitRates: []int32{600, 6000}},
+		}},
+	},
+	{
+		Params: []gems.Parameter{stringValue},
+		Value: &struct {
+			Text string `gems:"stringvalue"`
+		}{},
+		Expect: &struct {
+			Text string `gems:"stringvalue"`
+		}{"My String"},
+	},
+	{Params: []gems.Parameter{intValue}, Value: &narrow{}, Error: "value 1024 overflows int8"},
+	{Params: []gems.Parameter{longList}, Value: &struct{ LongList []uint64 }{}, Error: "value -1 overflows uint64"},
+	{Params: []gems.Parameter{intList}, Value: &struct{ IntList int32 }{}, Error: "cannot unmarshal 4 values into int32"},
+	{Params: []gems.Parameter{stringValue}, Value: &struct{ StringValue int }{}, Error: "cannot unmarshal string into int"},
+	{Params: []gems.Parameter{intValue}, Value: &struct {
+		IntValue int64 `gems:",long"`
+	}{}, Error: "parameter has type int, want long"},
+	{Params: []gems.Parameter{singleParameterSet}, Value: &struct{ SingleParameterSet string }{}, Error: "cannot unmarshal ParameterSet into string"},
+	{Params: []gems.Parameter{intValue}, Value: struct{}{}, Error: "cannot unmarshal parameters into struct {}"},
+}
+
+func marshalParametersASCII(params []gems.Parameter) (string, error) {
+	var fields []string
+	for _, p := range params {
+		data, err := ascii.Marshal(p)
+		if err != nil {
+			return "", err
+		}
+		fields = append(fields, string(data))
+	}
+	return strings.Join(fields, "|"), nil
+}
+
+func TestMarshalParameters(t *testing.T) {
+	for i, test := range structMarshalTests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			params, err := gemsV14.MarshalParameters(test.Value)
+			if test.MarshalError != "" {
+				if err == nil {
+					t.Errorf("marshal succeeded, want error %q", test.MarshalError)
+				} else if !strings.Contains(err.Error(), test.MarshalError) {
+					t.Errorf("incorrect error:\nhave: %s,\nwant: %q", err, test.MarshalError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("marshal error: %s", err)
+			}
+
+			have, err := marshalParametersASCII(params)
+			if err != nil {
+				t.Fatalf("ASCII marshal error: %s", err)
+			}
+			if have != test.ExpectASCII {
+				t.Errorf("incorrect parameters:\nhave: %s\nwant: %s", have, test.ExpectASCII)
+			}
+			if test.MarshalOnly {
+				return
+			}
+
+			v := reflect.New(reflect.TypeOf(test.Value).Elem())
+			if err := gemsV14.UnmarshalParameters(params, v.Interface()); err != nil {
+				t.Fatalf("unmarshal error: %s", err)
+			}
+			if !reflect.DeepEqual(v.Interface(), test.Value) {
+				t.Errorf("incorrect round trip:\nhave: %#v\nwant: %#v", v.Interface(), test.Value)
+			}
+		})
+	}
+}
+
+func TestUnmarshalParameters(t *testing.T) {
+	for i, test := range structUnmarshalTests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			err := gemsV14.UnmarshalParameters(test.Params, test.Value)
+			if test.Error != "" {
+				if err == nil {
+					t.Errorf("unmarshal succeeded (%#v), want error %q", test.Value, test.Error)
+				} else if !strings.Contains(err.Error(), test.Error) {
+					t.Errorf("incorrect error:\nhave: %s,\nwant: %q", err, test.Error)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unmarshal error: %s", err)
+			}
+			if !reflect.DeepEqual(test.Value, test.Expect) {
+				t.Errorf("incorrect value:\nhave: %#v\nwant: %#v", test.Value, test.Expect)
+			}
+		})
+	}
+}
@@ -27,6 +27,7 @@ var (
 
 	results, _           = gemsV14.NewParameterBuilder().Name("Results").Int(12, 47, 33).Build()
 	directiveResponse, _ = v.NewMessageBuilder().Type(gems.DirectiveResponseType).Target(target).Timestamp("1410819035.27").TransactionID(id).Directive("StartProcessing").Parameters(results).Build()
+	directiveFailure, _  = v.NewMessageBuilder().Type(gems.DirectiveResponseType).Target(target).Timestamp("1410819035.27").TransactionID(id).ResultCode(gems.ResultCodeInvalidState).ResponseDescription("Processing already started").Directive("StartProcessing").Build()
 
 	disconnect, _            = v.NewMessageBuilder().Type(gems.DisconnectMessageType).Target(target).Timestamp("1410819035.27").TransactionID(id).Directive("StartProcessing").DisconnectReason(gems.DisconnectReasonNormalTermination).Build()
 	getConfigListMessage, _  = v.NewMessageBuilder().Type(gems.GetConfigListMessageType).Target(target).Timestamp("1410819035.28").TransactionID(id).Build()
@@ -81,6 +82,7 @@ var messageMarshalTests = []struct {
 	{Value: connectResponseSuccess, ExpectASCII: "|GEMS|14|0000000077|1||1410819035.260000000|System/Device1|CON-R|SUCCESS||END", ExpectXML: `<ConnectionRequestResponse xmlns="http://www.omg.org/spec/gems/20110323/basetypes" gems_version="1.4" target="System/Device1" transaction_id="1" timestamp="1410819035.26"><Result>SUCCESS</Result></ConnectionRequestResponse>`},
 	{Value: directiveMessage, ExpectASCII: "|GEMS|14|0000000123|1||1410819035.270000000|System/Device1|DIR|StartProcessing|2|Iterations:int=2000|Title:string=Run 1|END", ExpectXML: `<DirectiveMessage xmlns="http://www.omg.org/spec/gems/20110323/basetypes" gems_version="1.4" target="System/Device1" transaction_id="1" timestamp="1410819035.27"><directive_name>StartProcessing</directive_name><arguments><Parameter xmlns="http://www.omg.org/spec/gems/20110323/basetypes" name="Iterations"><int xmlns="http://www.omg.org/spec/gems/20110323/basetypes">2000</int></Parameter><Parameter xmlns="http://www.omg.org/spec/gems/20110323/basetypes" name="Title"><string xmlns="http://www.omg.org/spec/gems/20110323/basetypes">Run 1</string></Parameter></arguments></DirectiveMessage>`},
 	{Value: directiveResponse, ExpectASCII: "|GEMS|14|0000000112|1||1410819035.270000000|System/Device1|DIR-R|||StartProcessing|1|Results:int[3]=12,47,33|END", ExpectXML: `<DirectiveResponse xmlns="http://www.omg.org/spec/gems/20110323/basetypes" gems_version="1.4" target="System/Device1" transaction_id="1" timestamp="1410819035.27"><Result></Result><directive_name>StartProcessing</directive_name><return_values><Parameter xmlns="http://www.omg.org/spec/gems/20110323/basetypes" name="Results" multiplicity="3"><int xmlns="http://www.omg.org/spec/gems/20110323/basetypes">12</int><int xmlns="http://www.omg.org/spec/gems/20110323/basetypes">47</int><int xmlns="http://www.omg.org/spec/gems/20110323/basetypes">33</int></Parameter></return_values></DirectiveResponse>`},
+	{Value: directiveFailure, ExpectASCII: "|GEMS|14|0000000127|1||1410819035.270000000|System/Device1|DIR-R|INVALID_STATE|Processing already started|StartProcessing|0|END", ExpectXML: `<DirectiveResponse xmlns="http://www.omg.org/spec/gems/20110323/basetypes" gems_version="1.4" target="System/Device1" transaction_id="1" timestamp="1410819035.27"><Result>INVALID_STATE</Result><description>Processing already started</description><directive_name>StartProcessing</directive_name></DirectiveResponse>`},
 	{Value: disconnect, ExpectASCII: "|GEMS|14|0000000086|1||1410819035.270000000|System/Device1|DISC|NORMAL_TERMINATION|END", ExpectXML: `<DisconnectMessage xmlns="http://www.omg.org/spec/gems/20110323/basetypes" gems_version="1.4" target="System/Device1" transaction_id="1" timestamp="1410819035.27"><reason>NORMAL_TERMINATION</reason></DisconnectMessage>`},
 	{Value: getConfigListMessage, ExpectASCII: "|GEMS|14|0000000067|1||1410819035.280000000|System/Device1|GETL|END", ExpectXML: `<GetConfigListMessage xmlns="http://www.omg.org/spec/gems/20110323/basetypes" gems_version="1.4" target="System/Device1" transaction_id="1" timestamp="1410819035.28"></GetConfigListMessage>`},
 	{Value: getConfigListResponse, ExpectASCII: "|GEMS|14|0000000104|1||1410819035.280000000|System/Device1|GETL-R|SUCCESS||3|ConfigA|ConfigB|ConfigC|END", ExpectXML: `<GetConfigListResponse xmlns="http://www.omg.org/spec/gems/20110323/basetypes" gems_version="1.4" target="System/Device1" transaction_id="1" timestamp="1410819035.28"><Result>SUCCESS</Result><ConfigurationName>ConfigA</ConfigurationName><ConfigurationName>ConfigB</ConfigurationName><ConfigurationName>ConfigC</ConfigurationName></GetConfigListResponse>`},
@@ -248,3 +250,32 @@ func TestBuildMessages(t *testing.T) {
 		})
 	}
 }
+
+func TestRewriteMessage(t *testing.T) {
+	for i, test := range messageMarshalTests {
+		if test.UnmarshalOnly || (test.MarshalError != "") {
+			continue
+		}
+
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			unchanged, err := gems.RewriteMessage(test.Value, v, func(*gems.MessageContent) {})
+			if err != nil {
+				t.Fatalf("rewrite error: %s", err)
+			}
+			if data, _ := ascii.Marshal(unchanged); string(data) != test.ExpectASCII {
+				t.Errorf("incorrect unchanged message:\nhave %#q\nwant %#q", data, test.ExpectASCII)
+			}
+
+			retargeted, err := gems.RewriteHeader(test.Value, v, func(h *gems.Header) { h.Target = "System/Device2" })
+			if err != nil {
+				t.Fatalf("rewrite error: %s", err)
+			}
+			if retargeted.Target() != "System/Device2" {
+				t.Errorf("incorrect target: %s", retargeted.Target())
+			}
+			if !reflect.DeepEqual(retargeted.Body(), test.Value.Body()) {
+				t.Errorf("incorrect body:\nhave %#v\nwant %#v", retargeted.Body(), test.Value.Body())
+			}
+		})
+	}
+}
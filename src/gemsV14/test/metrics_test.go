@@ -0,0 +1,173 @@
+package gemsV14_test
+
+import (
+	"bufio"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	gems "github.com/mitre/gems/src"
+)
+
+// scrape reads the metrics served by m. It returns the HELP and TYPE
+// comment lines by metric name and the sample values by series, with the
+// series written as in the exposition, e.g. name{label="value"}.
+func scrape(t *testing.T, m *gems.Metrics) (help map[string]string, types map[string]string, samples map[string]float64, series []string) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if have := rec.Header().Get("Content-Type"); !strings.HasPrefix(have, "text/plain; version=0.0.4") {
+		t.Errorf("incorrect content type '%s'", have)
+	}
+
+	help, types, samples = map[string]string{}, map[string]string{}, map[string]float64{}
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if comment, ok := strings.CutPrefix(line, "# HELP "); ok {
+			name, text, _ := strings.Cut(comment, " ")
+			help[name] = text
+			continue
+		}
+		if comment, ok := strings.CutPrefix(line, "# TYPE "); ok {
+			name, typ, _ := strings.Cut(comment, " ")
+			types[name] = typ
+			continue
+		}
+
+		i := strings.LastIndexByte(line, ' ')
+		if i < 0 {
+			t.Fatalf("invalid sample line %q", line)
+		}
+		value, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			t.Fatalf("invalid sample value in %q: %s", line, err)
+		}
+		samples[line[:i]] = value
+		series = append(series, line[:i])
+	}
+	return help, types, samples, series
+}
+
+var metricTypes = map[string]string{
+	"gems_sessions_active":            "gauge",
+	"gems_connections_accepted_total": "counter",
+	"gems_connections_rejected_total": "counter",
+	"gems_auth_failures_total":        "counter",
+	"gems_parse_errors_total":         "counter",
+	"gems_messages_total":             "counter",
+	"gems_handler_duration_seconds":   "histogram",
+}
+
+var metricSamples = map[string]float64{
+	`gems_connections_accepted_total{psm="ascii"}`:                                        1,
+	`gems_connections_rejected_total{psm="ascii",result="ACCESS_DENIED"}`:                 1,
+	`gems_auth_failures_total{psm="ascii"}`:                                               1,
+	`gems_parse_errors_total{psm="ascii"}`:                                                1,
+	`gems_messages_total{psm="ascii",type="PingMessage",result="SUCCESS"}`:                2,
+	`gems_messages_total{psm="ascii",type="GetConfigMessage",result="SUCCESS"}`:           1,
+	`gems_handler_duration_seconds_count{psm="ascii",type="PingMessage"}`:                 2,
+	`gems_handler_duration_seconds_count{psm="ascii",type="GetConfigMessage"}`:            1,
+	`gems_handler_duration_seconds_bucket{psm="ascii",type="PingMessage",le="+Inf"}`:      2,
+	`gems_handler_duration_seconds_bucket{psm="ascii",type="GetConfigMessage",le="+Inf"}`: 1,
+}
+
+func TestMetrics(t *testing.T) {
+	metrics := gems.NewMetrics()
+	server := gems.NewASCIIServer("", namedHandler("device"), gems.BodyFormatter{}, v, "secret", gems.WithMetrics(metrics))
+	server.Start()
+	defer server.Close()
+
+	denied, err := gems.NewClient(v, "ascii", gems.DefaultFormatter{})
+	if err != nil {
+		t.Fatalf("client error: %s", err)
+	}
+	if err := denied.Connect(server.Addr(), gems.ConnectionTypeControlAndStatus, "wrong", target); err == nil {
+		t.Fatal("expected connect with the wrong token to fail")
+	}
+
+	client, err := gems.NewClient(v, "ascii", gems.DefaultFormatter{})
+	if err != nil {
+		t.Fatalf("client error: %s", err)
+	}
+	if err := client.Connect(server.Addr(), gems.ConnectionTypeControlAndStatus, "secret", target); err != nil {
+		t.Fatalf("connect error: %s", err)
+	}
+	for _, send := range []func() (gems.Response, error){client.Ping, client.Ping, func() (gems.Response, error) { return client.GetConfig() }} {
+		if _, err := send(); err != nil {
+			t.Fatalf("request error: %s", err)
+		}
+	}
+
+	conn, err := net.Dial("tcp", server.Addr())
+	if err != nil {
+		t.Fatalf("dial error: %s", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte(malformedFrame))
+
+	// The malformed message is counted by the goroutine serving conn.
+	var (
+		help, types map[string]string
+		samples     map[string]float64
+		series      []string
+	)
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		help, types, samples, series = scrape(t, metrics)
+		if samples[`gems_parse_errors_total{psm="ascii"}`] > 0 {
+			break
+		}
+	}
+
+	for name, typ := range metricTypes {
+		if types[name] != typ {
+			t.Errorf("incorrect TYPE of %s: have '%s', want '%s'", name, types[name], typ)
+		}
+		if help[name] == "" {
+			t.Errorf("missing HELP for %s", name)
+		}
+	}
+
+	for name, want := range metricSamples {
+		if have, found := samples[name]; !found || have != want {
+			t.Errorf("incorrect %s: have %v, want %v", name, have, want)
+		}
+	}
+	// The denied client, the connected client and conn are still open.
+	if have := samples[`gems_sessions_active{psm="ascii"}`]; have != 3 {
+		t.Errorf("incorrect gems_sessions_active: %v", have)
+	}
+
+	// Histogram buckets are cumulative, so their counts never decrease
+	// and the +Inf bucket equals the count.
+	for _, typ := range []string{"PingMessage", "GetConfigMessage"} {
+		prefix := `gems_handler_duration_seconds_bucket{psm="ascii",type="` + typ + `",le="`
+		prev, buckets := 0.0, 0
+		for _, s := range series {
+			if !strings.HasPrefix(s, prefix) {
+				continue
+			}
+			if samples[s] < prev {
+				t.Errorf("%s: bucket %s decreased from %v to %v", typ, s, prev, samples[s])
+			}
+			prev = samples[s]
+			buckets++
+		}
+		if buckets != 11 {
+			t.Errorf("%s: incorrect number of buckets: %d", typ, buckets)
+		}
+
+		count := samples[`gems_handler_duration_seconds_count{psm="ascii",type="`+typ+`"}`]
+		if prev != count {
+			t.Errorf("%s: +Inf bucket %v does not equal count %v", typ, prev, count)
+		}
+		sum, found := samples[`gems_handler_duration_seconds_sum{psm="ascii",type="`+typ+`"}`]
+		if !found || sum <= 0 || sum > count*time.Second.Seconds() {
+			t.Errorf("%s: incorrect sum %v", typ, sum)
+		}
+	}
+}
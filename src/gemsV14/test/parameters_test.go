@@ -2,10 +2,13 @@ package gemsV14_test
 
 import (
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"math"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	gems "github.com/mitre/gems/src"
 	"github.com/mitre/gems/src/ascii"
@@ -244,11 +247,50 @@ func TestUnmarshalParameterASCII(t *testing.T) {
 }
 
 var parameterBuildErrors = []struct {
-	Builder *gemsV14.ParameterBuilder
+	Builder gems.ParameterBuilder
 	Error   string
 }{
 	{Builder: gemsV14.NewParameterBuilder().Name("Invalid Name").String("Test"), Error: "cannot contain spaces"},
 	{Builder: gemsV14.NewParameterBuilder().Name("Non-ASCII").String("你哈世界"), Error: "non-ASCII characters"},
+	{Builder: gemsV14.NewParameterBuilder().Name("Byte").Byte(-129), Error: "byte value -129 out of range [-128, 127]"},
+	{Builder: gemsV14.NewParameterBuilder().Name("Ubyte").Ubyte(300), Error: "ubyte value 300 out of range [0, 255]"},
+	{Builder: gemsV14.NewParameterBuilder().Name("Short").Short(1, 40000), Error: "short value 40000 out of range [-32768, 32767]"},
+	{Builder: gemsV14.NewParameterBuilder().Name("Ushort").Ushort(-1), Error: "ushort value -1 out of range [0, 65535]"},
+	{Builder: gemsV14.NewParameterBuilder().Name("Int").Int(1 << 31), Error: "int value 2147483648 out of range [-2147483648, 2147483647]"},
+	{Builder: gemsV14.NewParameterBuilder().Name("Uint").Uint(1 << 32), Error: "uint value 4294967296 out of range [0, 4294967295]"},
+	{Builder: gemsV14.NewParameterBuilder().Name("Ubyte").Ubyte(300).String("later"), Error: "ubyte value 300 out of range"},
+	{Builder: gemsV14.NewParameterBuilder().Name("Hex").HexValue("FAF320"), Error: "invalid hex_value value 'FAF320'"},
+	{Builder: gemsV14.NewParameterBuilder().Name("Time").Time("yesterday"), Error: "invalid time value 'yesterday'"},
+	{Builder: gemsV14.NewParameterBuilder().Name("Utime").Utime("2009-273T09:14:50"), Error: "invalid utime value '2009-273T09:14:50'"},
+}
+
+var parameterBuildTests = []struct {
+	Builder     gems.ParameterBuilder
+	ExpectASCII string
+}{
+	{Builder: gemsV14.GemsV14{}.NewParameterBuilder().Name("Byte").Byte(-128, 127), ExpectASCII: "Byte:byte[2]=-128,127"},
+	{Builder: gemsV14.GemsV14{}.NewParameterBuilder().Name("Ubyte").Ubyte(0, 255), ExpectASCII: "Ubyte:ubyte[2]=0,255"},
+	{Builder: gemsV14.GemsV14{}.NewParameterBuilder().Name("Uint").Uint(4294967295), ExpectASCII: "Uint:uint=4294967295"},
+	{Builder: gemsV14.GemsV14{}.NewParameterBuilder().Name("Long").Long(math.MinInt64), ExpectASCII: "Long:long=-9223372036854775808"},
+	{Builder: gemsV14.GemsV14{}.NewParameterBuilder().Name("Ulong").Ulong(math.MaxInt64), ExpectASCII: "Ulong:ulong=9223372036854775807"},
+	{Builder: gemsV14.GemsV14{}.NewParameterBuilder().Name("Ulong").Ulong(0, math.MaxUint64), ExpectASCII: "Ulong:ulong[2]=0,18446744073709551615"},
+	{Builder: gemsV14.GemsV14{}.NewParameterBuilder().Name("Utime").Utime("2009-273T09:14:50.02Z"), ExpectASCII: "Utime:utime=2009-273T09:14:50.020000000Z"},
+	{Builder: gemsV14.GemsV14{}.NewParameterBuilder().Name("Set").Parameters(intValue), ExpectASCII: "Set:set_type=IntValue:int=1024;"},
+	{Builder: gemsV14.GemsV14{}.NewParameterBuilder().Name("Set").Parameters(intValue, stringValue), ExpectASCII: "Set:set_type=IntValue:int=1024;StringValue:string=My String;"},
+}
+
+func TestBuildParameterValues(t *testing.T) {
+	for i, test := range parameterBuildTests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			p, err := test.Builder.Build()
+			if err != nil {
+				t.Fatalf("build error: %s", err)
+			}
+			if have := p.String(); have != test.ExpectASCII {
+				t.Errorf("incorrect parameter:\nhave: %s\nwant: %s", have, test.ExpectASCII)
+			}
+		})
+	}
 }
 
 func TestBuildParameter(t *testing.T) {
@@ -266,3 +308,73 @@ func TestBuildParameter(t *testing.T) {
 		})
 	}
 }
+
+var ulongMax, _ = gemsV14.UnmarshalParameterASCII([]byte("UlongMax:ulong=18446744073709551615"))
+
+var parameterAccessorTests = []struct {
+	Value  gems.Parameter
+	Get    func(gems.Parameter) (any, error)
+	Expect any
+	Error  string
+}{
+	{Value: intList, Get: int64s, Expect: []int64{1024, 1, 2, 3}},
+	{Value: ubyteValue, Get: int64s, Expect: []int64{255}},
+	{Value: emptyIntList, Get: int64s, Expect: []int64{}},
+	{Value: ulongMax, Get: int64s, Error: "gems: ulong value 18446744073709551615 of parameter 'UlongMax' overflows int64"},
+	{Value: doubleValue, Get: int64s, Error: "gems: cannot convert double value of parameter 'DoubleValue' to int64"},
+	{Value: doubleList, Get: float64s, Expect: []float64{1.234, 11234567890.0}},
+	{Value: longList, Get: float64s, Expect: []float64{123456789, -1, 234569999}},
+	{Value: ulongMax, Get: float64s, Expect: []float64{math.MaxUint64}},
+	{Value: boolValue, Get: float64s, Error: "cannot convert boolean value of parameter 'BoolValue' to float64"},
+	{Value: stringList, Get: strings_, Expect: []string{"Item 1", "Item 2"}},
+	{Value: xmlEscapeString, Get: strings_, Expect: []string{"Escape&This"}},
+	{Value: intValue, Get: strings_, Expect: []string{"1024"}},
+	{Value: emptyStringList, Get: strings_, Expect: []string{}},
+	{Value: singleParameterSet, Get: strings_, Error: "cannot convert Parameter value of parameter 'SingleParameterSet' to string"},
+	{Value: boolList, Get: bools, Expect: []bool{true, false, true}},
+	{Value: stringValue, Get: bools, Error: "cannot convert string value of parameter 'StringValue' to bool"},
+	{Value: hexList, Get: bytes_, Expect: [][]byte{{0xFA, 0xF3, 0x20}, {0xEB, 0x90}}},
+	{Value: intValue, Get: bytes_, Error: "cannot convert int value of parameter 'IntValue' to []byte"},
+	{Value: timeValue, Get: times, Expect: []time.Time{time.Date(2014, time.September, 15, 18, 2, 58, 490230000, time.UTC)}},
+	{Value: utimeList, Get: times, Expect: []time.Time{
+		time.Date(2009, time.September, 30, 9, 14, 50, 20000000, time.UTC),
+		time.Date(2014, time.April, 10, 9, 14, 50, 20000000, time.UTC),
+	}},
+	{Value: longValue, Get: times, Error: "cannot convert long value of parameter 'LongValue' to time.Time"},
+	{Value: singleParameterSet, Get: children, Expect: []gems.Parameter{channel0Name, channel0Id, channel0BitRates}},
+	{Value: parameterSetList, Get: children, Expect: []gems.Parameter{channel0, channel1, channel2}},
+	{Value: intList, Get: children, Error: "cannot convert int value of parameter 'IntList' to []gems.Parameter"},
+}
+
+func int64s(p gems.Parameter) (any, error)   { return p.Int64s() }
+func float64s(p gems.Parameter) (any, error) { return p.Float64s() }
+func strings_(p gems.Parameter) (any, error) { return p.Strings() }
+func bools(p gems.Parameter) (any, error)    { return p.Bools() }
+func bytes_(p gems.Parameter) (any, error)   { return p.Bytes() }
+func times(p gems.Parameter) (any, error)    { return p.Times() }
+func children(p gems.Parameter) (any, error) { return p.Children() }
+
+func TestParameterAccessors(t *testing.T) {
+	for i, test := range parameterAccessorTests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			have, err := test.Get(test.Value)
+			if test.Error != "" {
+				var convErr *gems.ConversionError
+				if err == nil {
+					t.Errorf("conversion succeeded (%#v), want error %q", have, test.Error)
+				} else if !errors.As(err, &convErr) {
+					t.Errorf("incorrect error type %T, want *gems.ConversionError", err)
+				} else if !strings.Contains(err.Error(), test.Error) {
+					t.Errorf("incorrect error:\nhave: %s,\nwant: %q", err, test.Error)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("conversion error: %s", err)
+			}
+			if !reflect.DeepEqual(have, test.Expect) {
+				t.Errorf("incorrect values:\nhave: %#v\nwant: %#v", have, test.Expect)
+			}
+		})
+	}
+}
@@ -0,0 +1,402 @@
+package gemsV14_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gems "github.com/mitre/gems/src"
+)
+
+// listenTCP starts a listener on 127.0.0.1 serving each connection with
+// serve until the test ends.
+func listenTCP(t *testing.T, serve func(net.Conn)) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen error: %s", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				serve(conn)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// echoServer returns the address of a server that echoes what it reads.
+func echoServer(t *testing.T) string {
+	return listenTCP(t, func(conn net.Conn) { io.Copy(conn, conn) })
+}
+
+// tunnel connects conn to port on 127.0.0.1, whatever host the client
+// asked for, and copies data both ways.
+func tunnel(conn net.Conn, r io.Reader, port int) {
+	target, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return
+	}
+	defer target.Close()
+
+	go io.Copy(target, r)
+	io.Copy(conn, target)
+}
+
+// fakeSOCKS5 is a SOCKS5 server that records the handshake of its last
+// client.
+type fakeSOCKS5 struct {
+	// Method is the authentication method chosen, AuthStatus the status of
+	// the username/password authentication, Reply the REP code and Bound
+	// the ATYP of the bound address in the reply.
+	Method     byte
+	AuthStatus byte
+	Reply      byte
+	Bound      byte
+
+	mu       sync.Mutex
+	methods  []byte
+	user     string
+	password string
+	atyp     byte
+	host     string
+}
+
+func (s *fakeSOCKS5) serve(conn net.Conn) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return
+	}
+	methods := make([]byte, header[1])
+	io.ReadFull(conn, methods)
+	s.mu.Lock()
+	s.methods = methods
+	s.mu.Unlock()
+
+	conn.Write([]byte{0x05, s.Method})
+	switch s.Method {
+	case 0x02:
+		// The version of the username/password negotiation comes first.
+		io.ReadFull(conn, make([]byte, 1))
+		user, password := readSOCKS5String(conn), readSOCKS5String(conn)
+		s.mu.Lock()
+		s.user, s.password = user, password
+		s.mu.Unlock()
+		conn.Write([]byte{0x01, s.AuthStatus})
+		if s.AuthStatus != 0x00 {
+			return
+		}
+	case 0xff:
+		return
+	}
+
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return
+	}
+	var host string
+	switch req[3] {
+	case 0x01:
+		ip := make(net.IP, net.IPv4len)
+		io.ReadFull(conn, ip)
+		host = ip.String()
+	case 0x04:
+		ip := make(net.IP, net.IPv6len)
+		io.ReadFull(conn, ip)
+		host = ip.String()
+	case 0x03:
+		host = readSOCKS5String(conn)
+	}
+	port := make([]byte, 2)
+	io.ReadFull(conn, port)
+	s.mu.Lock()
+	s.atyp, s.host = req[3], host
+	s.mu.Unlock()
+
+	reply := []byte{0x05, s.Reply, 0x00, s.Bound}
+	switch s.Bound {
+	case 0x01:
+		reply = append(reply, 127, 0, 0, 1)
+	case 0x04:
+		reply = append(reply, net.IPv6loopback...)
+	case 0x03:
+		reply = append(reply, 5)
+		reply = append(reply, "proxy"...)
+	}
+	conn.Write(append(reply, 0x04, 0x38))
+	if s.Reply == 0x00 {
+		tunnel(conn, conn, int(binary.BigEndian.Uint16(port)))
+	}
+}
+
+// readSOCKS5String reads a string preceded by its length.
+func readSOCKS5String(r io.Reader) string {
+	n := make([]byte, 1)
+	io.ReadFull(r, n)
+	b := make([]byte, n[0])
+	io.ReadFull(r, b)
+	return string(b)
+}
+
+var socks5Tests = []struct {
+	Name   string
+	User   *url.Userinfo
+	Host   string
+	Server *fakeSOCKS5
+	// Err is a substring of the dial error, or "" if the tunnel opens.
+	Err     string
+	Methods []byte
+	ATYP    byte
+	Creds   string
+}{
+	{Name: "no auth IPv4", Host: "127.0.0.1", Server: &fakeSOCKS5{Method: 0x00, Bound: 0x01}, Methods: []byte{0x00}, ATYP: 0x01},
+	{Name: "no auth IPv6", Host: "::1", Server: &fakeSOCKS5{Method: 0x00, Bound: 0x01}, Methods: []byte{0x00}, ATYP: 0x04},
+	{Name: "no auth domain", Host: "device.example", Server: &fakeSOCKS5{Method: 0x00, Bound: 0x01}, Methods: []byte{0x00}, ATYP: 0x03},
+	{Name: "bound IPv6", Host: "127.0.0.1", Server: &fakeSOCKS5{Method: 0x00, Bound: 0x04}, Methods: []byte{0x00}, ATYP: 0x01},
+	{Name: "bound domain", Host: "127.0.0.1", Server: &fakeSOCKS5{Method: 0x00, Bound: 0x03}, Methods: []byte{0x00}, ATYP: 0x01},
+	{
+		Name: "user/pass", User: url.UserPassword("gems", "s3cret"), Host: "device.example",
+		Server: &fakeSOCKS5{Method: 0x02, Bound: 0x01}, Methods: []byte{0x00, 0x02}, ATYP: 0x03, Creds: "gems:s3cret",
+	},
+	{
+		Name: "credentials offered but not required", User: url.UserPassword("gems", "s3cret"), Host: "127.0.0.1",
+		Server: &fakeSOCKS5{Method: 0x00, Bound: 0x01}, Methods: []byte{0x00, 0x02}, ATYP: 0x01,
+	},
+	{
+		Name: "user/pass rejected", User: url.UserPassword("gems", "wrong"), Host: "127.0.0.1",
+		Server: &fakeSOCKS5{Method: 0x02, AuthStatus: 0x01}, Methods: []byte{0x00, 0x02}, Creds: "gems:wrong",
+		Err: "SOCKS5 authentication failed",
+	},
+	{Name: "auth required", Host: "127.0.0.1", Server: &fakeSOCKS5{Method: 0x02}, Methods: []byte{0x00}, Err: "SOCKS5 server requires authentication"},
+	{Name: "no acceptable method", Host: "127.0.0.1", Server: &fakeSOCKS5{Method: 0xff}, Methods: []byte{0x00}, Err: "no acceptable SOCKS5 authentication method"},
+	{
+		Name: "connection refused", Host: "127.0.0.1", Server: &fakeSOCKS5{Method: 0x00, Reply: 0x05, Bound: 0x01},
+		Methods: []byte{0x00}, ATYP: 0x01, Err: "SOCKS5 connect failed: connection refused",
+	},
+	{
+		Name: "unknown reply", Host: "device.example", Server: &fakeSOCKS5{Method: 0x00, Reply: 0x42, Bound: 0x01},
+		Methods: []byte{0x00}, ATYP: 0x03, Err: "SOCKS5 connect failed with reply 66",
+	},
+	{
+		Name: "unknown bound address type", Host: "127.0.0.1", Server: &fakeSOCKS5{Method: 0x00, Bound: 0x07},
+		Methods: []byte{0x00}, ATYP: 0x01, Err: "unknown SOCKS5 address type 7",
+	},
+}
+
+// checkTunnel writes to conn and expects it to be echoed.
+func checkTunnel(t *testing.T, conn net.Conn) {
+	t.Helper()
+
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Write([]byte("|GEMS|")); err != nil {
+		t.Fatalf("write error: %s", err)
+	}
+	echo := make([]byte, 6)
+	if _, err := io.ReadFull(conn, echo); (err != nil) || (string(echo) != "|GEMS|") {
+		t.Errorf("incorrect echo %q: %v", echo, err)
+	}
+}
+
+func TestProxyDialSOCKS5(t *testing.T) {
+	_, port, _ := net.SplitHostPort(echoServer(t))
+
+	for _, test := range socks5Tests {
+		t.Run(test.Name, func(t *testing.T) {
+			server := test.Server
+			proxyURL := &url.URL{Scheme: "socks5", Host: listenTCP(t, server.serve), User: test.User}
+
+			conn, err := gems.ProxyDial(proxyURL, nil)(context.Background(), "tcp", net.JoinHostPort(test.Host, port))
+			switch {
+			case (test.Err == "") && (err != nil):
+				t.Fatalf("unexpected error: %s", err)
+			case (test.Err != "") && ((err == nil) || !strings.Contains(err.Error(), test.Err)):
+				t.Errorf("incorrect error: have %v, want %s", err, test.Err)
+			case err == nil:
+				defer conn.Close()
+				checkTunnel(t, conn)
+			}
+
+			server.mu.Lock()
+			defer server.mu.Unlock()
+			if string(server.methods) != string(test.Methods) {
+				t.Errorf("incorrect methods: have %v, want %v", server.methods, test.Methods)
+			}
+			if server.atyp != test.ATYP {
+				t.Errorf("incorrect ATYP: have %d, want %d", server.atyp, test.ATYP)
+			}
+			if (test.ATYP != 0) && (server.host != test.Host) {
+				t.Errorf("incorrect host: have %s, want %s", server.host, test.Host)
+			}
+			if creds := server.user + ":" + server.password; (test.Creds != "") && (creds != test.Creds) {
+				t.Errorf("incorrect credentials: have %s, want %s", creds, test.Creds)
+			}
+		})
+	}
+}
+
+// fakeConnectProxy is an HTTP proxy answering CONNECT requests with
+// Status. A tunnel writes Early to the client along with the response,
+// as if the device had sent it at once.
+type fakeConnectProxy struct {
+	Status int
+	Early  string
+
+	mu    sync.Mutex
+	req   *http.Request
+	proxy string
+}
+
+func (p *fakeConnectProxy) serve(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	req, err := http.ReadRequest(r)
+	if err != nil {
+		return
+	}
+	p.mu.Lock()
+	p.req = req
+	p.mu.Unlock()
+
+	resp := "HTTP/1.1 " + strconv.Itoa(p.Status) + " " + http.StatusText(p.Status) + "\r\n"
+	if p.Status == http.StatusProxyAuthRequired {
+		resp += "Proxy-Authenticate: Basic realm=\"gems\"\r\nContent-Length: 0\r\n"
+	}
+	conn.Write([]byte(resp + "\r\n" + p.Early))
+	if p.Status != http.StatusOK {
+		return
+	}
+
+	_, port, _ := net.SplitHostPort(req.Host)
+	n, _ := strconv.Atoi(port)
+	tunnel(conn, r, n)
+}
+
+var connectTests = []struct {
+	Name  string
+	User  *url.Userinfo
+	Proxy *fakeConnectProxy
+	// Err is a substring of the dial error, or "" if the tunnel opens.
+	Err  string
+	Auth string
+}{
+	{Name: "200", Proxy: &fakeConnectProxy{Status: http.StatusOK}},
+	{
+		Name: "200 with credentials", User: url.UserPassword("gems", "s3cret"), Proxy: &fakeConnectProxy{Status: http.StatusOK},
+		Auth: "Basic " + base64.StdEncoding.EncodeToString([]byte("gems:s3cret")),
+	},
+	{Name: "200 followed by tunneled bytes", Proxy: &fakeConnectProxy{Status: http.StatusOK, Early: "|GEMS|14|early"}},
+	{Name: "407", Proxy: &fakeConnectProxy{Status: http.StatusProxyAuthRequired}, Err: "CONNECT failed: 407 Proxy Authentication Required"},
+	{Name: "502", Proxy: &fakeConnectProxy{Status: http.StatusBadGateway}, Err: "CONNECT failed: 502 Bad Gateway"},
+}
+
+func TestProxyDialConnect(t *testing.T) {
+	addr := echoServer(t)
+
+	for _, test := range connectTests {
+		t.Run(test.Name, func(t *testing.T) {
+			proxy := test.Proxy
+			proxyURL := &url.URL{Scheme: "http", Host: listenTCP(t, proxy.serve), User: test.User}
+
+			conn, err := gems.ProxyDial(proxyURL, nil)(context.Background(), "tcp", addr)
+			switch {
+			case (test.Err == "") && (err != nil):
+				t.Fatalf("unexpected error: %s", err)
+			case (test.Err != "") && ((err == nil) || !strings.Contains(err.Error(), test.Err)):
+				t.Errorf("incorrect error: have %v, want %s", err, test.Err)
+			case err == nil:
+				defer conn.Close()
+
+				// Bytes read with the response are returned before the tunnel.
+				conn.SetDeadline(time.Now().Add(2 * time.Second))
+				early := make([]byte, len(proxy.Early))
+				if _, err := io.ReadFull(conn, early); (err != nil) || (string(early) != proxy.Early) {
+					t.Errorf("incorrect tunneled bytes %q: %v", early, err)
+				}
+				checkTunnel(t, conn)
+			}
+
+			proxy.mu.Lock()
+			defer proxy.mu.Unlock()
+			if (proxy.req.Method != http.MethodConnect) || (proxy.req.RequestURI != addr) || (proxy.req.Host != addr) {
+				t.Errorf("incorrect request: %s %s Host %s", proxy.req.Method, proxy.req.RequestURI, proxy.req.Host)
+			}
+			if have := proxy.req.Header.Get("Proxy-Authorization"); have != test.Auth {
+				t.Errorf("incorrect Proxy-Authorization: have '%s', want '%s'", have, test.Auth)
+			}
+			if have := proxy.req.Header.Get("Authorization"); have != "" {
+				t.Errorf("unexpected Authorization: %s", have)
+			}
+		})
+	}
+
+	if _, err := gems.ProxyDial(&url.URL{Scheme: "ftp", Host: "proxy"}, nil)(context.Background(), "tcp", addr); (err == nil) ||
+		!strings.Contains(err.Error(), "unsupported proxy scheme 'ftp'") {
+		t.Errorf("incorrect error for an unsupported scheme: %v", err)
+	}
+}
+
+func TestClientWithProxy(t *testing.T) {
+	server := gems.NewASCIIServer("", namedHandler("device"), gems.BodyFormatter{}, v, "")
+	server.Start()
+	defer server.Close()
+
+	proxies := map[string]func(net.Conn){
+		"socks5": (&fakeSOCKS5{Method: 0x02, Bound: 0x01}).serve,
+		"http":   (&fakeConnectProxy{Status: http.StatusOK}).serve,
+	}
+	// The proxy applies whether it is set before or after the transport.
+	orders := map[string]func(gems.ClientOption) []gems.ClientOption{
+		"default transport": func(proxy gems.ClientOption) []gems.ClientOption {
+			return []gems.ClientOption{proxy}
+		},
+		"proxy first": func(proxy gems.ClientOption) []gems.ClientOption {
+			transport, _ := gems.NewTransport("ascii", nil)
+			return []gems.ClientOption{proxy, gems.WithTransport(transport)}
+		},
+		"transport first": func(proxy gems.ClientOption) []gems.ClientOption {
+			transport, _ := gems.NewTransport("ascii", nil)
+			return []gems.ClientOption{gems.WithTransport(transport), proxy}
+		},
+	}
+	for scheme, serve := range proxies {
+		for order, opts := range orders {
+			t.Run(scheme+"/"+order, func(t *testing.T) {
+				proxyURL := &url.URL{Scheme: scheme, Host: listenTCP(t, serve), User: url.UserPassword("gems", "s3cret")}
+				client, err := gems.NewClient(v, "ascii", gems.DefaultFormatter{}, opts(gems.WithProxy(proxyURL))...)
+				if err != nil {
+					t.Fatalf("client error: %s", err)
+				}
+				if err := client.Connect(server.Addr(), gems.ConnectionTypeControlAndStatus, "", target); err != nil {
+					t.Fatalf("connect error: %s", err)
+				}
+				defer client.Disconnect(gems.DisconnectReasonNormalTermination)
+
+				resp, err := client.Ping()
+				if err != nil {
+					t.Fatalf("ping error: %s", err)
+				}
+				if resp.Result().Description != "device" {
+					t.Errorf("incorrect response: %s", client.Format(resp))
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package gemsV14_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	gems "github.com/mitre/gems/src"
+)
+
+// namedHandler answers every message with its name as the response
+// description, so a test can tell which handler a Router chose.
+func namedHandler(name string) gems.MessageHandler {
+	return func(m gems.Message, v gems.Version) (gems.Response, error) {
+		msg, err := v.NewMessageBuilder().Type(m.Type().ResponseType()).Target(m.Target()).TransactionID(m.TransactionID().Int64).
+			ResultCode(gems.ResultCodeSuccess).ResponseDescription(name).Build()
+		if err != nil {
+			return nil, err
+		}
+		resp, _ := msg.(gems.Response)
+		return resp, nil
+	}
+}
+
+func newTestRouter() *gems.Router {
+	router := gems.NewRouter()
+	router.Register("Rack/Receiver", namedHandler("receiver"))
+	router.Register("", namedHandler("default"))
+	router.Register("Rack/Modem", namedHandler("modem"))
+	return router
+}
+
+func TestRouterTargets(t *testing.T) {
+	router := newTestRouter()
+
+	want := []string{"", "Rack/Modem", "Rack/Receiver"}
+	if have := router.Targets(); !reflect.DeepEqual(have, want) {
+		t.Errorf("incorrect targets: have %q, want %q", have, want)
+	}
+
+	for _, target := range want {
+		if !router.HasTarget(target) {
+			t.Errorf("missing target '%s'", target)
+		}
+	}
+	if router.HasTarget("Rack/Antenna") {
+		t.Error("unexpected target 'Rack/Antenna'")
+	}
+}
+
+var routerTests = []struct {
+	Name   string
+	Type   gems.MessageType
+	Target string
+	Expect gems.Result
+}{
+	{
+		Name:   "receiver",
+		Type:   gems.PingMessageType,
+		Target: "Rack/Receiver",
+		Expect: gems.Result{Code: gems.ResultCodeSuccess, Description: "receiver"},
+	},
+	{
+		Name:   "modem",
+		Type:   gems.GetConfigListMessageType,
+		Target: "Rack/Modem",
+		Expect: gems.Result{Code: gems.ResultCodeSuccess, Description: "modem"},
+	},
+	{
+		Name:   "no target",
+		Type:   gems.PingMessageType,
+		Expect: gems.Result{Code: gems.ResultCodeSuccess, Description: "default"},
+	},
+	{
+		Name:   "unknown target",
+		Type:   gems.PingMessageType,
+		Target: "Rack/Antenna",
+		Expect: gems.Result{Code: gems.ResultCodeInvalidTarget, Description: "Target Rack/Antenna does not exist in this system"},
+	},
+	{
+		Name:   "unknown target directive",
+		Type:   gems.DirectiveMessageType,
+		Target: "rack/receiver",
+		Expect: gems.Result{Code: gems.ResultCodeInvalidTarget, Description: "Target rack/receiver does not exist in this system"},
+	},
+}
+
+func TestRouterHandle(t *testing.T) {
+	router := newTestRouter()
+
+	for _, test := range routerTests {
+		t.Run(test.Name, func(t *testing.T) {
+			mb := v.NewMessageBuilder().Type(test.Type).Target(test.Target).TransactionID(42)
+			if test.Type == gems.DirectiveMessageType {
+				mb = mb.Directive("Reboot")
+			}
+			msg, err := mb.Build()
+			if err != nil {
+				t.Fatalf("build error: %s", err)
+			}
+
+			resp, err := router.Handle(msg, v)
+			if err != nil {
+				t.Fatalf("handle error: %s", err)
+			}
+			if resp.Result() != test.Expect {
+				t.Errorf("incorrect result: have %v, want %v", resp.Result(), test.Expect)
+			}
+			if resp.Type() != test.Type.ResponseType() {
+				t.Errorf("incorrect type: have %s, want %s", resp.Type(), test.Type.ResponseType())
+			}
+			if resp.Target() != test.Target {
+				t.Errorf("incorrect target: have '%s', want '%s'", resp.Target(), test.Target)
+			}
+			if have := resp.TransactionID(); !have.Valid || have.Int64 != 42 {
+				t.Errorf("incorrect transaction ID: have %v, want 42", have)
+			}
+		})
+	}
+}
+
+func TestRouterServer(t *testing.T) {
+	router := newTestRouter()
+	server := gems.NewASCIIServer("", router.Handle, gems.BodyFormatter{}, v, "", gems.WithTargetFilter(router.HasTarget))
+	server.Start()
+	defer server.Close()
+
+	connect := func(target string) (*gems.Client, error) {
+		transport, err := gems.NewPipeTransport("ascii", server)
+		if err != nil {
+			t.Fatalf("transport error: %s", err)
+		}
+		client, err := gems.NewClient(v, "ascii", gems.DefaultFormatter{}, gems.WithTransport(transport))
+		if err != nil {
+			t.Fatalf("client error: %s", err)
+		}
+		return client, client.Connect("device", gems.ConnectionTypeControlAndStatus, "", target)
+	}
+
+	for target, want := range map[string]string{"Rack/Receiver": "receiver", "Rack/Modem": "modem"} {
+		client, err := connect(target)
+		if err != nil {
+			t.Fatalf("connect error: %s", err)
+		}
+		resp, err := client.Ping()
+		if err != nil {
+			t.Fatalf("ping error: %s", err)
+		}
+		if resp.Result().Description != want {
+			t.Errorf("incorrect handler for '%s': have %s, want %s", target, resp.Result().Description, want)
+		}
+		client.Disconnect(gems.DisconnectReasonNormalTermination)
+	}
+
+	if _, err := connect("Rack/Antenna"); !errors.Is(err, gems.ErrInvalidTarget) {
+		t.Errorf("incorrect connect error: have %v, want %v", err, gems.ErrInvalidTarget)
+	}
+}
@@ -0,0 +1,165 @@
+//go:build linux
+
+package gemsV14_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	gems "github.com/mitre/gems/src"
+)
+
+// openPTY opens a pseudo-terminal pair and returns its master and the path
+// of its slave. The test is skipped if pseudo-terminals are unavailable.
+func openPTY(t *testing.T) (*os.File, string) {
+	t.Helper()
+
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("pseudo-terminals are unavailable: %s", err)
+	}
+	t.Cleanup(func() { master.Close() })
+
+	var unlock, n int32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); errno != 0 {
+		t.Skipf("failed to unlock the pseudo-terminal: %s", errno)
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); errno != 0 {
+		t.Skipf("failed to get the pseudo-terminal number: %s", errno)
+	}
+
+	path := fmt.Sprintf("/dev/pts/%d", n)
+	if _, err := os.Stat(path); err != nil {
+		t.Skipf("pseudo-terminal slave is unavailable: %s", err)
+	}
+	return master, path
+}
+
+// relay copies what the slave of src sends to the slave of dst, like a
+// null-modem cable between two serial lines. Masters fail with EIO while
+// their slave is closed, as between sessions, so the relay waits for the
+// slave to be reopened.
+func relay(dst *os.File, src *os.File) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := src.Read(buf)
+		for written := 0; written < n; {
+			m, err := dst.Write(buf[written:n])
+			written += m
+			switch {
+			case errors.Is(err, syscall.EIO):
+				time.Sleep(10 * time.Millisecond)
+			case err != nil:
+				return
+			}
+		}
+		switch {
+		case errors.Is(err, syscall.EIO):
+			time.Sleep(10 * time.Millisecond)
+		case err != nil:
+			return
+		}
+	}
+}
+
+// waitForLine waits until the server has opened the serial line for a new
+// session, as bytes sent before then are lost.
+func waitForLine(t *testing.T, server gems.Server) {
+	t.Helper()
+
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if sessions := server.Sessions(); (len(sessions) == 1) && !sessions[0].Connected {
+			return
+		}
+	}
+	t.Fatalf("serial line was not opened: %+v", server.Sessions())
+}
+
+func TestSerialClientServer(t *testing.T) {
+	serverMaster, serverPath := openPTY(t)
+	clientMaster, clientPath := openPTY(t)
+	go relay(clientMaster, serverMaster)
+	go relay(serverMaster, clientMaster)
+
+	server := gems.NewASCIIServer("serial:"+serverPath+":9600", namedHandler("device"), gems.BodyFormatter{}, v, "")
+	server.Start()
+	defer server.Close()
+	if server.Addr() != serverPath {
+		t.Errorf("incorrect server address: have %s, want %s", server.Addr(), serverPath)
+	}
+
+	// The line is reopened for each session in turn.
+	for session := 0; session < 2; session++ {
+		waitForLine(t, server)
+		client, err := gems.NewClient(v, "ascii", gems.DefaultFormatter{}, gems.WithClientTimeout(2*time.Second))
+		if err != nil {
+			t.Fatalf("client error: %s", err)
+		}
+		if err := client.Connect("serial:"+clientPath+":115200", gems.ConnectionTypeControlAndStatus, "", target); err != nil {
+			t.Fatalf("session %d: connect error: %s", session, err)
+		}
+
+		resp, err := client.Ping()
+		if err != nil {
+			t.Fatalf("session %d: ping error: %s", session, err)
+		}
+		if (resp.Type() != gems.PingResponseType) || (resp.Result().Description != "device") {
+			t.Errorf("session %d: incorrect response: %s", session, client.Format(resp))
+		}
+		if err := client.Disconnect(gems.DisconnectReasonNormalTermination); err != nil {
+			t.Errorf("session %d: disconnect error: %s", session, err)
+		}
+	}
+}
+
+func TestSerialAddr(t *testing.T) {
+	_, path := openPTY(t)
+	notTerminal := filepath.Join(t.TempDir(), "tty")
+	if err := os.WriteFile(notTerminal, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Name string
+		Addr string
+		// Err is a substring of the connect error.
+		Err string
+	}{
+		{Name: "unsupported baud rate", Addr: "serial:" + path + ":1234", Err: "unsupported baud rate 1234"},
+		{Name: "negative baud rate", Addr: "serial:" + path + ":-9600", Err: "unsupported baud rate -9600"},
+		// A suffix that is not a number is part of the path.
+		{Name: "non-numeric baud rate", Addr: "serial:" + path + ":fast", Err: path + ":fast: no such file or directory"},
+		{Name: "missing path", Addr: "serial:/dev/gems-missing:9600", Err: "/dev/gems-missing: no such file or directory"},
+		{Name: "empty path", Addr: "serial:", Err: "no such file or directory"},
+		{Name: "not a terminal", Addr: "serial:" + notTerminal, Err: "failed to configure " + notTerminal},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			client, err := gems.NewClient(v, "ascii", gems.DefaultFormatter{})
+			if err != nil {
+				t.Fatalf("client error: %s", err)
+			}
+			err = client.Connect(test.Addr, gems.ConnectionTypeControlAndStatus, "", target)
+			if (err == nil) || !strings.Contains(err.Error(), test.Err) {
+				t.Errorf("incorrect error: have %v, want %s", err, test.Err)
+			}
+		})
+	}
+
+	// The baud rate is optional.
+	conn, err := gems.OpenSerial(path, 0)
+	if err != nil {
+		t.Fatalf("open error: %s", err)
+	}
+	if conn.RemoteAddr().String() != path {
+		t.Errorf("incorrect address: %s", conn.RemoteAddr())
+	}
+	conn.Close()
+}
@@ -0,0 +1,306 @@
+package gemsV14_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	gems "github.com/mitre/gems/src"
+)
+
+var streamedParameters = []gems.Parameter{packetLength, fillPacket, emptyStringList, emptyIntList, channelConfigList}
+
+func parameterStrings(params []gems.Parameter) []string {
+	s := make([]string, len(params))
+	for i, p := range params {
+		s[i] = p.String()
+	}
+	return s
+}
+
+func TestDecodeXMLMessage(t *testing.T) {
+	for i, test := range messageMarshalTests {
+		if test.ExpectXML == "" {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			msg, err := gems.DecodeXMLMessage(bytes.NewReader([]byte(test.ExpectXML)), v, nil)
+			if err != nil {
+				t.Fatalf("decode error: %s", err)
+			}
+			if !reflect.DeepEqual(msg.Body(), test.Value.Body()) {
+				t.Errorf("incorrect message:\nhave: %v\nwant: %v", msg.Body(), test.Value.Body())
+			}
+		})
+	}
+}
+
+func TestDecodeXMLMessageFunc(t *testing.T) {
+	out, err := xml.Marshal(getConfigResponse)
+	if err != nil {
+		t.Fatalf("marshal error: %s", err)
+	}
+
+	var params []gems.Parameter
+	msg, err := gems.DecodeXMLMessage(bytes.NewReader(out), v, func(p gems.Parameter) error {
+		params = append(params, p)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+	if have, want := parameterStrings(params), parameterStrings(streamedParameters); !reflect.DeepEqual(have, want) {
+		t.Errorf("incorrect parameters:\nhave: %v\nwant: %v", have, want)
+	}
+	if have := msg.(gems.ParameterMessage).ParameterList(); len(have) != 0 {
+		t.Errorf("parameters kept in message: %v", have)
+	}
+	if (msg.Type() != gems.GetConfigResponseType) || (msg.Target() != target) {
+		t.Errorf("incorrect header: %s %s", msg.Type(), msg.Target())
+	}
+
+	stop := errors.New("stop")
+	count := 0
+	_, err = gems.DecodeXMLMessage(bytes.NewReader(out), v, func(p gems.Parameter) error {
+		count++
+		return stop
+	})
+	if !errors.Is(err, stop) || (count != 1) {
+		t.Errorf("decoding did not stop: %d parameters, error %v", count, err)
+	}
+}
+
+func TestDecodeXMLMessageFuncElements(t *testing.T) {
+	tests := []struct {
+		Name string
+		Body string
+		// Expect are the names of the parameters passed to fn before Err,
+		// a substring of the decode error.
+		Expect      []string
+		Code        gems.ResultCode
+		Description string
+		Err         string
+	}{
+		{
+			Name:        "result and description",
+			Body:        `<Result>INVALID_STATE</Result><description>Bad channel</description><Parameter name="PacketLength"><int>1024</int></Parameter>`,
+			Expect:      []string{"PacketLength"},
+			Code:        gems.ResultCodeInvalidState,
+			Description: "Bad channel",
+		},
+		{
+			Name:   "unknown element skipped with its children",
+			Body:   `<Result>SUCCESS</Result><Extension><Parameter name="Hidden"><int>1</int></Parameter></Extension><Parameter name="PacketLength"><int>1024</int></Parameter>`,
+			Expect: []string{"PacketLength"},
+			Code:   gems.ResultCodeSuccess,
+		},
+		{
+			Name: "malformed result",
+			Body: `<Result>SUCCESS</Results><Parameter name="PacketLength"><int>1024</int></Parameter>`,
+			Err:  "element <Result> closed by </Results>",
+		},
+		{
+			Name: "malformed description",
+			Body: `<Result>INVALID_STATE</Result><description>Bad</Result>`,
+			Err:  "element <description> closed by </Result>",
+		},
+		{
+			Name: "malformed unknown element",
+			Body: `<Result>SUCCESS</Result><Extension><Parameter></Extension>`,
+			Err:  "element <Parameter> closed by </Extension>",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			data := `<GetConfigResponse gems_version="1.4" target="System/Device1" transaction_id="1">` + test.Body + `</GetConfigResponse>`
+			var names []string
+			msg, err := gems.DecodeXMLMessage(strings.NewReader(data), v, func(p gems.Parameter) error {
+				names = append(names, p.Name())
+				return nil
+			})
+			if !reflect.DeepEqual(names, test.Expect) {
+				t.Errorf("incorrect parameters: have %q, want %q", names, test.Expect)
+			}
+			if test.Err != "" {
+				if (err == nil) || !strings.Contains(err.Error(), test.Err) {
+					t.Errorf("incorrect error: have %v, want %s", err, test.Err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decode error: %s", err)
+			}
+			if result := msg.(gems.Response).Result(); (result.Code != test.Code) || (result.Description != test.Description) {
+				t.Errorf("incorrect result: %+v", result)
+			}
+		})
+	}
+}
+
+// getConfigHandler answers every GetConfigMessage with streamedParameters.
+func getConfigHandler(m gems.Message, v gems.Version) (gems.Response, error) {
+	msg, err := v.NewMessageBuilder().Type(gems.GetConfigResponseType).TransactionID(m.TransactionID().Int64).
+		ResultCode(gems.ResultCodeSuccess).Parameters(streamedParameters...).Build()
+	if err != nil {
+		return nil, err
+	}
+	resp, _ := msg.(gems.Response)
+	return resp, nil
+}
+
+func TestClientGetConfigFunc(t *testing.T) {
+	for _, psm := range []string{"xml", "ascii"} {
+		t.Run(psm, func(t *testing.T) {
+			server := clientErrorServers[psm](getConfigHandler, "")
+			server.Start()
+			defer server.Close()
+			transport, _ := gems.NewPipeTransport(psm, server)
+
+			client, err := gems.NewClient(v, psm, gems.DefaultFormatter{}, gems.WithTransport(transport))
+			if err != nil {
+				t.Fatalf("client error: %s", err)
+			}
+			if err := client.Connect("device", gems.ConnectionTypeControlAndStatus, "", target); err != nil {
+				t.Fatalf("connect error: %s", err)
+			}
+			defer client.Disconnect(gems.DisconnectReasonNormalTermination)
+
+			var params []gems.Parameter
+			resp, err := client.GetConfigFunc(func(p gems.Parameter) error {
+				params = append(params, p)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("get error: %s", err)
+			}
+			if resp.Type() != gems.GetConfigResponseType {
+				t.Errorf("incorrect response type %s", resp.Type())
+			}
+			if have, want := parameterStrings(params), parameterStrings(streamedParameters); !reflect.DeepEqual(have, want) {
+				t.Errorf("incorrect parameters:\nhave: %v\nwant: %v", have, want)
+			}
+		})
+	}
+}
+
+func TestClientMaxMessageSize(t *testing.T) {
+	for _, psm := range []string{"xml", "ascii"} {
+		for _, transportFirst := range []bool{true, false} {
+			t.Run(fmt.Sprintf("%s/transport first %t", psm, transportFirst), func(t *testing.T) {
+				server := clientErrorServers[psm](getConfigHandler, "")
+				server.Start()
+				defer server.Close()
+				transport, _ := gems.NewPipeTransport(psm, server)
+
+				opts := []gems.ClientOption{gems.WithTransport(transport), gems.WithClientMaxMessageSize(256)}
+				if !transportFirst {
+					opts[0], opts[1] = opts[1], opts[0]
+				}
+				client, err := gems.NewClient(v, psm, gems.DefaultFormatter{}, opts...)
+				if err != nil {
+					t.Fatalf("client error: %s", err)
+				}
+				if err := client.Connect("device", gems.ConnectionTypeControlAndStatus, "", target); err != nil {
+					t.Fatalf("connect error: %s", err)
+				}
+				defer client.Disconnect(gems.DisconnectReasonNormalTermination)
+
+				if _, err := client.GetConfig(); err == nil {
+					t.Errorf("get succeeded, want error")
+				} else if (psm == "xml") && !errors.Is(err, gems.ErrMessageTooLarge) {
+					t.Errorf("incorrect error: have %v, want %v", err, gems.ErrMessageTooLarge)
+				}
+			})
+		}
+	}
+}
+
+// customTransport is a Transport not created by gems.NewTransport.
+type customTransport struct {
+	gems.Transport
+}
+
+func TestClientOptionsCustomTransport(t *testing.T) {
+	for name, opt := range map[string]gems.ClientOption{
+		"timeout":          gems.WithClientTimeout(time.Second),
+		"max message size": gems.WithClientMaxMessageSize(256),
+		"proxy":            gems.WithProxy(&url.URL{Scheme: "socks5", Host: "proxy"}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := gems.NewClient(v, "ascii", gems.DefaultFormatter{}, opt, gems.WithTransport(customTransport{}))
+			if (err == nil) || !strings.Contains(err.Error(), "does not support") {
+				t.Errorf("incorrect error: %v", err)
+			}
+		})
+	}
+
+	if _, err := gems.NewClient(v, "ascii", gems.DefaultFormatter{}, gems.WithTransport(customTransport{})); err != nil {
+		t.Errorf("client error: %s", err)
+	}
+}
+
+func TestServerMaxMessageSize(t *testing.T) {
+	var malformed []gems.Event
+	server := gems.NewXMLServer("", getConfigHandler, gems.BodyFormatter{}, v, "",
+		gems.WithMaxMessageSize(512), gems.WithEventHandler(func(e gems.Event) {
+			if e.Type == gems.EventMalformed {
+				malformed = append(malformed, e)
+			}
+		}))
+	server.Start()
+	defer server.Close()
+	transport, _ := gems.NewPipeTransport("xml", server)
+
+	client, err := gems.NewClient(v, "xml", gems.DefaultFormatter{}, gems.WithTransport(transport))
+	if err != nil {
+		t.Fatalf("client error: %s", err)
+	}
+	if err := client.Connect("device", gems.ConnectionTypeControlAndStatus, "", target); err != nil {
+		t.Fatalf("connect error: %s", err)
+	}
+	defer client.Disconnect(gems.DisconnectReasonNormalTermination)
+
+	if _, err := client.GetConfig(strings.Repeat("Name", 200)); err == nil {
+		t.Errorf("get succeeded, want error")
+	}
+	if len(malformed) != 1 {
+		t.Fatalf("got %d malformed events, want 1", len(malformed))
+	}
+	if e := malformed[0]; !errors.Is(e.Err, gems.ErrMessageTooLarge) || (len(e.Data) != 512) {
+		t.Errorf("incorrect event: %d bytes, error %v", len(e.Data), e.Err)
+	}
+}
+
+func TestServerMaxMessageSizeStatus(t *testing.T) {
+	server := gems.NewXMLServer("", getConfigHandler, gems.BodyFormatter{}, v, "", gems.WithMaxMessageSize(512))
+	server.Start()
+	defer server.Close()
+
+	tests := []struct {
+		Name   string
+		Body   string
+		Status int
+	}{
+		{Name: "too large", Body: "<PingMessage>" + strings.Repeat(" ", 1024) + "</PingMessage>", Status: http.StatusRequestEntityTooLarge},
+		{Name: "malformed", Body: "<PingMessage>", Status: http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			resp, err := http.Post(server.Addr()+"/"+target, "text/xml", strings.NewReader(test.Body))
+			if err != nil {
+				t.Fatalf("post error: %s", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != test.Status {
+				t.Errorf("incorrect status: have %d, want %d", resp.StatusCode, test.Status)
+			}
+		})
+	}
+}
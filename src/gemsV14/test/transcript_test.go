@@ -0,0 +1,278 @@
+package gemsV14_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	gems "github.com/mitre/gems/src"
+	"github.com/mitre/gems/src/gemsV14"
+)
+
+// newRecordedHandler answers each request with a description that
+// identifies it: the directive or configuration name, the requested
+// parameter names, or a count of the PingMessages received.
+func newRecordedHandler() gems.MessageHandler {
+	var (
+		pings int
+		mu    sync.Mutex
+	)
+
+	return func(m gems.Message, v gems.Version) (gems.Response, error) {
+		var description string
+		switch msg := m.(type) {
+		case *gemsV14.PingMessage:
+			mu.Lock()
+			pings++
+			description = fmt.Sprintf("ping %d", pings)
+			mu.Unlock()
+		case *gemsV14.GetConfigMessage:
+			description = strings.Join(msg.DesiredParameters, ",")
+		case *gemsV14.DirectiveMessage:
+			description = msg.DirectiveName
+		case *gemsV14.LoadConfigMessage:
+			description = msg.ConfigName
+		}
+
+		msg, err := v.NewMessageBuilder().Type(m.Type().ResponseType()).Target(m.Target()).TransactionID(m.TransactionID().Int64).
+			ResultCode(gems.ResultCodeSuccess).ResponseDescription(description).Build()
+		if err != nil {
+			return nil, err
+		}
+		resp, _ := msg.(gems.Response)
+		return resp, nil
+	}
+}
+
+func newTranscriptClient(t *testing.T, psm string, handler gems.MessageHandler, opts ...gems.ClientOption) *gems.Client {
+	t.Helper()
+
+	server := faultServers[psm](handler)
+	server.Start()
+	t.Cleanup(server.Close)
+
+	transport, err := gems.NewPipeTransport(psm, server)
+	if err != nil {
+		t.Fatalf("transport error: %s", err)
+	}
+	client, err := gems.NewClient(v, psm, gems.DefaultFormatter{}, append([]gems.ClientOption{gems.WithTransport(transport)}, opts...)...)
+	if err != nil {
+		t.Fatalf("client error: %s", err)
+	}
+	if err := client.Connect("device", gems.ConnectionTypeControlAndStatus, "", target); err != nil {
+		t.Fatalf("connect error: %s", err)
+	}
+	return client
+}
+
+type transcriptRequest struct {
+	Name string
+	Send func(*gems.Client) (gems.Response, error)
+	// Expect is the response description, or "" for an UnknownResponse.
+	Expect string
+}
+
+func ping(c *gems.Client) (gems.Response, error) {
+	return c.Ping()
+}
+
+func getConfig(names ...string) func(*gems.Client) (gems.Response, error) {
+	return func(c *gems.Client) (gems.Response, error) {
+		return c.GetConfig(names...)
+	}
+}
+
+func directive(name string) func(*gems.Client) (gems.Response, error) {
+	return func(c *gems.Client) (gems.Response, error) {
+		return c.Directive(name, nil)
+	}
+}
+
+func loadConfig(name string) func(*gems.Client) (gems.Response, error) {
+	return func(c *gems.Client) (gems.Response, error) {
+		return c.LoadConfig(name)
+	}
+}
+
+// recordedRequests are sent to the device while recording.
+var recordedRequests = []func(*gems.Client) (gems.Response, error){
+	ping,
+	ping,
+	getConfig("Gain", "Level"),
+	getConfig("Level"),
+	directive("Reboot"),
+	directive("Reset"),
+	loadConfig("default"),
+	loadConfig("secret"),
+}
+
+// replayedRequests are answered from the transcript. They are sent in a
+// different order from the recording, so their transaction IDs differ
+// from the recorded ones.
+var replayedRequests = []transcriptRequest{
+	{Name: "parameter names", Send: getConfig("Level"), Expect: "Level"},
+	{Name: "parameter names in any order", Send: getConfig("Level", "Gain"), Expect: "Gain,Level"},
+	{Name: "unrecorded parameter names", Send: getConfig("Gain")},
+	{Name: "directive name", Send: directive("Reset"), Expect: "Reset"},
+	{Name: "other directive name", Send: directive("Reboot"), Expect: "Reboot"},
+	{Name: "unrecorded directive name", Send: directive("Launch")},
+	{Name: "config name", Send: loadConfig("secret"), Expect: "secret"},
+	{Name: "other config name", Send: loadConfig("default"), Expect: "default"},
+	{Name: "unrecorded config name", Send: loadConfig("factory")},
+	{Name: "type", Send: ping, Expect: "ping 1"},
+	{Name: "repeated type", Send: ping, Expect: "ping 2"},
+	{Name: "last response once exhausted", Send: ping, Expect: "ping 2"},
+	{Name: "last response again", Send: ping, Expect: "ping 2"},
+	{Name: "unrecorded type", Send: func(c *gems.Client) (gems.Response, error) { return c.GetConfigList() }},
+}
+
+func TestTranscriptReplay(t *testing.T) {
+	for _, psm := range []string{"ascii", "xml"} {
+		t.Run(psm, func(t *testing.T) {
+			var transcript bytes.Buffer
+			recorder := newTranscriptClient(t, psm, newRecordedHandler(), gems.WithTranscript(gems.NewTranscriptWriter(&transcript)))
+			for _, send := range recordedRequests {
+				if _, err := send(recorder); err != nil {
+					t.Fatalf("request error: %s", err)
+				}
+			}
+
+			entries, err := gems.ReadTranscript(&transcript)
+			if err != nil {
+				t.Fatalf("read error: %s", err)
+			}
+			// The ConnectionRequestMessage is recorded too.
+			if len(entries) != len(recordedRequests)+1 {
+				t.Fatalf("incorrect number of entries: have %d, want %d", len(entries), len(recordedRequests)+1)
+			}
+			for _, entry := range entries {
+				if entry.PSM != psm {
+					t.Errorf("incorrect PSM: have %s, want %s", entry.PSM, psm)
+				}
+			}
+
+			replayer, err := gems.NewReplayer(entries, v)
+			if err != nil {
+				t.Fatalf("replayer error: %s", err)
+			}
+			if replayer.Len() != len(entries) {
+				t.Errorf("incorrect number of exchanges: have %d, want %d", replayer.Len(), len(entries))
+			}
+
+			client := newTranscriptClient(t, psm, replayer.Handle)
+			for _, request := range replayedRequests {
+				resp, err := request.Send(client)
+				if resp == nil {
+					t.Fatalf("%s: no response: %v", request.Name, err)
+				}
+
+				switch request.Expect {
+				case "":
+					if !errorsIsUnsupported(err) || (resp.Type() != gems.UnknownResponseType) {
+						t.Errorf("%s: expected an UnknownResponse, have %s: %v", request.Name, resp.Type(), err)
+					}
+				default:
+					if err != nil {
+						t.Errorf("%s: unexpected error: %s", request.Name, err)
+					}
+					if resp.Result().Description != request.Expect {
+						t.Errorf("%s: incorrect response: have '%s', want '%s'", request.Name, resp.Result().Description, request.Expect)
+					}
+				}
+			}
+		})
+	}
+}
+
+func errorsIsUnsupported(err error) bool {
+	return (err != nil) && strings.Contains(err.Error(), string(gems.ResultCodeUnsupportedMessage))
+}
+
+func TestReplayerTransactionID(t *testing.T) {
+	for _, psm := range []string{"ascii", "xml"} {
+		t.Run(psm, func(t *testing.T) {
+			var transcript bytes.Buffer
+			recorder := newTranscriptClient(t, psm, newRecordedHandler(), gems.WithTranscript(gems.NewTranscriptWriter(&transcript)))
+			if _, err := recorder.Ping(); err != nil {
+				t.Fatalf("ping error: %s", err)
+			}
+
+			entries, err := gems.ReadTranscript(&transcript)
+			if err != nil {
+				t.Fatalf("read error: %s", err)
+			}
+			replayer, err := gems.NewReplayer(entries, v)
+			if err != nil {
+				t.Fatalf("replayer error: %s", err)
+			}
+
+			for _, id := range []int64{1, 42, 1234567} {
+				req, _ := v.NewMessageBuilder().Type(gems.PingMessageType).Target(target).TransactionID(id).Build()
+				resp, err := replayer.Handle(req, v)
+				if err != nil {
+					t.Fatalf("handle error: %s", err)
+				}
+				if have := resp.TransactionID(); !have.Valid || (have.Int64 != id) {
+					t.Errorf("incorrect transaction ID: have %v, want %d", have, id)
+				}
+				if resp.Result().Description != "ping 1" {
+					t.Errorf("incorrect response: %s", resp.Result().Description)
+				}
+			}
+		})
+	}
+}
+
+var transcriptErrorTests = []struct {
+	Name       string
+	Transcript string
+	ReadErr    string
+	ReplayErr  string
+}{
+	{
+		Name:       "malformed line",
+		Transcript: `{"psm":"ascii","request":"x","response":"y"}` + "\n\n" + `{"psm":"ascii","request":` + "\n",
+		ReadErr:    "transcript line 3:",
+	},
+	{
+		Name:       "wrong field type",
+		Transcript: `{"psm":"ascii","latency_ms":"slow"}` + "\n",
+		ReadErr:    "transcript line 1:",
+	},
+	{
+		Name:       "undecodable request",
+		Transcript: `{"psm":"ascii","request":"|GEMS|bogus|END","response":"|GEMS|bogus|END"}` + "\n",
+		ReplayErr:  "transcript entry 1:",
+	},
+	{
+		Name:       "skipped entry without response",
+		Transcript: `{"psm":"ascii","request":"|GEMS|bogus|END"}` + "\n",
+	},
+}
+
+func TestTranscriptErrors(t *testing.T) {
+	for _, test := range transcriptErrorTests {
+		t.Run(test.Name, func(t *testing.T) {
+			entries, err := gems.ReadTranscript(strings.NewReader(test.Transcript))
+			if test.ReadErr != "" {
+				if (err == nil) || !strings.HasPrefix(err.Error(), test.ReadErr) {
+					t.Errorf("incorrect read error: have %v, want %s", err, test.ReadErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("read error: %s", err)
+			}
+
+			_, err = gems.NewReplayer(entries, v)
+			switch {
+			case (test.ReplayErr == "") && (err != nil):
+				t.Errorf("unexpected replay error: %s", err)
+			case (test.ReplayErr != "") && ((err == nil) || !strings.HasPrefix(err.Error(), test.ReplayErr)):
+				t.Errorf("incorrect replay error: have %v, want %s", err, test.ReplayErr)
+			}
+		})
+	}
+}
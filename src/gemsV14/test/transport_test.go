@@ -0,0 +1,126 @@
+package gemsV14_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gems "github.com/mitre/gems/src"
+)
+
+// transportServers create the server for each client PSM listening on
+// addr.
+var transportServers = map[string]func(addr string) gems.Server{
+	"ascii": func(addr string) gems.Server {
+		return gems.NewASCIIServer(addr, namedHandler("device"), gems.BodyFormatter{}, v, "")
+	},
+	"xml": func(addr string) gems.Server {
+		return gems.NewXMLServer(addr, namedHandler("device"), gems.BodyFormatter{}, v, "")
+	},
+	"xml-tcp": func(addr string) gems.Server {
+		return gems.NewXMLTCPServer(addr, namedHandler("device"), gems.BodyFormatter{}, v, "")
+	},
+	"xml-tcp-length": func(addr string) gems.Server {
+		return gems.NewXMLTCPServer(addr, namedHandler("device"), gems.BodyFormatter{}, v, "")
+	},
+}
+
+// exchange connects two clients with transports from newTransport and
+// pings the server with each. It returns the remote addresses of the
+// sessions opened on the server.
+func exchange(t *testing.T, psm string, server gems.Server, newTransport func() (gems.Transport, error)) []string {
+	t.Helper()
+
+	for i := 0; i < 2; i++ {
+		transport, err := newTransport()
+		if err != nil {
+			t.Fatalf("transport error: %s", err)
+		}
+		client, err := gems.NewClient(v, psm, gems.DefaultFormatter{}, gems.WithTransport(transport))
+		if err != nil {
+			t.Fatalf("client error: %s", err)
+		}
+		if err := client.Connect("device", gems.ConnectionTypeControlAndStatus, "", target); err != nil {
+			t.Fatalf("connect error: %s", err)
+		}
+		defer client.Disconnect(gems.DisconnectReasonNormalTermination)
+
+		for j := 0; j < 2; j++ {
+			resp, err := client.Ping()
+			if err != nil {
+				t.Fatalf("ping error: %s", err)
+			}
+			if (resp.Type() != gems.PingResponseType) || (resp.Result().Description != "device") {
+				t.Errorf("incorrect response: %s", client.Format(resp))
+			}
+		}
+	}
+
+	var addrs []string
+	for _, sess := range server.Sessions() {
+		if !sess.Connected || (sess.Target != target) {
+			t.Errorf("incorrect session %+v", sess)
+		}
+		addrs = append(addrs, sess.RemoteAddr)
+	}
+	return addrs
+}
+
+func TestUnixTransport(t *testing.T) {
+	for psm, newServer := range transportServers {
+		t.Run(psm, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "gems.sock")
+			server := newServer("unix:" + path)
+			server.Start()
+			defer server.Close()
+
+			addrs := exchange(t, psm, server, func() (gems.Transport, error) {
+				return gems.NewUnixTransport(psm, path)
+			})
+			// Unix socket clients have no address, so the server names each.
+			if (len(addrs) != 2) || (addrs[0] == addrs[1]) {
+				t.Fatalf("incorrect sessions: %q", addrs)
+			}
+			for _, addr := range addrs {
+				if !strings.HasPrefix(addr, "unix-") {
+					t.Errorf("incorrect remote address '%s'", addr)
+				}
+			}
+		})
+	}
+}
+
+func TestPipeTransport(t *testing.T) {
+	for psm, newServer := range transportServers {
+		t.Run(psm, func(t *testing.T) {
+			server := newServer("")
+			server.Start()
+			defer server.Close()
+
+			addrs := exchange(t, psm, server, func() (gems.Transport, error) {
+				return gems.NewPipeTransport(psm, server)
+			})
+			if (len(addrs) != 2) || (addrs[0] == addrs[1]) {
+				t.Fatalf("incorrect sessions: %q", addrs)
+			}
+			for _, addr := range addrs {
+				if !strings.HasPrefix(addr, "pipe-") {
+					t.Errorf("incorrect remote address '%s'", addr)
+				}
+			}
+		})
+	}
+}
+
+func TestTransportUnknownPSM(t *testing.T) {
+	constructors := map[string]func() (gems.Transport, error){
+		"NewTransport":     func() (gems.Transport, error) { return gems.NewTransport("serial", nil) },
+		"NewUnixTransport": func() (gems.Transport, error) { return gems.NewUnixTransport("xml-http", "gems.sock") },
+		"NewPipeTransport": func() (gems.Transport, error) { return gems.NewPipeTransport("", nil) },
+	}
+	for name, newTransport := range constructors {
+		if _, err := newTransport(); (err == nil) || !strings.HasPrefix(err.Error(), "unknown PSM") {
+			t.Errorf("%s: incorrect error: %v", name, err)
+		}
+	}
+}
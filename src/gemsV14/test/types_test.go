@@ -0,0 +1,40 @@
+package gemsV14_test
+
+import (
+	"testing"
+
+	gems "github.com/mitre/gems/src"
+)
+
+var timeStringTests = []struct {
+	Value  string
+	Expect string
+}{
+	{Value: "1410819035.28", Expect: "1410819035.280000000"},
+	{Value: "1410819035.05", Expect: "1410819035.050000000"},
+	{Value: "1410819035.000001", Expect: "1410819035.000001000"},
+	{Value: "1410819035.000000007", Expect: "1410819035.000000007"},
+	{Value: "1410819035", Expect: "1410819035.000000000"},
+}
+
+func TestTimeString(t *testing.T) {
+	for _, test := range timeStringTests {
+		t.Run(test.Value, func(t *testing.T) {
+			tm, err := gems.TimeFromString(test.Value)
+			if err != nil {
+				t.Fatalf("parse error: %s", err)
+			}
+			if have := tm.String(); have != test.Expect {
+				t.Errorf("incorrect time: have %s, want %s", have, test.Expect)
+			}
+
+			again, err := gems.TimeFromString(tm.String())
+			if err != nil {
+				t.Fatalf("parse error: %s", err)
+			}
+			if !again.Equal(tm.Time) {
+				t.Errorf("incorrect round trip: have %s, want %s", again, tm)
+			}
+		})
+	}
+}
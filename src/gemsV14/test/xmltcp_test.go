@@ -0,0 +1,230 @@
+package gemsV14_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	gems "github.com/mitre/gems/src"
+)
+
+// lengthPrefixed frames each message with its 4 byte big-endian length.
+func lengthPrefixed(messages ...string) string {
+	var data []byte
+	for _, m := range messages {
+		data = binary.BigEndian.AppendUint32(data, uint32(len(m)))
+		data = append(data, m...)
+	}
+	return string(data)
+}
+
+var splitTests = []struct {
+	Name  string
+	Split func() bufio.SplitFunc
+	Data  string
+	// Expect are the tokens split before Err, a substring of the error.
+	Expect []string
+	Err    string
+}{
+	{
+		Name:   "xml root elements",
+		Split:  gems.NewXMLSplitFunc,
+		Data:   `<PingMessage><target>a</target></PingMessage><PingMessage><target>b</target></PingMessage>`,
+		Expect: []string{`<PingMessage><target>a</target></PingMessage>`, `<PingMessage><target>b</target></PingMessage>`},
+	},
+	{
+		Name:   "xml whitespace between messages",
+		Split:  gems.NewXMLSplitFunc,
+		Data:   "\r\n  <a>1</a>\n\t<b>2</b>\n\n",
+		Expect: []string{"<a>1</a>", "<b>2</b>"},
+	},
+	{
+		Name:   "xml declaration and comments before the root",
+		Split:  gems.NewXMLSplitFunc,
+		Data:   `<?xml version="1.0"?><!-- <a> --><a><![CDATA[</a>]]><b/></a><!-- next --><c/>`,
+		Expect: []string{`<?xml version="1.0"?><!-- <a> --><a><![CDATA[</a>]]><b/></a>`, `<!-- next --><c/>`},
+	},
+	{
+		Name:   "xml self-closing root",
+		Split:  gems.NewXMLSplitFunc,
+		Data:   `<PingMessage target="a"/><PingMessage target='b' />`,
+		Expect: []string{`<PingMessage target="a"/>`, `<PingMessage target='b' />`},
+	},
+	{
+		Name:   "xml '>' in an attribute value",
+		Split:  gems.NewXMLSplitFunc,
+		Data:   `<a note="x>y"><b note='/>'>t</b></a>`,
+		Expect: []string{`<a note="x>y"><b note='/>'>t</b></a>`},
+	},
+	{
+		Name:   "xml nested elements of the same name",
+		Split:  gems.NewXMLSplitFunc,
+		Data:   `<a><a><a/></a></a><a/>`,
+		Expect: []string{`<a><a><a/></a></a>`, `<a/>`},
+	},
+	{
+		Name:   "xml partial message at EOF",
+		Split:  gems.NewXMLSplitFunc,
+		Data:   `<a>1</a><b><c/>`,
+		Expect: []string{`<a>1</a>`},
+		Err:    "received partial GEMS-XML message",
+	},
+	{
+		Name:  "xml partial markup at EOF",
+		Split: gems.NewXMLSplitFunc,
+		Data:  `<!-- unterminated`,
+		Err:   "received partial GEMS-XML message",
+	},
+	{
+		Name:  "xml whitespace only",
+		Split: gems.NewXMLSplitFunc,
+		Data:  " \n\t ",
+	},
+	{
+		Name:  "xml empty",
+		Split: gems.NewXMLSplitFunc,
+	},
+	{
+		Name:   "length prefixed",
+		Split:  func() bufio.SplitFunc { return gems.SplitLengthPrefixedMessages },
+		Data:   lengthPrefixed("<a>1</a>", "", " <b/>"),
+		Expect: []string{"<a>1</a>", "", " <b/>"},
+	},
+	{
+		Name:   "length prefixed partial message at EOF",
+		Split:  func() bufio.SplitFunc { return gems.SplitLengthPrefixedMessages },
+		Data:   lengthPrefixed("<a>1</a>") + lengthPrefixed("<b/>")[:6],
+		Expect: []string{"<a>1</a>"},
+		Err:    "received partial length prefixed message",
+	},
+	{
+		Name:   "length prefixed partial prefix at EOF",
+		Split:  func() bufio.SplitFunc { return gems.SplitLengthPrefixedMessages },
+		Data:   lengthPrefixed("<a>1</a>") + "\x00\x00",
+		Expect: []string{"<a>1</a>"},
+		Err:    "received partial length prefixed message",
+	},
+	{
+		Name:  "length prefixed oversized",
+		Split: func() bufio.SplitFunc { return gems.SplitLengthPrefixedMessages },
+		Data:  "\x09\x00\x00\x00<a/>",
+		Err:   "length prefixed message of 150994944 bytes is not under the limit of 150994944 bytes",
+	},
+	{
+		Name:  "length prefixed largest",
+		Split: func() bufio.SplitFunc { return gems.SplitLengthPrefixedMessages },
+		Data:  "\x08\xff\xff\xff<a/>",
+		Err:   "received partial length prefixed message",
+	},
+}
+
+func TestSplitFuncs(t *testing.T) {
+	for _, test := range splitTests {
+		// The split functions see the data whole, and one byte at a time
+		// as a partial message is received.
+		for _, oneByte := range []bool{false, true} {
+			name := test.Name
+			if oneByte {
+				name += "/one byte reads"
+			}
+			t.Run(name, func(t *testing.T) {
+				var r io.Reader = strings.NewReader(test.Data)
+				if oneByte {
+					r = iotest.OneByteReader(r)
+				}
+				scanner := bufio.NewScanner(r)
+				scanner.Buffer(make([]byte, 0, 16), 1024)
+				scanner.Split(test.Split())
+
+				var tokens []string
+				for scanner.Scan() {
+					tokens = append(tokens, scanner.Text())
+				}
+				if !reflect.DeepEqual(tokens, test.Expect) {
+					t.Errorf("incorrect tokens: have %q, want %q", tokens, test.Expect)
+				}
+
+				err := scanner.Err()
+				switch {
+				case (test.Err == "") && (err != nil):
+					t.Errorf("unexpected error: %s", err)
+				case (test.Err != "") && ((err == nil) || !strings.Contains(err.Error(), test.Err)):
+					t.Errorf("incorrect error: have %v, want %s", err, test.Err)
+				}
+			})
+		}
+	}
+}
+
+func TestXMLSplitFuncPartial(t *testing.T) {
+	split := gems.NewXMLSplitFunc()
+	steps := []struct {
+		Data    string
+		AtEOF   bool
+		Advance int
+		Token   string
+	}{
+		// Leading whitespace is dropped while waiting for the message.
+		{Data: "\n  <a", Advance: 3},
+		{Data: "<a><b", Advance: 0},
+		{Data: "<a><b/></", Advance: 0},
+		{Data: "<a><b/></a>  <c/>", Advance: 11, Token: "<a><b/></a>"},
+		{Data: "  <c/>", Advance: 6, Token: "<c/>"},
+		{Data: "", AtEOF: true},
+	}
+	for i, step := range steps {
+		advance, token, err := split([]byte(step.Data), step.AtEOF)
+		if step.AtEOF {
+			if err == nil {
+				t.Errorf("step %d: expected io.EOF", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("step %d: unexpected error: %s", i, err)
+		}
+		if (advance != step.Advance) || (string(token) != step.Token) {
+			t.Errorf("step %d: incorrect split: have %d %q, want %d %q", i, advance, token, step.Advance, step.Token)
+		}
+	}
+}
+
+func TestXMLTCPRoundTrip(t *testing.T) {
+	for _, psm := range []string{"xml-tcp", "xml-tcp-length"} {
+		t.Run(psm, func(t *testing.T) {
+			server := gems.NewXMLTCPServer("", namedHandler("device"), gems.BodyFormatter{}, v, "")
+			server.Start()
+			defer server.Close()
+
+			client, err := gems.NewClient(v, psm, gems.DefaultFormatter{})
+			if err != nil {
+				t.Fatalf("client error: %s", err)
+			}
+			if err := client.Connect(server.Addr(), gems.ConnectionTypeControlAndStatus, "", target); err != nil {
+				t.Fatalf("connect error: %s", err)
+			}
+			defer client.Disconnect(gems.DisconnectReasonNormalTermination)
+
+			for i := 0; i < 3; i++ {
+				resp, err := client.Ping()
+				if err != nil {
+					t.Fatalf("ping error: %s", err)
+				}
+				if (resp.Type() != gems.PingResponseType) || (resp.Result().Description != "device") || (resp.Target() != target) {
+					t.Errorf("incorrect response: %s", client.Format(resp))
+				}
+			}
+			resp, err := client.Directive("Reboot", []string{"Mode:string=FAST"})
+			if err != nil {
+				t.Fatalf("directive error: %s", err)
+			}
+			if resp.Type() != gems.DirectiveResponseType {
+				t.Errorf("incorrect response: %s", client.Format(resp))
+			}
+		})
+	}
+}
@@ -62,6 +62,113 @@ func (vs *ValueSlice) unmarshalASCII(splitData [][]byte, typ gems.Datatype) erro
 	return nil
 }
 
+// int64s converts the values of the parameter named name to int64.
+func (vs ValueSlice) int64s(name string) ([]int64, error) {
+	ints := make([]int64, 0, len(vs))
+	for _, v := range vs {
+		switch x := v.(type) {
+		case *Byte:
+			ints = append(ints, int64(x.Data))
+		case *Ubyte:
+			ints = append(ints, int64(x.Data))
+		case *Short:
+			ints = append(ints, int64(x.Data))
+		case *Ushort:
+			ints = append(ints, int64(x.Data))
+		case *Int:
+			ints = append(ints, int64(x.Data))
+		case *Uint:
+			ints = append(ints, int64(x.Data))
+		case *Long:
+			ints = append(ints, x.Data)
+		case *Ulong:
+			if x.Data > math.MaxInt64 {
+				return nil, &gems.ConversionError{Parameter: name, Datatype: x.Type(), GoType: "int64", Value: x.String()}
+			}
+			ints = append(ints, int64(x.Data))
+		default:
+			return nil, &gems.ConversionError{Parameter: name, Datatype: v.Type(), GoType: "int64"}
+		}
+	}
+	return ints, nil
+}
+
+// float64s converts the values of the parameter named name to float64.
+func (vs ValueSlice) float64s(name string) ([]float64, error) {
+	floats := make([]float64, 0, len(vs))
+	for _, v := range vs {
+		switch x := v.(type) {
+		case *Double:
+			floats = append(floats, x.Data)
+		case *Ulong:
+			floats = append(floats, float64(x.Data))
+		default:
+			i, err := ValueSlice{v}.int64s(name)
+			if err != nil {
+				return nil, &gems.ConversionError{Parameter: name, Datatype: v.Type(), GoType: "float64"}
+			}
+			floats = append(floats, float64(i[0]))
+		}
+	}
+	return floats, nil
+}
+
+// strings returns the text of the values of the parameter named name.
+func (vs ValueSlice) strings(name string) ([]string, error) {
+	strs := make([]string, 0, len(vs))
+	for _, v := range vs {
+		switch v.Type() {
+		case gems.ParameterType, gems.ParameterSetType:
+			return nil, &gems.ConversionError{Parameter: name, Datatype: v.Type(), GoType: "string"}
+		}
+		strs = append(strs, v.String())
+	}
+	return strs, nil
+}
+
+// bools converts the values of the parameter named name to bool.
+func (vs ValueSlice) bools(name string) ([]bool, error) {
+	bools := make([]bool, 0, len(vs))
+	for _, v := range vs {
+		x, ok := v.(*Boolean)
+		if !ok {
+			return nil, &gems.ConversionError{Parameter: name, Datatype: v.Type(), GoType: "bool"}
+		}
+		bools = append(bools, x.Data)
+	}
+	return bools, nil
+}
+
+// bytes returns copies of the hex_value values of the parameter named name.
+func (vs ValueSlice) bytes(name string) ([][]byte, error) {
+	data := make([][]byte, 0, len(vs))
+	for _, v := range vs {
+		x, ok := v.(*HexValue)
+		if !ok {
+			return nil, &gems.ConversionError{Parameter: name, Datatype: v.Type(), GoType: "[]byte"}
+		}
+		data = append(data, append([]byte{}, x.Data...))
+	}
+	return data, nil
+}
+
+// times converts the time and utime values of the parameter named name to
+// time.Time in UTC.
+func (vs ValueSlice) times(name string) ([]time.Time, error) {
+	times := make([]time.Time, 0, len(vs))
+	for _, v := range vs {
+		switch x := v.(type) {
+		case *Time:
+			times = append(times, x.Data.UTC())
+		case *Utime:
+			times = append(times, x.Data.UTC())
+		default:
+			return nil, &gems.ConversionError{Parameter: name, Datatype: v.Type(), GoType: "time.Time"}
+		}
+	}
+	return times, nil
+}
+
 func newValue(typ gems.Datatype) (gems.XMLValue, error) {
 	switch typ {
 	case gems.StringType:
@@ -453,8 +560,8 @@ type Ulong struct {
 	Empty bool
 }
 
-func newUlong(value int) *Ulong {
-	v := Ulong{Data: uint64(value)}
+func newUlong(value uint64) *Ulong {
+	v := Ulong{Data: value}
 	return &v
 }
 
@@ -598,7 +705,7 @@ type Uint struct {
 	Empty bool
 }
 
-func newUint(value int) *Uint {
+func newUint(value uint64) *Uint {
 	if value > math.MaxUint32 {
 		value = math.MaxUint32
 	}
@@ -914,18 +1021,6 @@ func newHexValueFromStream(value string, bitLength int) *HexValue {
 	return &v
 }
 
-func newHexValueFromASCII(value string) *HexValue {
-	if len(value) == 0 {
-		return newEmptyHexValue()
-	}
-
-	var v HexValue
-	if err := ascii.Unmarshal([]byte(value), &v); err != nil {
-		return newEmptyHexValue()
-	}
-	return &v
-}
-
 func newEmptyHexValue() *HexValue {
 	v := HexValue{Empty: true}
 	return &v
@@ -1038,15 +1133,6 @@ func newTimeValue(value time.Time) *Time {
 	return &v
 }
 
-func newTimeValueFromString(value string) *Time {
-	t, err := gems.TimeFromString(value)
-	if err != nil {
-		return newEmptyTimeValue()
-	}
-	v := Time{Data: t}
-	return &v
-}
-
 func newEmptyTimeValue() *Time {
 	v := Time{Empty: true}
 	return &v
@@ -1115,15 +1201,6 @@ func newUtime(value time.Time) *Utime {
 	return &v
 }
 
-func newUtimeFromString(value string) *Utime {
-	t, err := gems.TimeFromUtime(value)
-	if err != nil {
-		return newEmptyUtime()
-	}
-	v := Utime{Data: t}
-	return &v
-}
-
 func newEmptyUtime() *Utime {
 	v := Utime{Empty: true}
 	return &v
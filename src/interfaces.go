@@ -1,8 +1,10 @@
 package gems
 
 import (
+	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"time"
 
 	"github.com/mitre/gems/src/ascii"
 )
@@ -10,7 +12,10 @@ import (
 type Version interface {
 	ReceiveASCIIMessage([]byte, MessageType) (Message, error)
 	ReceiveXMLMessage([]byte, MessageType) (Message, error)
+	DecodeXMLMessage(*xml.Decoder, xml.StartElement, func(Parameter) error) (Message, error)
+	ReceiveJSONMessage([]byte, MessageType) (Message, error)
 	NewMessageBuilder() MessageBuilder
+	NewParameterBuilder() ParameterBuilder
 }
 
 type Message interface {
@@ -23,6 +28,16 @@ type Message interface {
 	Body() map[string]any
 	ascii.Marshaler
 	ascii.Unmarshaler
+	json.Marshaler
+	json.Unmarshaler
+}
+
+// ParameterMessage is a Message that carries parameters: the parameters of
+// a GetConfigResponse, SetConfigMessage or AsyncStatusMessage, or the
+// arguments or return values of a directive.
+type ParameterMessage interface {
+	Message
+	ParameterList() []Parameter
 }
 
 type XMLMessage interface {
@@ -62,19 +77,34 @@ type Value interface {
 	fmt.Stringer
 	ascii.Marshaler
 	ascii.Unmarshaler
+	json.Marshaler
 }
 
 type XMLValue interface {
 	xml.Marshaler
 	xml.Unmarshaler
+	json.Unmarshaler
 	Value
 }
 
+// Parameter is a named GEMS parameter holding one or more values.
+//
+// The typed accessors return the values of the parameter converted to a Go
+// type. They return a *ConversionError if a value does not have a
+// compatible datatype or does not fit the Go type. Times returns times in
+// UTC, and Children returns the parameters held by a ParameterSet.
 type Parameter interface {
 	Value
 	ValueType() Datatype
 	Name() string
 	Validate() error
+	Int64s() ([]int64, error)
+	Float64s() ([]float64, error)
+	Strings() ([]string, error)
+	Bools() ([]bool, error)
+	Bytes() ([][]byte, error)
+	Times() ([]time.Time, error)
+	Children() ([]Parameter, error)
 }
 
 type XMLParameter interface {
@@ -82,14 +112,33 @@ type XMLParameter interface {
 	Parameter
 }
 
+// ParameterBuilder builds a Parameter, or a ParameterSet if given
+// Parameters. Each value setter replaces the values of the parameter, so
+// that a parameter has values of a single datatype. More than one value
+// makes an array, and no values adds a single empty value.
+//
+// The integer setters take values in the range of their datatype, e.g.
+// [0, 255] for Ubyte. The HexValue, Time and Utime setters take values in
+// GEMS-ASCII format, such as "FAF320/24", "1410804178.49" and
+// "2009-273T09:14:50.02Z". Build returns an error describing the first
+// value that is out of range or cannot be parsed.
 type ParameterBuilder interface {
 	Name(string) ParameterBuilder
 	Multiplicity(int) ParameterBuilder
+	Parameters(...Parameter) ParameterBuilder
 	String(...string) ParameterBuilder
 	Boolean(...bool) ParameterBuilder
+	Byte(...int) ParameterBuilder
+	Ubyte(...int) ParameterBuilder
+	Short(...int) ParameterBuilder
+	Ushort(...int) ParameterBuilder
 	Int(...int) ParameterBuilder
+	Uint(...uint64) ParameterBuilder
+	Long(...int) ParameterBuilder
+	Ulong(...uint64) ParameterBuilder
 	Double(...float64) ParameterBuilder
 	HexValue(...string) ParameterBuilder
 	Time(...string) ParameterBuilder
+	Utime(...string) ParameterBuilder
 	Build() (Parameter, error)
 }
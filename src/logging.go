@@ -0,0 +1,68 @@
+package gems
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Attribute keys used in the log records of clients and servers.
+const (
+	LogKeyRemoteAddr    = "remote_addr"
+	LogKeySessionID     = "session_id"
+	LogKeyMessageType   = "message_type"
+	LogKeyTransactionID = "transaction_id"
+	LogKeyTarget        = "target"
+	LogKeyResponseType  = "response_type"
+	LogKeyResultCode    = "result_code"
+	LogKeyLatency       = "latency"
+)
+
+// NewLogger returns a logger writing to w. format selects the handler,
+// "text" (or "") for slog.TextHandler and "json" for slog.JSONHandler.
+// level is the minimum level logged: "debug", "info", "warn" or "error".
+func NewLogger(w io.Writer, format string, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if level != "" {
+		if err := lvl.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("invalid log level '%s'", level)
+		}
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format '%s', must be 'text' or 'json'", format)
+	}
+}
+
+// messageAttrs returns the log attributes identifying m.
+func messageAttrs(m Message) []any {
+	attrs := []any{slog.String(LogKeyMessageType, m.Type().String())}
+	if id := m.TransactionID(); id.Valid {
+		attrs = append(attrs, slog.Int64(LogKeyTransactionID, id.Int64))
+	}
+	if m.Target() != "" {
+		attrs = append(attrs, slog.String(LogKeyTarget, m.Target()))
+	}
+	return attrs
+}
+
+// exchangeAttrs returns the log attributes for a request and its
+// response. resp may be nil.
+func exchangeAttrs(req Message, resp Response, latency time.Duration) []any {
+	attrs := messageAttrs(req)
+	if resp != nil {
+		attrs = append(attrs,
+			slog.String(LogKeyResponseType, resp.Type().String()),
+			slog.String(LogKeyResultCode, string(resp.Result().Code)),
+		)
+	}
+	return append(attrs, slog.Duration(LogKeyLatency, latency))
+}
@@ -2,7 +2,10 @@ package gems
 
 import (
 	"bytes"
+	"encoding/json"
 	"encoding/xml"
+	"fmt"
+	"io"
 	"strconv"
 
 	"github.com/mitre/gems/src/ascii"
@@ -76,12 +79,76 @@ func (m GenericMessage) Type() MessageType {
 }
 
 func ReceiveXMLMessage(data []byte, v Version) (Message, error) {
-	var m GenericMessage
-	err := xml.Unmarshal(data, &m)
-	if err != nil {
+	return DecodeXMLMessage(bytes.NewReader(data), v, nil)
+}
+
+// DecodeXMLMessage decodes a GEMS-XML message as it is read from r, in a
+// single pass. If fn is not nil, the parameters of a GetConfigResponse or
+// AsyncStatusMessage are passed to fn one at a time as they are decoded
+// and are not kept in the message, so that the memory used does not grow
+// with the number of parameters. Decoding stops at the first error
+// returned by fn.
+func DecodeXMLMessage(r io.Reader, v Version, fn func(Parameter) error) (Message, error) {
+	d := xml.NewDecoder(r)
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := t.(xml.StartElement); ok {
+			return v.DecodeXMLMessage(d, start, fn)
+		}
+	}
+}
+
+// messageReader reads a message of at most max bytes. Reading past the
+// limit fails with ErrMessageTooLarge, and the first bytes read are kept
+// to report a malformed message.
+type messageReader struct {
+	r      io.Reader
+	max    int
+	n      int
+	prefix []byte
+}
+
+// messagePrefixLen is the number of bytes kept by a messageReader.
+const messagePrefixLen = 1024
+
+func newMessageReader(r io.Reader, max int) *messageReader {
+	if max <= 0 {
+		max = ascii.DefaultMaxMessageSize
+	}
+	return &messageReader{r: r, max: max}
+}
+
+func (m *messageReader) Read(p []byte) (int, error) {
+	if m.n >= m.max {
+		// Fail only if the message continues past the limit.
+		var b [1]byte
+		if _, err := io.ReadFull(m.r, b[:]); err != nil {
+			return 0, io.EOF
+		}
+		return 0, fmt.Errorf("%w: longer than %d bytes", ErrMessageTooLarge, m.max)
+	}
+
+	n, err := m.r.Read(p[:min(len(p), m.max-m.n)])
+	if len(m.prefix) < messagePrefixLen {
+		m.prefix = append(m.prefix, p[:min(n, messagePrefixLen-len(m.prefix))]...)
+	}
+	m.n += n
+	return n, err
+}
+
+// ReceiveJSONMessage decodes a message from its JSON representation, which
+// names the type of the message in its "type" field.
+func ReceiveJSONMessage(data []byte, v Version) (Message, error) {
+	var m struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
 		return nil, err
 	}
-	return v.ReceiveXMLMessage(data, m.Type())
+	return v.ReceiveJSONMessage(data, MessageTypeFromXMLName(xml.Name{Local: m.Type}))
 }
 
 func ReceiveASCIIMessage(data []byte, v Version) (Message, error) {
@@ -91,3 +158,92 @@ func ReceiveASCIIMessage(data []byte, v Version) (Message, error) {
 	}
 	return v.ReceiveASCIIMessage(data, m.Type())
 }
+
+// Header holds the message header fields that identify a message within
+// a connection.
+type Header struct {
+	TransactionID NullInt64
+	Token         string
+	Target        string
+}
+
+// RewriteHeader returns a copy of m with the header fields changed by
+// rewrite. The copy is built by a MessageBuilder of version v, so it can
+// be sent over any PSM.
+func RewriteHeader(m Message, v Version, rewrite func(*Header)) (Message, error) {
+	return RewriteMessage(m, v, func(c *MessageContent) {
+		rewrite(&c.Header)
+	})
+}
+
+// MessageContent holds the header and the content of a message in the
+// form taken by a MessageBuilder. Fields that a message type does not
+// carry are empty.
+type MessageContent struct {
+	Header
+	Timestamp         string
+	Result            Result
+	ConnectionType    ConnectionType
+	DisconnectReason  DisconnectReason
+	ConfigName        string
+	Configurations    []string
+	DesiredParameters []string
+	DirectiveName     string
+	ParameterCount    int
+	// Parameters holds the parameters of a ParameterMessage.
+	Parameters []Parameter
+}
+
+// RewriteMessage returns a copy of m with the content changed by rewrite.
+// The content is read from the JSON representation of m and the
+// parameters of a ParameterMessage, and the copy is built by a
+// MessageBuilder of version v, so it can be sent over any PSM.
+func RewriteMessage(m Message, v Version, rewrite func(*MessageContent)) (Message, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	var mj struct {
+		Timestamp         string           `json:"timestamp"`
+		ResultCode        ResultCode       `json:"result_code"`
+		ResultDescription string           `json:"result_description"`
+		ConnectionType    ConnectionType   `json:"connection_type"`
+		DisconnectReason  DisconnectReason `json:"disconnect_reason"`
+		ConfigName        string           `json:"config_name"`
+		Configurations    []string         `json:"configurations"`
+		DesiredParameters []string         `json:"desired_parameters"`
+		DirectiveName     string           `json:"directive_name"`
+		ParametersSet     int              `json:"parameters_set"`
+		ParametersLoaded  int              `json:"parameters_loaded"`
+		ParametersSaved   int              `json:"parameters_saved"`
+	}
+	if err := json.Unmarshal(data, &mj); err != nil {
+		return nil, err
+	}
+
+	c := MessageContent{
+		Header:            Header{TransactionID: m.TransactionID(), Token: m.Token(), Target: m.Target()},
+		Timestamp:         mj.Timestamp,
+		Result:            Result{Code: mj.ResultCode, Description: mj.ResultDescription},
+		ConnectionType:    mj.ConnectionType,
+		DisconnectReason:  mj.DisconnectReason,
+		ConfigName:        mj.ConfigName,
+		Configurations:    mj.Configurations,
+		DesiredParameters: mj.DesiredParameters,
+		DirectiveName:     mj.DirectiveName,
+		ParameterCount:    max(mj.ParametersSet, mj.ParametersLoaded, mj.ParametersSaved),
+	}
+	if pm, ok := m.(ParameterMessage); ok {
+		c.Parameters = pm.ParameterList()
+	}
+	rewrite(&c)
+
+	mb := v.NewMessageBuilder().Type(m.Type()).Token(c.Token).Target(c.Target).Timestamp(c.Timestamp).
+		Result(c.Result).ConnectionType(c.ConnectionType).DisconnectReason(c.DisconnectReason).
+		ConfigurationName(c.ConfigName).ConfigurationList(c.Configurations).DesiredParameters(c.DesiredParameters...).
+		Directive(c.DirectiveName).ParameterCount(c.ParameterCount).Parameters(c.Parameters...)
+	if c.TransactionID.Valid {
+		mb = mb.TransactionID(c.TransactionID.Int64)
+	}
+	return mb.Build()
+}
@@ -0,0 +1,222 @@
+package gems
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the handler latency
+// histogram buckets.
+var latencyBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// Metrics counts the traffic handled by one or more GEMS servers. Pass it
+// to the server constructors with WithMetrics. Metrics is an http.Handler
+// that serves the counters in the Prometheus text exposition format.
+type Metrics struct {
+	mu           sync.Mutex
+	sessions     map[string]float64
+	accepted     map[string]float64
+	rejected     map[[2]string]float64
+	authFailures map[string]float64
+	parseErrors  map[string]float64
+	messages     map[[3]string]float64
+	latency      map[[2]string]*histogram
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(v float64) {
+	for i, bound := range latencyBuckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// NewMetrics returns an empty set of server metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		sessions:     make(map[string]float64),
+		accepted:     make(map[string]float64),
+		rejected:     make(map[[2]string]float64),
+		authFailures: make(map[string]float64),
+		parseErrors:  make(map[string]float64),
+		messages:     make(map[[3]string]float64),
+		latency:      make(map[[2]string]*histogram),
+	}
+}
+
+// WithMetrics records the traffic handled by the server in m. Several
+// servers may share the same Metrics; each is labeled by its PSM.
+func WithMetrics(m *Metrics) ServerOption {
+	return func(o *serverOptions) {
+		o.metrics = m
+	}
+}
+
+func (m *Metrics) sessionOpened(psm string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[psm]++
+}
+
+func (m *Metrics) sessionClosed(psm string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[psm]--
+}
+
+func (m *Metrics) parseError(psm string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.parseErrors[psm]++
+}
+
+// connection records the outcome of a ConnectionRequestMessage.
+func (m *Metrics) connection(psm string, resp Response) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	code := ResultCodeSuccess
+	if resp != nil {
+		code = resp.Result().Code
+	}
+	switch code {
+	case ResultCodeSuccess:
+		m.accepted[psm]++
+	case ResultCodeAccessDenied:
+		m.authFailures[psm]++
+		fallthrough
+	default:
+		m.rejected[[2]string{psm, string(code)}]++
+	}
+}
+
+// message records a request, the result code of its response and the
+// time taken to produce the response.
+func (m *Metrics) message(psm string, req Message, resp Response, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var code string
+	if resp != nil {
+		code = string(resp.Result().Code)
+	}
+	typ := req.Type().String()
+	m.messages[[3]string{psm, typ, code}]++
+
+	h, found := m.latency[[2]string{psm, typ}]
+	if !found {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		m.latency[[2]string{psm, typ}] = h
+	}
+	h.observe(latency.Seconds())
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.Write(w)
+}
+
+// Write writes the metrics to w in the Prometheus text exposition format.
+func (m *Metrics) Write(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b := bufio.NewWriter(w)
+
+	writeHeader(b, "gems_sessions_active", "gauge", "Number of open client connections.")
+	for _, psm := range sortedKeys(m.sessions) {
+		writeSample(b, "gems_sessions_active", m.sessions[psm], "psm", psm)
+	}
+
+	writeHeader(b, "gems_connections_accepted_total", "counter", "ConnectionRequestMessages accepted.")
+	for _, psm := range sortedKeys(m.accepted) {
+		writeSample(b, "gems_connections_accepted_total", m.accepted[psm], "psm", psm)
+	}
+
+	writeHeader(b, "gems_connections_rejected_total", "counter", "ConnectionRequestMessages rejected, by result code.")
+	for _, key := range sortedKeys(m.rejected) {
+		writeSample(b, "gems_connections_rejected_total", m.rejected[key], "psm", key[0], "result", key[1])
+	}
+
+	writeHeader(b, "gems_auth_failures_total", "counter", "ConnectionRequestMessages with an invalid token.")
+	for _, psm := range sortedKeys(m.authFailures) {
+		writeSample(b, "gems_auth_failures_total", m.authFailures[psm], "psm", psm)
+	}
+
+	writeHeader(b, "gems_parse_errors_total", "counter", "Received messages that could not be decoded.")
+	for _, psm := range sortedKeys(m.parseErrors) {
+		writeSample(b, "gems_parse_errors_total", m.parseErrors[psm], "psm", psm)
+	}
+
+	writeHeader(b, "gems_messages_total", "counter", "Messages handled, by message type and response result code.")
+	for _, key := range sortedKeys(m.messages) {
+		writeSample(b, "gems_messages_total", m.messages[key], "psm", key[0], "type", key[1], "result", key[2])
+	}
+
+	writeHeader(b, "gems_handler_duration_seconds", "histogram", "Time taken to handle a message, by message type.")
+	for _, key := range sortedKeys(m.latency) {
+		h := m.latency[key]
+		for i, bound := range latencyBuckets {
+			le := strconv.FormatFloat(bound, 'g', -1, 64)
+			writeSample(b, "gems_handler_duration_seconds_bucket", float64(h.counts[i]), "psm", key[0], "type", key[1], "le", le)
+		}
+		writeSample(b, "gems_handler_duration_seconds_bucket", float64(h.count), "psm", key[0], "type", key[1], "le", "+Inf")
+		writeSample(b, "gems_handler_duration_seconds_sum", h.sum, "psm", key[0], "type", key[1])
+		writeSample(b, "gems_handler_duration_seconds_count", float64(h.count), "psm", key[0], "type", key[1])
+	}
+
+	return b.Flush()
+}
+
+func writeHeader(b *bufio.Writer, name string, typ string, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// writeSample writes a sample line. labels holds alternating label names
+// and values.
+func writeSample(b *bufio.Writer, name string, value float64, labels ...string) {
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(b, "%s=\"%s\"", labels[i], escapeLabel(labels[i+1]))
+		}
+		b.WriteByte('}')
+	}
+	fmt.Fprintf(b, " %s\n", strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func sortedKeys[K comparable, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+	return keys
+}
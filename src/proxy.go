@@ -0,0 +1,251 @@
+package gems
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// WithProxy connects the client to the device through the proxy at
+// proxyURL. GEMS-XML requests are sent through an HTTP, HTTPS or SOCKS5
+// proxy. The stream PSMs, such as GEMS-ASCII, tunnel their connection
+// through a SOCKS5 proxy or an HTTP proxy supporting CONNECT. Credentials
+// in the URL are used to authenticate with the proxy.
+func WithProxy(proxyURL *url.URL) ClientOption {
+	return func(c *Client) {
+		c.proxy = proxyURL
+	}
+}
+
+// ProxyDial returns a DialFunc that opens connections through the proxy
+// at proxyURL, connecting to the proxy with forward, or a net.Dialer if
+// forward is nil. The proxy scheme may be "socks5", "socks5h", "http" or
+// "https". Host names are resolved by the proxy.
+func ProxyDial(proxyURL *url.URL, forward DialFunc) DialFunc {
+	if forward == nil {
+		var d net.Dialer
+		forward = d.DialContext
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		var dial func(net.Conn, *url.URL, string) (net.Conn, error)
+		port := ""
+		switch proxyURL.Scheme {
+		case "socks5", "socks5h":
+			dial, port = socks5Connect, "1080"
+		case "http":
+			dial, port = httpConnect, "80"
+		case "https":
+			dial, port = httpConnect, "443"
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme '%s'", proxyURL.Scheme)
+		}
+		if proxyURL.Port() != "" {
+			port = proxyURL.Port()
+		}
+
+		conn, err := forward(ctx, "tcp", net.JoinHostPort(proxyURL.Hostname(), port))
+		if err != nil {
+			return nil, err
+		}
+		if proxyURL.Scheme == "https" {
+			tlsConn := tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname()})
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			conn = tlsConn
+		}
+
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+			defer conn.SetDeadline(time.Time{})
+		}
+		tunnel, err := dial(conn, proxyURL, addr)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("proxy %s: %w", proxyURL.Redacted(), err)
+		}
+		return tunnel, nil
+	}
+}
+
+// SOCKS5 protocol values from RFC 1928 and RFC 1929.
+const (
+	socks5Version       = 0x05
+	socks5NoAuth        = 0x00
+	socks5UserPass      = 0x02
+	socks5NoAcceptable  = 0xff
+	socks5CmdConnect    = 0x01
+	socks5IPv4          = 0x01
+	socks5DomainName    = 0x03
+	socks5IPv6          = 0x04
+	socks5UserPassAuthV = 0x01
+)
+
+var socks5Replies = map[byte]string{
+	0x01: "general SOCKS server failure",
+	0x02: "connection not allowed by ruleset",
+	0x03: "network unreachable",
+	0x04: "host unreachable",
+	0x05: "connection refused",
+	0x06: "TTL expired",
+	0x07: "command not supported",
+	0x08: "address type not supported",
+}
+
+// socks5Connect asks the SOCKS5 server on conn to connect to addr.
+func socks5Connect(conn net.Conn, proxyURL *url.URL, addr string) (net.Conn, error) {
+	if err := socks5Handshake(conn, proxyURL, addr); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+func socks5Handshake(conn net.Conn, proxyURL *url.URL, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port '%s'", portStr)
+	}
+
+	methods := []byte{socks5NoAuth}
+	if proxyURL.User != nil {
+		methods = append(methods, socks5UserPass)
+	}
+	if _, err := conn.Write(append([]byte{socks5Version, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != socks5Version {
+		return fmt.Errorf("not a SOCKS5 server")
+	}
+
+	switch reply[1] {
+	case socks5NoAuth:
+	case socks5UserPass:
+		if proxyURL.User == nil {
+			return fmt.Errorf("SOCKS5 server requires authentication")
+		}
+		user := proxyURL.User.Username()
+		password, _ := proxyURL.User.Password()
+		if (len(user) > 255) || (len(password) > 255) {
+			return fmt.Errorf("SOCKS5 credentials too long")
+		}
+
+		auth := []byte{socks5UserPassAuthV, byte(len(user))}
+		auth = append(auth, user...)
+		auth = append(auth, byte(len(password)))
+		auth = append(auth, password...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0x00 {
+			return fmt.Errorf("SOCKS5 authentication failed")
+		}
+	case socks5NoAcceptable:
+		return fmt.Errorf("no acceptable SOCKS5 authentication method")
+	default:
+		return fmt.Errorf("unsupported SOCKS5 authentication method %d", reply[1])
+	}
+
+	req := []byte{socks5Version, socks5CmdConnect, 0x00}
+	ip := net.ParseIP(host)
+	switch {
+	case ip.To4() != nil:
+		req = append(append(req, socks5IPv4), ip.To4()...)
+	case ip != nil:
+		req = append(append(req, socks5IPv6), ip.To16()...)
+	case len(host) > 255:
+		return fmt.Errorf("host name too long")
+	default:
+		req = append(append(req, socks5DomainName, byte(len(host))), host...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	// VER REP RSV ATYP, followed by the bound address and port.
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if header[1] != 0x00 {
+		if reason, ok := socks5Replies[header[1]]; ok {
+			return fmt.Errorf("SOCKS5 connect failed: %s", reason)
+		}
+		return fmt.Errorf("SOCKS5 connect failed with reply %d", header[1])
+	}
+
+	var bound int
+	switch header[3] {
+	case socks5IPv4:
+		bound = net.IPv4len
+	case socks5IPv6:
+		bound = net.IPv6len
+	case socks5DomainName:
+		n := make([]byte, 1)
+		if _, err := io.ReadFull(conn, n); err != nil {
+			return err
+		}
+		bound = int(n[0])
+	default:
+		return fmt.Errorf("unknown SOCKS5 address type %d", header[3])
+	}
+	_, err = io.ReadFull(conn, make([]byte, bound+2))
+	return err
+}
+
+// httpConnect asks the HTTP proxy on conn to open a tunnel to addr.
+func httpConnect(conn net.Conn, proxyURL *url.URL, addr string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		req.SetBasicAuth(proxyURL.User.Username(), password)
+		req.Header.Set("Proxy-Authorization", req.Header.Get("Authorization"))
+		req.Header.Del("Authorization")
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CONNECT failed: %s", resp.Status)
+	}
+
+	// The device may have sent data that was read with the response.
+	if r.Buffered() > 0 {
+		return &peekedConn{Conn: conn, r: r}, nil
+	}
+	return conn, nil
+}
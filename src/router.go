@@ -0,0 +1,84 @@
+package gems
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Router dispatches messages to the MessageHandler registered for the
+// target named in the message header. It allows a single server to host
+// several logical GEMS devices, as a GEMS gateway does for the equipment
+// behind it.
+//
+// Router.Handle is a MessageHandler. Pass Router.HasTarget to the server
+// with WithTargetFilter to reject connections to unknown targets.
+type Router struct {
+	handlers map[string]MessageHandler
+	mu       sync.RWMutex
+}
+
+// NewRouter returns a Router with no registered targets.
+func NewRouter() *Router {
+	return &Router{handlers: make(map[string]MessageHandler)}
+}
+
+// Register sets the handler for messages addressed to target. Registering
+// the empty target handles messages that do not name a target.
+func (r *Router) Register(target string, handler MessageHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.handlers[target] = handler
+}
+
+// Targets returns the registered target names in sorted order.
+func (r *Router) Targets() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	targets := make([]string, 0, len(r.handlers))
+	for target := range r.handlers {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// HasTarget reports whether a handler is registered for target.
+func (r *Router) HasTarget(target string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, found := r.handlers[target]
+	return found
+}
+
+// Handle passes the message to the handler registered for its target.
+// Messages for unknown targets receive a response with the
+// INVALID_TARGET result code.
+func (r *Router) Handle(m Message, v Version) (Response, error) {
+	r.mu.RLock()
+	handler, found := r.handlers[m.Target()]
+	r.mu.RUnlock()
+
+	if found {
+		return handler(m, v)
+	}
+	return invalidTargetResponse(m, v)
+}
+
+func invalidTargetResponse(m Message, v Version) (Response, error) {
+	mb := v.NewMessageBuilder().Type(m.Type().ResponseType()).Target(m.Target())
+	if m.TransactionID().Valid {
+		mb.TransactionID(m.TransactionID().Int64)
+	}
+
+	description := fmt.Sprintf("Target %s does not exist in this system", m.Target())
+	msg, err := mb.ResultCode(ResultCodeInvalidTarget).ResponseDescription(description).Build()
+	if err != nil {
+		return nil, err
+	}
+	resp, _ := msg.(Response)
+	return resp, nil
+}
@@ -0,0 +1,132 @@
+package gems
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serialAddr parses an address of the form "serial:PATH[:BAUD]", naming a
+// serial line such as "serial:/dev/ttyUSB0:9600". A baud rate of 0 leaves
+// the speed of the line unchanged.
+func serialAddr(addr string) (path string, baud int, ok bool) {
+	path, ok = strings.CutPrefix(addr, "serial:")
+	if !ok {
+		return "", 0, false
+	}
+	if i := strings.LastIndex(path, ":"); i >= 0 {
+		if n, err := strconv.Atoi(path[i+1:]); err == nil {
+			return path[:i], n, true
+		}
+	}
+	return path, 0, true
+}
+
+// OpenSerial opens the serial line at path, such as an RS-232 port or a
+// pseudo-terminal, as a connection for a stream PSM. The line is put in raw
+// mode with 8 data bits, no parity and one stop bit. If baud is not 0, it
+// also sets the speed of the line.
+//
+// Stream clients and servers open a serial line themselves when given an
+// address of the form "serial:PATH[:BAUD]".
+func OpenSerial(path string, baud int) (net.Conn, error) {
+	f, err := openSerial(path, baud)
+	if err != nil {
+		return nil, err
+	}
+	return &serialConn{File: f, addr: localAddr{network: "serial", name: path}}, nil
+}
+
+// serialConn is a serial line opened as a connection. Deadlines are
+// supported by the *os.File of a terminal device.
+type serialConn struct {
+	*os.File
+	addr   net.Addr
+	closed func()
+	once   sync.Once
+}
+
+func (c *serialConn) LocalAddr() net.Addr {
+	return c.addr
+}
+
+func (c *serialConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+func (c *serialConn) Close() error {
+	err := c.File.Close()
+	if c.closed != nil {
+		c.once.Do(c.closed)
+	}
+	return err
+}
+
+// serialListener hands out a serial line as one connection at a time. The
+// line is reopened for the next session once the server closes the
+// connection of the previous one.
+type serialListener struct {
+	path string
+	baud int
+	addr localAddr
+
+	free chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// listenSerial opens the serial line at path, failing early if it cannot
+// be opened.
+func listenSerial(path string, baud int) (net.Listener, error) {
+	f, err := openSerial(path, baud)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	l := &serialListener{
+		path: path,
+		baud: baud,
+		addr: localAddr{network: "serial", name: path},
+		free: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	l.free <- struct{}{}
+	return l, nil
+}
+
+func (l *serialListener) Accept() (net.Conn, error) {
+	select {
+	case <-l.free:
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+
+	conn, err := OpenSerial(l.path, l.baud)
+	if err != nil {
+		// Wait before the next attempt, as the line may have been unplugged.
+		select {
+		case <-time.After(time.Second):
+		case <-l.done:
+		}
+		l.free <- struct{}{}
+		return nil, fmt.Errorf("failed to open serial line: %w", err)
+	}
+
+	sc := conn.(*serialConn)
+	sc.closed = func() { l.free <- struct{}{} }
+	return sc, nil
+}
+
+func (l *serialListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *serialListener) Addr() net.Addr {
+	return l.addr
+}
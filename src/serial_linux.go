@@ -0,0 +1,78 @@
+//go:build linux
+
+package gems
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// cbaud masks the speed bits of the termios c_cflag on Linux.
+const cbaud = 0x100f
+
+var baudRates = map[int]uint32{
+	1200: syscall.B1200, 2400: syscall.B2400, 4800: syscall.B4800, 9600: syscall.B9600,
+	19200: syscall.B19200, 38400: syscall.B38400, 57600: syscall.B57600,
+	115200: syscall.B115200, 230400: syscall.B230400, 460800: syscall.B460800,
+	921600: syscall.B921600,
+}
+
+// openSerial opens the terminal device at path in raw mode.
+func openSerial(path string, baud int) (*os.File, error) {
+	speed, ok := baudRates[baud]
+	if !ok && (baud != 0) {
+		return nil, fmt.Errorf("unsupported baud rate %d", baud)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// The file descriptor is used through SyscallConn, as File.Fd would put
+	// it in blocking mode and disable deadlines.
+	rc, err := f.SyscallConn()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	var ioctlErr error
+	err = rc.Control(func(fd uintptr) {
+		var t syscall.Termios
+		if ioctlErr = ioctl(fd, syscall.TCGETS, &t); ioctlErr != nil {
+			return
+		}
+
+		t.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+			syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON | syscall.IXOFF
+		t.Oflag &^= syscall.OPOST
+		t.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+		t.Cflag &^= syscall.CSIZE | syscall.PARENB | syscall.CSTOPB | syscall.HUPCL
+		t.Cflag |= syscall.CS8 | syscall.CREAD | syscall.CLOCAL
+		t.Cc[syscall.VMIN] = 1
+		t.Cc[syscall.VTIME] = 0
+		if baud != 0 {
+			t.Cflag = (t.Cflag &^ cbaud) | speed
+			t.Ispeed = speed
+			t.Ospeed = speed
+		}
+		ioctlErr = ioctl(fd, syscall.TCSETS, &t)
+	})
+	if err == nil {
+		err = ioctlErr
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to configure %s: %w", path, err)
+	}
+	return f, nil
+}
+
+func ioctl(fd uintptr, req uintptr, t *syscall.Termios) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(unsafe.Pointer(t))); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+
+package gems
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// openSerial reports that serial lines are not supported on this platform.
+func openSerial(path string, baud int) (*os.File, error) {
+	return nil, fmt.Errorf("serial lines are not supported on %s", runtime.GOOS)
+}
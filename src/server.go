@@ -1,13 +1,15 @@
 package gems
 
 import (
-	"bufio"
+	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -22,6 +24,57 @@ var (
 type MessageHandler func(Message, Version) (Response, error)
 type DirectiveFunction func([]Parameter) ([]Parameter, Result)
 
+// ServerOption configures optional behavior of a GEMS server.
+type ServerOption func(*serverOptions)
+
+type serverOptions struct {
+	validTarget func(string) bool
+	events      EventHandler
+	logger      *slog.Logger
+	metrics     *Metrics
+	faults      *FaultInjector
+
+	maxMessageSize int
+}
+
+func newServerOptions(opts []ServerOption) serverOptions {
+	o := serverOptions{logger: slog.Default(), maxMessageSize: ascii.DefaultMaxMessageSize}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithLogger sets the logger used by the server. By default the server
+// logs to slog.Default().
+func WithLogger(l *slog.Logger) ServerOption {
+	return func(o *serverOptions) {
+		if l != nil {
+			o.logger = l
+		}
+	}
+}
+
+// WithTargetFilter rejects ConnectionRequestMessages with the INVALID_TARGET
+// result code when valid returns false for the requested target.
+func WithTargetFilter(valid func(target string) bool) ServerOption {
+	return func(o *serverOptions) {
+		o.validTarget = valid
+	}
+}
+
+// WithMaxMessageSize sets the largest message the server accepts, 16 MiB
+// by default. Longer GEMS-ASCII messages are reported as malformed and
+// skipped, while longer GEMS-XML messages close the connection or, over
+// HTTP, fail the request with 413 Request Entity Too Large.
+func WithMaxMessageSize(n int) ServerOption {
+	return func(o *serverOptions) {
+		if n > 0 {
+			o.maxMessageSize = n
+		}
+	}
+}
+
 // DefaultMessageHandler responds to any incoming message with
 // a successful UnknownResponse message.
 func DefaultMessageHandler(r Message, v Version) (Response, error) {
@@ -36,7 +89,7 @@ func DefaultMessageHandler(r Message, v Version) (Response, error) {
 	return resp, nil
 }
 
-func connectionHandler(r Message, v Version, authToken string) (Response, error) {
+func connectionHandler(r Message, v Version, authToken string, opts serverOptions) (Response, error) {
 	mb := v.NewMessageBuilder().Type(ConnectResponseType)
 	if r.TransactionID().Valid {
 		mb.TransactionID(r.TransactionID().Int64)
@@ -49,6 +102,12 @@ func connectionHandler(r Message, v Version, authToken string) (Response, error)
 			resp, _ := msg.(Response)
 			return resp, fmt.Errorf("invalid access token")
 		}
+		if (opts.validTarget != nil) && !opts.validTarget(r.Target()) {
+			description := fmt.Sprintf("Target %s does not exist in this system", r.Target())
+			msg, _ := mb.Target(r.Target()).ResultCode(ResultCodeInvalidTarget).ResponseDescription(description).Build()
+			resp, _ := msg.(Response)
+			return resp, fmt.Errorf("unknown target '%s'", r.Target())
+		}
 		msg, _ := mb.Token(defaultToken).ResultCode(ResultCodeSuccess).Build()
 		resp, _ := msg.(Response)
 		return resp, nil
@@ -59,7 +118,20 @@ func connectionHandler(r Message, v Version, authToken string) (Response, error)
 	}
 }
 
+// listen opens the listener for addr. An address of the form "unix:path"
+// listens on a Unix domain socket.
 func listen(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+		return unixListener{l}, nil
+	}
+	if path, baud, ok := serialAddr(addr); ok {
+		return listenSerial(path, baud)
+	}
+
 	switch addr {
 	case "":
 		return net.Listen("tcp", "127.0.0.1:0")
@@ -72,50 +144,226 @@ type Server interface {
 	Start()
 	Close()
 	Addr() string
+
+	// Sessions returns the client sessions open on the server.
+	Sessions() []SessionInfo
+	// CloseSession closes the connection of the session with the given ID.
+	CloseSession(id string) error
+	// ServeConn serves a client connection that was not accepted by the
+	// server's listener, such as one end of a net.Pipe. It does not block.
+	ServeConn(conn net.Conn)
 }
 
-type xmlServer struct {
-	server    *http.Server
-	listener  net.Listener
-	address   string
+// Publisher is implemented by servers that can send unsolicited messages
+// to their connected clients. The GEMS-ASCII, GEMS-XML over TCP and
+// combined servers are Publishers; the GEMS-XML server is not.
+type Publisher interface {
+	Publish(Message) error
+}
+
+// serverCore holds the state and message processing shared by the
+// platform specific servers.
+type serverCore struct {
+	psm       string
+	handler   MessageHandler
 	version   Version
 	formatter MessageFormatter
-	conns     map[string]struct{}
 	authToken string
+	opts      serverOptions
+	logger    *slog.Logger
+	sessions  *sessionRegistry
 }
 
-func NewXMLServer(addr string, handler MessageHandler, f MessageFormatter, v Version, authToken string) Server {
+func newServerCore(psm string, handler MessageHandler, f MessageFormatter, v Version, authToken string, o serverOptions) serverCore {
+	return serverCore{
+		psm:       psm,
+		handler:   handler,
+		version:   v,
+		formatter: f,
+		authToken: authToken,
+		opts:      o,
+		logger:    o.logger.With(slog.String("psm", psm)),
+		sessions:  &sessionRegistry{},
+	}
+}
+
+// fatal logs a server setup error and exits.
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, slog.Any("error", err))
+	os.Exit(1)
+}
+
+func (c *serverCore) emit(e Event) {
+	if c.opts.events == nil {
+		return
+	}
+	e.Time = time.Now()
+	e.PSM = c.psm
+	c.opts.events(e)
+}
+
+func (c *serverCore) openSession(addr string, conn net.Conn) *session {
+	sess := c.sessions.open(c.psm, addr, conn)
+	c.logger.Debug("connection opened", slog.String(LogKeyRemoteAddr, addr), slog.String(LogKeySessionID, sess.id))
+	if c.opts.metrics != nil {
+		c.opts.metrics.sessionOpened(c.psm)
+	}
+	c.emit(Event{Type: EventConnectionOpened, RemoteAddr: addr, SessionID: sess.id})
+	return sess
+}
+
+func (c *serverCore) closeSession(addr string) {
+	if sess, ok := c.sessions.close(addr); ok {
+		c.logger.Debug("connection closed", slog.String(LogKeyRemoteAddr, addr), slog.String(LogKeySessionID, sess.id))
+		if c.opts.metrics != nil {
+			c.opts.metrics.sessionClosed(c.psm)
+		}
+		c.emit(Event{Type: EventConnectionClosed, RemoteAddr: addr, SessionID: sess.id})
+	}
+}
+
+func (c *serverCore) Sessions() []SessionInfo {
+	sessions := c.sessions.list()
+	info := make([]SessionInfo, len(sessions))
+	for i, sess := range sessions {
+		info[i] = sess.info()
+	}
+	return info
+}
+
+func (c *serverCore) CloseSession(id string) error {
+	sess, ok := c.sessions.byID(id)
+	if !ok {
+		return fmt.Errorf("unknown session '%s'", id)
+	}
+	if sess.conn == nil {
+		return fmt.Errorf("session '%s' has no connection to close", id)
+	}
+
+	c.logger.Info("closing session", sess.attrs()...)
+	return sess.conn.Close()
+}
+
+// faultPlan chooses the faults injected into the response to req.
+func (c *serverCore) faultPlan(sess *session, req Message, resp Response) faultPlan {
+	p := c.opts.faults.plan(c.psm, req, resp, c.version)
+	if len(p.faults) > 0 {
+		c.logger.Info("injecting faults", sess.attrs(append(messageAttrs(req), slog.Any("faults", p.faults))...)...)
+	}
+	return p
+}
+
+func (c *serverCore) malformed(sess *session, data []byte, err error) {
+	c.logger.Warn("malformed message", sess.attrs(slog.Any("error", err))...)
+	if c.opts.metrics != nil {
+		c.opts.metrics.parseError(c.psm)
+	}
+	c.emit(Event{Type: EventMalformed, RemoteAddr: sess.addr, SessionID: sess.id, Data: data, Err: err})
+}
+
+// process handles a request received on a session. It returns a nil
+// Response when no reply should be sent to the client.
+func (c *serverCore) process(sess *session, req Message) (Response, error) {
+	e := Event{RemoteAddr: sess.addr, SessionID: sess.id, Message: req}
+
+	if req.Type() == DisconnectMessageType {
+		c.logger.Info("client disconnected", sess.attrs(messageAttrs(req)...)...)
+		sess.disconnect()
+		e.Type = EventDisconnect
+		c.emit(e)
+		return nil, nil
+	}
+
+	var (
+		resp Response
+		err  error
+	)
+	start := time.Now()
+	switch connected, _ := sess.state(); connected {
+	case true:
+		resp, err = c.handler(req, c.version)
+		if c.opts.metrics != nil {
+			c.opts.metrics.message(c.psm, req, resp, time.Since(start))
+		}
+		e.Type = messageEventType(req.Type())
+	default:
+		e.Type = EventConnect
+		resp, err = connectionHandler(req, c.version, c.authToken, c.opts)
+		if c.opts.metrics != nil {
+			c.opts.metrics.connection(c.psm, resp)
+		}
+		if err != nil {
+			c.logger.Warn("connection attempt failed", sess.attrs(exchangeAttrs(req, resp, time.Since(start))...)...)
+			e.Response, e.Err = resp, err
+			c.emit(e)
+			return resp, nil
+		}
+		sess.connect(req.Target())
+	}
+	c.log(sess, req, resp, err, time.Since(start))
+
+	e.Response, e.Err = resp, err
+	c.emit(e)
+	return resp, err
+}
+
+func (c *serverCore) log(sess *session, req Message, resp Response, err error, latency time.Duration) {
+	attrs := sess.attrs(exchangeAttrs(req, resp, latency)...)
+	if err != nil {
+		c.logger.Error("handler failed", append(attrs, slog.Any("error", err))...)
+		return
+	}
+
+	c.logger.Info("handled message", attrs...)
+	if c.logger.Enabled(context.Background(), slog.LevelDebug) {
+		c.logger.Debug("message body", append(sess.attrs(messageAttrs(req)...), slog.String("body", c.formatter.Format(req)))...)
+	}
+}
+
+type xmlServer struct {
+	serverCore
+	server   *http.Server
+	listener net.Listener
+	conns    *connListener
+	address  string
+}
+
+func NewXMLServer(addr string, handler MessageHandler, f MessageFormatter, v Version, authToken string, opts ...ServerOption) Server {
+	o := newServerOptions(opts)
 	l, err := listen(addr)
 	if err != nil {
-		log.Fatalf("failed to start Listener: %s", err)
+		fatal(o.logger, "failed to start listener", err)
 	}
 
+	return newXMLServer(l, newServerCore("xml", handler, f, v, authToken, o))
+}
+
+func newXMLServer(l net.Listener, core serverCore) *xmlServer {
 	s := xmlServer{
-		listener:  l,
-		formatter: f,
+		serverCore: core,
+		listener:   l,
+		conns:      newConnListener(l.Addr()),
 		server: &http.Server{
 			Addr:              l.Addr().String(),
 			ReadHeaderTimeout: time.Minute,
 		},
-		version:   v,
-		authToken: authToken,
 	}
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("POST /", s.xmlHandlerWrapper(handler))
+	mux.HandleFunc("POST /", s.xmlHandlerWrapper())
 	s.server.Handler = drainMiddleware(mux)
 	s.connectionWrapper()
 
 	return &s
 }
 
-func messageFromRequest(r *http.Request, v Version) (Message, error) {
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	return ReceiveXMLMessage(body, v)
+// messageFromRequest decodes the message in the body of r, which may be at
+// most maxSize bytes long. It also returns the start of the body, to report
+// a malformed message.
+func messageFromRequest(r *http.Request, v Version, maxSize int) ([]byte, Message, error) {
+	body := newMessageReader(r.Body, maxSize)
+	msg, err := DecodeXMLMessage(body, v, nil)
+	return body.prefix, msg, err
 }
 
 func drainMiddleware(next http.Handler) http.Handler {
@@ -128,46 +376,57 @@ func drainMiddleware(next http.Handler) http.Handler {
 	)
 }
 
-func (s *xmlServer) xmlHandlerWrapper(handler MessageHandler) http.HandlerFunc {
+func (s *xmlServer) xmlHandlerWrapper() http.HandlerFunc {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
-				log.Printf("error: %s", err)
+				s.logger.Error("request failed", slog.String(LogKeyRemoteAddr, r.RemoteAddr), slog.Any("error", err))
 			}
 		}()
 
-		req, err := messageFromRequest(r, s.version)
+		sess, ok := s.sessions.get(r.RemoteAddr)
+		if !ok {
+			sess = s.openSession(r.RemoteAddr, nil)
+		}
+
+		body, req, err := messageFromRequest(r, s.version, s.opts.maxMessageSize)
 		if err != nil {
+			s.malformed(sess, body, err)
+			if errors.Is(err, ErrMessageTooLarge) {
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				return
+			}
 			panic(err)
 		}
 
-		if req.Type() == DisconnectMessageType {
-			log.Printf("%s disconnected", r.RemoteAddr)
-			delete(s.conns, r.RemoteAddr)
+		resp, err := s.process(sess, req)
+		if err != nil {
+			panic(err)
+		}
+		if resp == nil {
 			return
 		}
 
-		var resp Response
-		switch _, ok := s.conns[r.RemoteAddr]; ok {
-		case true:
-			if resp, err = handler(req, s.version); err != nil {
-				panic(err)
-			}
-		default:
-			if resp, err = connectionHandler(req, s.version, s.authToken); err != nil {
-				log.Printf("connection attempt by %s failed: %s", r.RemoteAddr, err)
-				break
+		plan := s.faultPlan(sess, req, resp)
+		time.Sleep(plan.delay)
+		if plan.reset {
+			if hj, ok := w.(http.Hijacker); ok {
+				if conn, _, err := hj.Hijack(); err == nil {
+					resetConn(conn)
+				}
 			}
-			s.conns[r.RemoteAddr] = struct{}{}
+			return
+		}
+		if plan.drop {
+			return
 		}
 
-		out, err := xml.Marshal(resp)
+		out, err := xml.Marshal(plan.resp)
 		if err != nil {
 			panic(err)
 		}
-		w.Write(out)
-		s.Log(req, resp, r.RemoteAddr)
+		w.Write(plan.apply(out))
 	}
 
 	return fn
@@ -177,29 +436,14 @@ func (s *xmlServer) connectionWrapper() {
 	s.server.ConnState = func(c net.Conn, cs http.ConnState) {
 		switch cs {
 		case http.StateNew:
-			if s.conns == nil {
-				s.conns = make(map[string]struct{})
-			}
+			s.openSession(c.RemoteAddr().String(), c)
 		case http.StateHijacked, http.StateClosed:
-			delete(s.conns, c.RemoteAddr().String())
+			s.closeSession(c.RemoteAddr().String())
 		}
 	}
 }
 
-func (s *xmlServer) Log(req Message, resp Message, addr string) {
-	var b strings.Builder
-
-	var respCode ResultCode
-	if m, ok := resp.(Response); ok {
-		respCode = m.Result().Code
-	}
-
-	fmt.Fprintf(&b, "| %s | %s | %s | %s |", addr, req.Type(), resp.Type(), respCode)
-	fmt.Fprintf(&b, "\n%s", s.formatter.Format(req))
-	log.Println(b.String())
-}
-
-func (s xmlServer) Addr() string {
+func (s *xmlServer) Addr() string {
 	return s.address
 }
 
@@ -209,55 +453,67 @@ func (s *xmlServer) Start() {
 	}
 	s.address = "http://" + s.listener.Addr().String()
 
+	for _, l := range []net.Listener{s.listener, s.conns} {
+		go func() {
+			if err := s.server.Serve(l); err != nil && err != http.ErrServerClosed && !errors.Is(err, net.ErrClosed) {
+				s.logger.Error("server failed", slog.Any("error", err))
+			}
+		}()
+	}
+}
+
+func (s *xmlServer) ServeConn(conn net.Conn) {
 	go func() {
-		if err := s.server.Serve(s.listener); err != nil && err != http.ErrServerClosed {
-			log.Println(err)
+		if !s.conns.push(conn) {
+			conn.Close()
 		}
 	}()
 }
 
 func (s *xmlServer) Close() {
 	s.listener.Close()
+	s.conns.Close()
 	s.address = ""
 }
 
-type asciiServer struct {
-	address   string
-	listener  net.Listener
-	handler   MessageHandler
-	version   Version
-	formatter MessageFormatter
-	conns     map[string]struct{}
-	authToken string
+// streamServer serves a PSM carried directly on stream connections, such
+// as GEMS-ASCII.
+type streamServer struct {
+	serverCore
+	address  string
+	listener net.Listener
+	framing  framing
 
 	wg         sync.WaitGroup
 	shutdown   chan struct{}
 	connection chan net.Conn
 }
 
-func NewASCIIServer(addr string, handler MessageHandler, f MessageFormatter, v Version, authToken string) Server {
+func NewASCIIServer(addr string, handler MessageHandler, f MessageFormatter, v Version, authToken string, opts ...ServerOption) Server {
+	o := newServerOptions(opts)
 	l, err := listen(addr)
 	if err != nil {
-		log.Fatalf("failed to start listener: %s", err)
+		fatal(o.logger, "failed to start listener", err)
 	}
 
-	return &asciiServer{
+	return newStreamServer(l, newServerCore("ascii", handler, f, v, authToken, o), asciiFraming)
+}
+
+func newStreamServer(l net.Listener, core serverCore, framing framing) *streamServer {
+	return &streamServer{
+		serverCore: core,
 		listener:   l,
-		handler:    handler,
-		version:    v,
-		formatter:  f,
+		framing:    framing,
 		shutdown:   make(chan struct{}),
 		connection: make(chan net.Conn),
-		conns:      map[string]struct{}{},
-		authToken:  authToken,
 	}
 }
 
-func (s *asciiServer) Addr() string {
+func (s *streamServer) Addr() string {
 	return s.address
 }
 
-func (s *asciiServer) Start() {
+func (s *streamServer) Start() {
 	if s.address != "" {
 		return
 	}
@@ -268,7 +524,7 @@ func (s *asciiServer) Start() {
 	go s.handleConnections()
 }
 
-func (s *asciiServer) acceptConnections() {
+func (s *streamServer) acceptConnections() {
 	defer s.wg.Done()
 
 	go func() {
@@ -279,7 +535,7 @@ func (s *asciiServer) acceptConnections() {
 			default:
 				conn, err := s.listener.Accept()
 				if err != nil {
-					log.Println(err)
+					s.logger.Warn("accept failed", slog.Any("error", err))
 					continue
 				}
 				s.connection <- conn
@@ -288,7 +544,7 @@ func (s *asciiServer) acceptConnections() {
 	}()
 }
 
-func (s *asciiServer) handleConnections() {
+func (s *streamServer) handleConnections() {
 	defer s.wg.Done()
 
 	for {
@@ -301,68 +557,90 @@ func (s *asciiServer) handleConnections() {
 	}
 }
 
-func (s *asciiServer) handlerWrapper(conn net.Conn) {
+func (s *streamServer) handlerWrapper(conn net.Conn) {
 	defer conn.Close()
 
 	remoteAddr := conn.RemoteAddr().String()
-	scanner := bufio.NewScanner(conn)
-	scanner.Split(ascii.SplitMessages)
-	for scanner.Scan() {
-		req, err := ReceiveASCIIMessage(scanner.Bytes(), s.version)
-		if err != nil {
-			log.Printf("error: %s", err)
+	conn, dec, err := s.framing(conn, s.opts.maxMessageSize)
+	if err != nil {
+		s.logger.Debug("connection closed before its first message", slog.String(LogKeyRemoteAddr, remoteAddr), slog.Any("error", err))
+		return
+	}
+	sess := s.openSession(remoteAddr, conn)
+	defer s.closeSession(remoteAddr)
+
+	for {
+		data, err := dec.Decode()
+		var syncErr *ascii.SyncError
+		if errors.As(err, &syncErr) {
+			s.malformed(sess, syncErr.Data, err)
 			continue
 		}
-
-		if req.Type() == DisconnectMessageType {
-			log.Printf("%s disconnected", remoteAddr)
-			delete(s.conns, remoteAddr)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				s.logger.Warn("connection read failed", sess.attrs(slog.Any("error", err))...)
+			}
 			return
 		}
 
-		var resp Response
-		switch _, ok := s.conns[remoteAddr]; ok {
-		case true:
-			if resp, err = s.handler(req, s.version); err != nil {
-				log.Printf("error: %s", err)
-				continue
-			}
-		default:
-			if resp, err = connectionHandler(req, s.version, s.authToken); err != nil {
-				log.Printf("connection attempt by %s failed: %s", remoteAddr, err)
-				break
-			}
-			s.conns[remoteAddr] = struct{}{}
+		req, err := decodeMessage(s.psm, data, s.version)
+		if err != nil {
+			s.malformed(sess, data, err)
+			continue
 		}
 
-		out, err := ascii.Marshal(resp)
+		resp, err := s.process(sess, req)
 		if err != nil {
-			log.Printf("error: %s", err)
 			continue
 		}
-		conn.Write(out)
-		s.Log(req, resp, remoteAddr)
-	}
+		if resp == nil {
+			if req.Type() == DisconnectMessageType {
+				return
+			}
+			continue
+		}
 
-	if err := scanner.Err(); err != nil {
-		log.Printf("scanner error: %s", err)
+		plan := s.faultPlan(sess, req, resp)
+		time.Sleep(plan.delay)
+		if plan.reset {
+			resetConn(conn)
+			return
+		}
+		if plan.drop {
+			continue
+		}
+
+		out, err := encodeMessage(s.psm, plan.resp)
+		if err != nil {
+			s.logger.Error("failed to marshal response", sess.attrs(slog.Any("error", err))...)
+			continue
+		}
+		sess.write(plan.apply(out))
 	}
 }
 
-func (s *asciiServer) Log(req Message, resp Message, addr string) {
-	var b strings.Builder
+func (s *streamServer) ServeConn(conn net.Conn) {
+	go s.handlerWrapper(conn)
+}
 
-	var respCode ResultCode
-	if m, ok := resp.(Response); ok {
-		respCode = m.Result().Code
+// Publish sends an unsolicited message, such as an AsyncStatusMessage,
+// to every client connected to the target of the message. Messages
+// without a target are sent to every connected client.
+func (s *streamServer) Publish(msg Message) error {
+	out, err := encodeMessage(s.psm, msg)
+	if err != nil {
+		return err
 	}
 
-	fmt.Fprintf(&b, "| %s | %s | %s | %s |", addr, req.Type(), resp.Type(), respCode)
-	fmt.Fprintf(&b, "\n%s", s.formatter.Format(req))
-	log.Println(b.String())
+	for _, sess := range s.sessions.connected(s.psm, msg.Target()) {
+		if err := sess.write(out); err != nil {
+			s.logger.Warn("publish failed", sess.attrs(append(messageAttrs(msg), slog.Any("error", err))...)...)
+		}
+	}
+	return nil
 }
 
-func (s *asciiServer) Close() {
+func (s *streamServer) Close() {
 	close(s.shutdown)
 	s.listener.Close()
 
@@ -376,7 +654,7 @@ func (s *asciiServer) Close() {
 	case <-done:
 		return
 	case <-time.After(time.Second):
-		log.Printf("shutdown timed out")
+		s.logger.Warn("shutdown timed out")
 		return
 	}
 }
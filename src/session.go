@@ -0,0 +1,170 @@
+package gems
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// session tracks a client connection to a GEMS server. A session is
+// opened with the underlying connection and is connected once the
+// client completes the ConnectionRequestMessage exchange.
+type session struct {
+	id     string
+	psm    string
+	addr   string
+	conn   net.Conn
+	opened time.Time
+
+	mu        sync.Mutex
+	target    string
+	connected bool
+}
+
+func newSession(psm string, addr string, conn net.Conn) *session {
+	return &session{id: newSessionID(), psm: psm, addr: addr, conn: conn, opened: time.Now()}
+}
+
+func newSessionID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// write sends data to the client. Writes are serialized so that
+// asynchronous messages are not interleaved with responses.
+func (s *session) write(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.conn.Write(data)
+	return err
+}
+
+// attrs returns the log attributes identifying the session followed by
+// extra.
+func (s *session) attrs(extra ...any) []any {
+	return append([]any{slog.String(LogKeyRemoteAddr, s.addr), slog.String(LogKeySessionID, s.id)}, extra...)
+}
+
+func (s *session) connect(target string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.connected = true
+	s.target = target
+}
+
+func (s *session) disconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.connected = false
+}
+
+func (s *session) state() (connected bool, target string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.connected, s.target
+}
+
+// SessionInfo describes a client session open on a server.
+type SessionInfo struct {
+	ID         string    `json:"id"`
+	PSM        string    `json:"psm"`
+	RemoteAddr string    `json:"remote_addr"`
+	Target     string    `json:"target"`
+	Connected  bool      `json:"connected"`
+	Opened     time.Time `json:"opened"`
+}
+
+func (s *session) info() SessionInfo {
+	connected, target := s.state()
+	return SessionInfo{ID: s.id, PSM: s.psm, RemoteAddr: s.addr, Target: target, Connected: connected, Opened: s.opened}
+}
+
+// sessionRegistry holds the open sessions of a server, keyed by the
+// remote address of the client. A registry may be shared by servers of
+// different PSMs.
+type sessionRegistry struct {
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+func (r *sessionRegistry) open(psm string, addr string, conn net.Conn) *session {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.sessions == nil {
+		r.sessions = make(map[string]*session)
+	}
+	sess := newSession(psm, addr, conn)
+	r.sessions[addr] = sess
+	return sess
+}
+
+func (r *sessionRegistry) get(addr string) (*session, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sess, ok := r.sessions[addr]
+	return sess, ok
+}
+
+func (r *sessionRegistry) close(addr string) (*session, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sess, ok := r.sessions[addr]
+	delete(r.sessions, addr)
+	return sess, ok
+}
+
+// connected returns the connected sessions of psm for target. An empty
+// target matches every connected session.
+func (r *sessionRegistry) connected(psm string, target string) []*session {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var sessions []*session
+	for _, sess := range r.sessions {
+		connected, t := sess.state()
+		if connected && (sess.psm == psm) && ((target == "") || (target == t)) {
+			sessions = append(sessions, sess)
+		}
+	}
+	return sessions
+}
+
+// byID returns the session with the given ID.
+func (r *sessionRegistry) byID(id string) (*session, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, sess := range r.sessions {
+		if sess.id == id {
+			return sess, true
+		}
+	}
+	return nil, false
+}
+
+// list returns every open session, oldest first.
+func (r *sessionRegistry) list() []*session {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sessions := make([]*session, 0, len(r.sessions))
+	for _, sess := range r.sessions {
+		sessions = append(sessions, sess)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].opened.Before(sessions[j].opened)
+	})
+	return sessions
+}
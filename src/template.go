@@ -0,0 +1,132 @@
+package gems
+
+import (
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// TemplateFormatter formats a message with a text/template. The template
+// is executed with the Message, so that e.g. {{.Type}} and {{.Target}}
+// give its type and target, and has the following functions:
+//
+//	resultCode MSG           the result code of a response
+//	resultDescription MSG    the result description of a response
+//	params MSG               the parameters of a ParameterMessage
+//	param MSG NAME           the parameter with the given name
+//	int64s, float64s, strings, bools, times, children PARAM
+//	                         the values of a parameter as a slice
+//	int64, float64, string, bool, time PARAM
+//	                         the single value of a parameter
+//	bytes PARAM              the hex_value values of a parameter as byte slices
+//	hex BYTES                a byte slice in upper case hexadecimal
+//	join SLICE SEP           the values of a slice, separated by SEP
+//
+// resultCode and resultDescription give an empty string for a message that
+// is not a response, and params gives no parameters. The parameter
+// functions fail if a value cannot be converted, or if the parameter does
+// not have exactly one value for the single value functions.
+// FormatMessage returns the error of a failed template, while Format
+// returns an empty string.
+type TemplateFormatter struct {
+	tmpl *template.Template
+}
+
+// NewTemplateFormatter parses text as a template for formatting messages.
+func NewTemplateFormatter(text string) (*TemplateFormatter, error) {
+	tmpl, err := template.New("message").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &TemplateFormatter{tmpl: tmpl}, nil
+}
+
+// FormatMessage formats msg with the template.
+func (f *TemplateFormatter) FormatMessage(msg Message) (string, error) {
+	var b strings.Builder
+	if err := f.tmpl.Execute(&b, msg); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Format formats msg with the template, or returns an empty string if the
+// template fails.
+func (f *TemplateFormatter) Format(msg Message) string {
+	out, _ := f.FormatMessage(msg)
+	return out
+}
+
+var templateFuncs = template.FuncMap{
+	"resultCode": func(msg Message) string {
+		if resp, ok := msg.(Response); ok {
+			return string(resp.Result().Code)
+		}
+		return ""
+	},
+	"resultDescription": func(msg Message) string {
+		if resp, ok := msg.(Response); ok {
+			return resp.Result().Description
+		}
+		return ""
+	},
+	"params": messageParameters,
+	"param": func(msg Message, name string) (Parameter, error) {
+		for _, p := range messageParameters(msg) {
+			if p.Name() == name {
+				return p, nil
+			}
+		}
+		return nil, fmt.Errorf("no parameter '%s' in %s", name, msg.Type())
+	},
+	"int64s":   Parameter.Int64s,
+	"float64s": Parameter.Float64s,
+	"strings":  Parameter.Strings,
+	"bools":    Parameter.Bools,
+	"times":    Parameter.Times,
+	"children": Parameter.Children,
+	"bytes":    Parameter.Bytes,
+	"int64":    func(p Parameter) (int64, error) { return single(p, p.Int64s) },
+	"float64":  func(p Parameter) (float64, error) { return single(p, p.Float64s) },
+	"string":   func(p Parameter) (string, error) { return single(p, p.Strings) },
+	"bool":     func(p Parameter) (bool, error) { return single(p, p.Bools) },
+	"time":     func(p Parameter) (time.Time, error) { return single(p, p.Times) },
+	"hex": func(data []byte) string {
+		return strings.ToUpper(hex.EncodeToString(data))
+	},
+	"join": func(values any, sep string) (string, error) {
+		v := reflect.ValueOf(values)
+		if v.Kind() != reflect.Slice {
+			return "", fmt.Errorf("cannot join %T", values)
+		}
+		fields := make([]string, v.Len())
+		for i := range v.Len() {
+			fields[i] = fmt.Sprint(v.Index(i).Interface())
+		}
+		return strings.Join(fields, sep), nil
+	},
+}
+
+// messageParameters returns the parameters carried by a message.
+func messageParameters(msg Message) []Parameter {
+	if m, ok := msg.(ParameterMessage); ok {
+		return m.ParameterList()
+	}
+	return []Parameter{}
+}
+
+// single returns the only value of a parameter.
+func single[T any](p Parameter, values func() ([]T, error)) (T, error) {
+	var zero T
+	v, err := values()
+	if err != nil {
+		return zero, err
+	}
+	if len(v) != 1 {
+		return zero, fmt.Errorf("parameter '%s' has %d values, want 1", p.Name(), len(v))
+	}
+	return v[0], nil
+}
@@ -0,0 +1,263 @@
+package gems
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitre/gems/src/ascii"
+)
+
+// TranscriptEntry is a request and the response received for it, encoded
+// in the GEMS-ASCII or GEMS-XML form sent on the wire. A transcript is
+// stored as JSON lines, one entry per line.
+type TranscriptEntry struct {
+	Time      time.Time `json:"time"`
+	PSM       string    `json:"psm"`
+	LatencyMS float64   `json:"latency_ms"`
+	Request   string    `json:"request"`
+	Response  string    `json:"response,omitempty"`
+}
+
+// Latency returns the time taken for the response to arrive.
+func (e TranscriptEntry) Latency() time.Duration {
+	return time.Duration(e.LatencyMS * float64(time.Millisecond))
+}
+
+// TranscriptWriter records client exchanges as a transcript.
+type TranscriptWriter struct {
+	enc *json.Encoder
+	mu  sync.Mutex
+}
+
+func NewTranscriptWriter(w io.Writer) *TranscriptWriter {
+	return &TranscriptWriter{enc: json.NewEncoder(w)}
+}
+
+// Record writes an exchange to the transcript. resp may be nil when no
+// response was received.
+func (t *TranscriptWriter) Record(psm string, req Message, resp Response, start time.Time, latency time.Duration) error {
+	entry := TranscriptEntry{
+		Time:      start,
+		PSM:       psm,
+		LatencyMS: float64(latency) / float64(time.Millisecond),
+	}
+
+	out, err := encodeMessage(psm, req)
+	if err != nil {
+		return err
+	}
+	entry.Request = string(out)
+
+	if resp != nil {
+		if out, err = encodeMessage(psm, resp); err != nil {
+			return err
+		}
+		entry.Response = string(out)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.enc.Encode(entry)
+}
+
+// WithTranscript records every exchange of the client to t.
+func WithTranscript(t *TranscriptWriter) ClientOption {
+	return func(c *Client) {
+		c.transcript = t
+	}
+}
+
+func encodeMessage(psm string, m Message) ([]byte, error) {
+	if isXMLPSM(psm) {
+		return xml.Marshal(m)
+	}
+	return ascii.Marshal(m)
+}
+
+func decodeMessage(psm string, data []byte, v Version) (Message, error) {
+	if isXMLPSM(psm) {
+		return ReceiveXMLMessage(data, v)
+	}
+	return ReceiveASCIIMessage(data, v)
+}
+
+// ReadTranscript reads the entries of a transcript.
+func ReadTranscript(r io.Reader) ([]TranscriptEntry, error) {
+	var entries []TranscriptEntry
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+
+		var entry TranscriptEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("transcript line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// Replayer is a MessageHandler that answers requests with the responses
+// recorded in a transcript. Requests are matched by message type, the
+// names of their parameters, and the directive or configuration name.
+// Repeated requests receive the recorded responses in order, and the last
+// one once they are exhausted.
+type Replayer struct {
+	// Timing delays each response by its recorded latency.
+	Timing bool
+
+	mu        sync.Mutex
+	exchanges map[string][]replayExchange
+	next      map[string]int
+}
+
+type replayExchange struct {
+	psm      string
+	response []byte
+	latency  time.Duration
+}
+
+// NewReplayer decodes the requests of a transcript with v. Entries without
+// a response, such as DisconnectMessages, are skipped.
+func NewReplayer(entries []TranscriptEntry, v Version) (*Replayer, error) {
+	r := &Replayer{
+		exchanges: make(map[string][]replayExchange),
+		next:      make(map[string]int),
+	}
+
+	for i, entry := range entries {
+		if entry.Response == "" {
+			continue
+		}
+
+		req, err := decodeMessage(entry.PSM, []byte(entry.Request), v)
+		if err != nil {
+			return nil, fmt.Errorf("transcript entry %d: %w", i+1, err)
+		}
+		if _, err := decodeMessage(entry.PSM, []byte(entry.Response), v); err != nil {
+			return nil, fmt.Errorf("transcript entry %d: %w", i+1, err)
+		}
+
+		key := replayKey(req)
+		r.exchanges[key] = append(r.exchanges[key], replayExchange{
+			psm:      entry.PSM,
+			response: []byte(entry.Response),
+			latency:  entry.Latency(),
+		})
+	}
+	return r, nil
+}
+
+// Len returns the number of recorded exchanges.
+func (r *Replayer) Len() int {
+	n := 0
+	for _, exchanges := range r.exchanges {
+		n += len(exchanges)
+	}
+	return n
+}
+
+// Handle returns the recorded response for m with the transaction ID of
+// m. Requests that were not recorded receive an UnknownResponse.
+func (r *Replayer) Handle(m Message, v Version) (Response, error) {
+	key := replayKey(m)
+
+	r.mu.Lock()
+	exchanges := r.exchanges[key]
+	var (
+		exchange replayExchange
+		found    = len(exchanges) > 0
+	)
+	if found {
+		exchange = exchanges[min(r.next[key], len(exchanges)-1)]
+		r.next[key]++
+	}
+	r.mu.Unlock()
+
+	if !found {
+		mb := v.NewMessageBuilder().Type(UnknownResponseType).Token(m.Token())
+		if m.TransactionID().Valid {
+			mb.TransactionID(m.TransactionID().Int64)
+		}
+		msg, err := mb.ResultCode(ResultCodeUnsupportedMessage).ResponseDescription("no recorded response").Build()
+		resp, _ := msg.(Response)
+		return resp, err
+	}
+
+	if r.Timing {
+		time.Sleep(exchange.latency)
+	}
+
+	out := exchange.response
+	if id := m.TransactionID(); id.Valid {
+		out = setTransactionID(exchange.psm, out, id.Int64)
+	}
+	msg, err := decodeMessage(exchange.psm, out, v)
+	if err != nil {
+		return nil, err
+	}
+	resp, ok := msg.(Response)
+	if !ok {
+		return nil, fmt.Errorf("recorded %s is not a response", msg.Type())
+	}
+	return resp, nil
+}
+
+// replayKey identifies the requests that receive the same response.
+func replayKey(m Message) string {
+	body := m.Body()
+	key := []string{m.Type().ASCII()}
+
+	for _, field := range []string{"directive_name", "config_name"} {
+		if name, ok := body[field].(string); ok {
+			key = append(key, name)
+		}
+	}
+	for _, field := range []string{"desired_parameters", "parameters", "arguments"} {
+		if params, ok := body[field].([]string); ok {
+			key = append(key, strings.Join(parameterNames(params), ","))
+		}
+	}
+	return strings.Join(key, "|")
+}
+
+// parameterNames returns the sorted names of ASCII formatted parameters.
+func parameterNames(params []string) []string {
+	names := make([]string, len(params))
+	for i, p := range params {
+		names[i], _, _ = strings.Cut(p, ":")
+	}
+	sort.Strings(names)
+	return names
+}
+
+func setTransactionID(psm string, out []byte, id int64) []byte {
+	if isXMLPSM(psm) {
+		return replaceXMLTransactionID(out, func(int64) int64 { return id })
+	}
+	return replaceASCIITransactionID(out, func(int64) int64 { return id })
+}
+
+var xmlTransactionID = regexp.MustCompile(`transaction_id="(\d*)"`)
+
+// replaceXMLTransactionID passes the transaction ID of a GEMS-XML message
+// through f.
+func replaceXMLTransactionID(out []byte, f func(int64) int64) []byte {
+	return xmlTransactionID.ReplaceAllFunc(out, func(attr []byte) []byte {
+		id, _ := strconv.ParseInt(string(xmlTransactionID.FindSubmatch(attr)[1]), 10, 64)
+		return []byte(fmt.Sprintf(`transaction_id="%d"`, f(id)))
+	})
+}
@@ -0,0 +1,132 @@
+package gems
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+)
+
+// Transport carries the messages of a Client to a GEMS device. The Client
+// keeps the GEMS connection state, such as the token and transaction IDs,
+// and the Transport encodes each message for its PSM and exchanges it with
+// the device.
+type Transport interface {
+	// Connect opens a connection to the device at addr and sends req, the
+	// ConnectionRequestMessage.
+	Connect(addr string, req Message, v Version) (Response, error)
+	// ConnectTLS is Connect over a TLS connection. If insecure is true,
+	// self-signed certificates are accepted.
+	ConnectTLS(addr string, req Message, insecure bool, v Version) (Response, error)
+	// Send sends m and returns the response with a matching transaction ID.
+	// A response with a failed result is not an error of the transport; the
+	// Client reports it as a *ResponseError.
+	Send(m Message, v Version) (Response, error)
+	// ServerAddr returns the address of the connected device.
+	ServerAddr() string
+}
+
+// DialFunc opens the connection a Transport carries messages on. It has
+// the signature of net.Dialer.DialContext.
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// WithTransport makes the client send its messages with t instead of the
+// transport of its PSM. The PSM of the client still names the encoding
+// recorded in transcripts.
+func WithTransport(t Transport) ClientOption {
+	return func(c *Client) {
+		if t != nil {
+			c.model = t
+		}
+	}
+}
+
+// NewTransport returns the Transport for psm, which accepts the same values
+// as NewClient. Connections are opened with dial, or with a net.Dialer if
+// dial is nil.
+func NewTransport(psm string, dial DialFunc) (Transport, error) {
+	switch psm := strings.ToLower(psm); psm {
+	case "xml":
+		return &xmlClient{dial: dial}, nil
+	case "ascii":
+		return &streamClient{psm: psm, framing: asciiFraming, dial: dial}, nil
+	case "xml-tcp":
+		return &streamClient{psm: psm, framing: xmlFraming, dial: dial}, nil
+	case "xml-tcp-length":
+		return &streamClient{psm: psm, framing: lengthPrefixFraming, dial: dial}, nil
+	default:
+		return nil, fmt.Errorf("unknown PSM '%s'", psm)
+	}
+}
+
+// NewUnixTransport returns a Transport for psm that connects to the Unix
+// domain socket at path. The address passed to Connect is not dialed and
+// only names the device, e.g. in the URL of GEMS-XML requests.
+func NewUnixTransport(psm string, path string) (Transport, error) {
+	return NewTransport(psm, func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", path)
+	})
+}
+
+// NewPipeTransport returns a Transport for psm that connects to server in
+// the same process over a net.Pipe, without opening a socket. It is meant
+// for tests. The address passed to Connect is not dialed.
+func NewPipeTransport(psm string, server Server) (Transport, error) {
+	return NewTransport(psm, func(ctx context.Context, _, _ string) (net.Conn, error) {
+		client, conn := net.Pipe()
+		server.ServeConn(&namedConn{Conn: conn, addr: newLocalAddr("pipe")})
+		return client, nil
+	})
+}
+
+var localAddrCount atomic.Int64
+
+// localAddr names a client connection that has no network address of its
+// own, such as one end of a net.Pipe or a Unix socket client. Servers key
+// their sessions by the remote address, so each needs a distinct name.
+type localAddr struct {
+	network string
+	name    string
+}
+
+func newLocalAddr(network string) localAddr {
+	return localAddr{network: network, name: fmt.Sprintf("%s-%d", network, localAddrCount.Add(1))}
+}
+
+func (a localAddr) Network() string {
+	return a.network
+}
+
+func (a localAddr) String() string {
+	return a.name
+}
+
+// namedConn replaces the remote address of a connection.
+type namedConn struct {
+	net.Conn
+	addr net.Addr
+}
+
+func (c *namedConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+// NetConn returns the underlying connection.
+func (c *namedConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// unixListener names the connections accepted on a Unix domain socket.
+type unixListener struct {
+	net.Listener
+}
+
+func (l unixListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &namedConn{Conn: conn, addr: newLocalAddr("unix")}, nil
+}
@@ -121,7 +121,7 @@ func (t Time) MarshalXMLAttr(name xml.Name) (xml.Attr, error) {
 func (t Time) String() string {
 	sec := t.Unix()
 	nsec := t.Sub(time.Unix(sec, 0)).Nanoseconds()
-	return fmt.Sprintf("%d.%d", sec, nsec)
+	return fmt.Sprintf("%d.%09d", sec, nsec)
 }
 
 func (t Time) FormatTime() string {
@@ -364,6 +364,31 @@ func (t MessageType) ASCII() string {
 	}
 }
 
+// ResponseType returns the type of the response to a message of type t.
+// Message types without a matching response return UnknownResponseType.
+func (t MessageType) ResponseType() MessageType {
+	switch t {
+	case SetConfigMessageType:
+		return SetConfigResponseType
+	case GetConfigMessageType:
+		return GetConfigResponseType
+	case GetConfigListMessageType:
+		return GetConfigListResponseType
+	case LoadConfigMessageType:
+		return LoadConfigResponseType
+	case SaveConfigMessageType:
+		return SaveConfigResponseType
+	case DirectiveMessageType:
+		return DirectiveResponseType
+	case PingMessageType:
+		return PingResponseType
+	case ConnectMessageType:
+		return ConnectResponseType
+	default:
+		return UnknownResponseType
+	}
+}
+
 func MessageTypeFromASCII(t string) MessageType {
 	switch t {
 	case "SET":
@@ -687,3 +712,20 @@ func DatatypeFromXML(t string) Datatype {
 		return UndefinedType
 	}
 }
+
+// A ConversionError reports a parameter value that cannot be converted to
+// the requested Go type.
+type ConversionError struct {
+	Parameter string
+	Datatype  Datatype
+	GoType    string
+	// Value holds the value that overflows GoType, if any.
+	Value string
+}
+
+func (e *ConversionError) Error() string {
+	if e.Value != "" {
+		return fmt.Sprintf("gems: %s value %s of parameter '%s' overflows %s", e.Datatype, e.Value, e.Parameter, e.GoType)
+	}
+	return fmt.Sprintf("gems: cannot convert %s value of parameter '%s' to %s", e.Datatype, e.Parameter, e.GoType)
+}
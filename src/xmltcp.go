@@ -0,0 +1,280 @@
+package gems
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/mitre/gems/src/ascii"
+)
+
+// isXMLPSM reports whether psm carries GEMS-XML, over HTTP or directly on a
+// stream connection.
+func isXMLPSM(psm string) bool {
+	return strings.HasPrefix(psm, "xml")
+}
+
+// messageDecoder reads the messages of a stream PSM.
+type messageDecoder interface {
+	// Decode returns the next message, or io.EOF at the end of the stream.
+	Decode() ([]byte, error)
+}
+
+// framing prepares a stream connection for a PSM and returns the decoder
+// of its messages, which accepts messages of up to maxSize bytes. Writes
+// to the returned connection must each carry one whole message.
+type framing func(conn net.Conn, maxSize int) (net.Conn, messageDecoder, error)
+
+func asciiFraming(conn net.Conn, maxSize int) (net.Conn, messageDecoder, error) {
+	d := ascii.NewDecoder(conn)
+	d.SetMaxMessageSize(maxSize)
+	return conn, d, nil
+}
+
+func xmlFraming(conn net.Conn, maxSize int) (net.Conn, messageDecoder, error) {
+	return conn, newScanDecoder(conn, NewXMLSplitFunc(), maxSize), nil
+}
+
+func lengthPrefixFraming(conn net.Conn, maxSize int) (net.Conn, messageDecoder, error) {
+	return lengthPrefixConn{conn}, newScanDecoder(conn, SplitLengthPrefixedMessages, maxSize+4), nil
+}
+
+// scanDecoder decodes the messages split from a stream by a
+// bufio.SplitFunc.
+type scanDecoder struct {
+	scanner *bufio.Scanner
+}
+
+func newScanDecoder(r io.Reader, split bufio.SplitFunc, maxSize int) *scanDecoder {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxSize)
+	scanner.Split(split)
+	return &scanDecoder{scanner: scanner}
+}
+
+func (d *scanDecoder) Decode() ([]byte, error) {
+	if d.scanner.Scan() {
+		return bytes.Clone(d.scanner.Bytes()), nil
+	}
+	if err := d.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// detectXMLFraming chooses the framing of a GEMS-XML stream from its first
+// byte. A message framed by its root element starts with '<' or
+// whitespace. The smallest of these is '\t' (0x09), so a length prefix
+// cannot start with one for messages under maxLengthPrefixedSize.
+func detectXMLFraming(conn net.Conn, maxSize int) (net.Conn, messageDecoder, error) {
+	r := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(sniffTimeout))
+	first, err := r.Peek(1)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	peeked := &peekedConn{Conn: conn, r: r}
+	if (first[0] == '<') || isXMLSpace(first[0]) {
+		return xmlFraming(peeked, maxSize)
+	}
+	return lengthPrefixFraming(peeked, maxSize)
+}
+
+// maxLengthPrefixedSize is the smallest length whose prefix starts with a
+// byte that may start a message framed by its root element, 0x09000000
+// bytes or 144 MiB. Longer length prefixed messages are rejected.
+const maxLengthPrefixedSize = 0x09000000
+
+// lengthPrefixConn prefixes each write with its length as a 4 byte
+// big-endian unsigned integer.
+type lengthPrefixConn struct {
+	net.Conn
+}
+
+func (c lengthPrefixConn) Write(b []byte) (int, error) {
+	if len(b) >= maxLengthPrefixedSize {
+		return 0, fmt.Errorf("length prefixed message of %d bytes is not under the limit of %d bytes", len(b), maxLengthPrefixedSize)
+	}
+
+	framed := binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(b)), uint32(len(b)))
+	if _, err := c.Conn.Write(append(framed, b...)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// NetConn returns the underlying connection.
+func (c lengthPrefixConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// SplitLengthPrefixedMessages is a bufio.SplitFunc for a stream of
+// messages each preceded by its length as a 4 byte big-endian unsigned
+// integer. The tokens do not include the prefix. Messages of 0x09000000
+// bytes (144 MiB) or more are rejected, so a stream of them can be told
+// apart from one framed by root elements.
+func SplitLengthPrefixedMessages(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if len(data) >= 4 {
+		size := binary.BigEndian.Uint32(data)
+		if size >= maxLengthPrefixedSize {
+			return 0, nil, fmt.Errorf("length prefixed message of %d bytes is not under the limit of %d bytes", size, maxLengthPrefixedSize)
+		}
+		end := 4 + int(size)
+		if len(data) >= end {
+			return end, data[4:end], nil
+		}
+	}
+	if atEOF && len(data) > 0 {
+		return 0, nil, fmt.Errorf("received partial length prefixed message")
+	}
+	if atEOF {
+		return 0, nil, io.EOF
+	}
+	return 0, nil, nil
+}
+
+// NewXMLSplitFunc returns a bufio.SplitFunc for a stream of GEMS-XML
+// messages that are not length prefixed. Each token runs from the first
+// non-whitespace byte after the previous message to the end of the next
+// root element, so it includes any XML declaration or comments before
+// the root.
+//
+// The split function keeps its scan position and element depth between
+// calls, so a message arriving in many reads is scanned once. It must
+// only be used for a single stream.
+func NewXMLSplitFunc() bufio.SplitFunc {
+	var s xmlSplitter
+	return s.split
+}
+
+// xmlSplitter holds the progress of the scan for the next message, as
+// offsets into the data passed to split.
+type xmlSplitter struct {
+	// start is the offset of the message, and pos the offset of the first
+	// byte not yet scanned.
+	start int
+	pos   int
+	depth int
+}
+
+func (s *xmlSplitter) split(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if s.pos == s.start {
+		for (s.pos < len(data)) && isXMLSpace(data[s.pos]) {
+			s.pos++
+		}
+		s.start = s.pos
+	}
+
+	for s.pos < len(data) {
+		if data[s.pos] != '<' {
+			s.pos++
+			continue
+		}
+
+		// Markup that is not yet complete is scanned again with more data.
+		n, kind := xmlMarkup(data[s.pos:])
+		if n == 0 {
+			break
+		}
+		s.pos += n
+
+		switch kind {
+		case xmlStartTag:
+			s.depth++
+			continue
+		case xmlEndTag:
+			s.depth--
+		case xmlEmptyTag:
+		default:
+			continue
+		}
+		if s.depth <= 0 {
+			advance, token = s.pos, data[s.start:s.pos]
+			*s = xmlSplitter{}
+			return advance, token, nil
+		}
+	}
+
+	if atEOF && (s.start < len(data)) {
+		return 0, nil, fmt.Errorf("received partial GEMS-XML message")
+	}
+	if atEOF {
+		return 0, nil, io.EOF
+	}
+
+	// Drop the whitespace before the message.
+	advance = s.start
+	s.start, s.pos = 0, s.pos-advance
+	return advance, nil, nil
+}
+
+type xmlMarkupKind int
+
+const (
+	xmlOtherMarkup xmlMarkupKind = iota
+	xmlStartTag
+	xmlEndTag
+	xmlEmptyTag
+)
+
+// xmlMarkup returns the length and kind of the markup at the start of
+// data, or 0 if data does not hold all of it.
+func xmlMarkup(data []byte) (int, xmlMarkupKind) {
+	for _, delims := range [][2]string{{"<!--", "-->"}, {"<![CDATA[", "]]>"}, {"<?", "?>"}, {"<!", ">"}} {
+		if bytes.HasPrefix(data, []byte(delims[0])) {
+			if i := bytes.Index(data[len(delims[0]):], []byte(delims[1])); i >= 0 {
+				return len(delims[0]) + i + len(delims[1]), xmlOtherMarkup
+			}
+			return 0, xmlOtherMarkup
+		}
+	}
+
+	// An element tag, which ends at the first '>' outside an attribute value.
+	var quote byte
+	for i := 1; i < len(data); i++ {
+		switch c := data[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"') || (c == '\''):
+			quote = c
+		case c == '>':
+			switch {
+			case data[1] == '/':
+				return i + 1, xmlEndTag
+			case data[i-1] == '/':
+				return i + 1, xmlEmptyTag
+			default:
+				return i + 1, xmlStartTag
+			}
+		}
+	}
+	return 0, xmlOtherMarkup
+}
+
+func isXMLSpace(c byte) bool {
+	return (c == ' ') || (c == '\t') || (c == '\r') || (c == '\n')
+}
+
+// NewXMLTCPServer creates a server for GEMS-XML carried directly on TCP
+// connections rather than in HTTP requests. The framing of each connection
+// is detected from its first message: messages are either framed by their
+// root element or preceded by their length as a 4 byte big-endian
+// unsigned integer. Responses use the framing of the client.
+func NewXMLTCPServer(addr string, handler MessageHandler, f MessageFormatter, v Version, authToken string, opts ...ServerOption) Server {
+	o := newServerOptions(opts)
+	l, err := listen(addr)
+	if err != nil {
+		fatal(o.logger, "failed to start listener", err)
+	}
+
+	return newStreamServer(l, newServerCore("xml-tcp", handler, f, v, authToken, o), detectXMLFraming)
+}